@@ -4,6 +4,8 @@ import (
 	"crypto/hmac"
 	"crypto/sha1"
 	"fmt"
+	"io"
+	"net/url"
 	"sort"
 	"strings"
 
@@ -40,3 +42,17 @@ func hmacEncode(sign, key string) string {
 	_, _ = h.Write([]byte(sign))
 	return fmt.Sprintf("%s", h.Sum(nil))
 }
+
+// curl 按重试策略发送请求
+func (c *Client) curl(addr, method string, headers map[string]string, body io.Reader) (map[string]interface{}, error) {
+	return storageutil.CURLWithRetry(c.control, c.bucketOf(addr), addr, method, headers, body, nil)
+}
+
+// bucketOf 根据请求地址获取bucket,用于bucket的请求频率限制
+func (c *Client) bucketOf(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil || !strings.HasSuffix(u.Host, "."+c.host) {
+		return ""
+	}
+	return strings.TrimSuffix(u.Host, "."+c.host)
+}
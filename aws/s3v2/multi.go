@@ -2,6 +2,7 @@ package s3v2
 
 import (
 	"bytes"
+	"encoding/hex"
 	"encoding/xml"
 	"errors"
 	"fmt"
@@ -27,8 +28,11 @@ type CopyPartResult = storagebase.CopyPartResult
 // CompleteUploadResult 完成上传结果
 type CompleteUploadResult = storagebase.CompleteUploadResult
 
+// ListUploadedPartsResult 已上传分块列表结果
+type ListUploadedPartsResult = storagebase.ListUploadedPartsResult
+
 // UploadLargeFile 分块上传文件
-func (c *Client) UploadLargeFile(filePath, bucket, object string, options map[string]string, percentChan chan int) (map[string]interface{}, error) {
+func (c *Client) UploadLargeFile(filePath, bucket, object string, options map[string]string, listener storagebase.ProgressListener) (map[string]interface{}, error) {
 	//open本地文件
 	fd, openErr := os.Open(filePath)
 	if fd != nil {
@@ -37,14 +41,34 @@ func (c *Client) UploadLargeFile(filePath, bucket, object string, options map[st
 	if openErr != nil {
 		return nil, fmt.Errorf(" UploadLargeFile Open localFile: %s Error: %v", filePath, openErr)
 	}
-
-	var partSize = c.partMaxSize
-	if options["part_size"] != "" {
-		n, err := strconv.Atoi(options["part_size"])
-		if err == nil && n <= c.partMaxSize && n >= c.partMinSize {
-			partSize = n
+	localStat, statErr := fd.Stat()
+	if statErr != nil {
+		return nil, fmt.Errorf(" UploadLargeFile Stat localFile: %s Error: %v", filePath, statErr)
+	}
+	initOptions := storageutil.MetaOptions(storageutil.SSEOptions(map[string]string{"disposition": options["disposition"], "acl": options["acl"], "checksum": options["checksum"]}, options), options)
+	initOptions = storageutil.FileAttrOptions(initOptions, localStat, options)
+	//压缩上传
+	if encoding := storageutil.CompressEncoding(options, filePath); encoding != "" {
+		tmpFile, cErr := storageutil.CompressFile(encoding, filePath)
+		if cErr != nil {
+			return nil, fmt.Errorf(" UploadLargeFile Compress localFile: %s Error: %v", filePath, cErr)
+		}
+		defer os.Remove(tmpFile)
+		fd, openErr = os.Open(tmpFile)
+		if fd != nil {
+			defer fd.Close()
 		}
+		if openErr != nil {
+			return nil, fmt.Errorf(" UploadLargeFile Open tmpFile: %s Error: %v", tmpFile, openErr)
+		}
+		initOptions["content_encoding"] = encoding
+		initOptions[storageutil.UncompressedSizeMeta] = strconv.FormatInt(localStat.Size(), 10)
+	}
+	//保存整个文件的md5,下载时校验
+	if options["store_md5"] == "true" {
+		initOptions[storageutil.ContentMd5Meta] = hex.EncodeToString(storageutil.Md5ByteReader(fd))
 	}
+
 	var threadNum = c.threadMaxNum
 	if options["thread_num"] != "" {
 		n, err := strconv.Atoi(options["thread_num"])
@@ -60,90 +84,126 @@ func (c *Client) UploadLargeFile(filePath, bucket, object string, options map[st
 	}
 	fileStat, _ := fd.Stat()
 	fileSize := int(fileStat.Size())
-	var total = (fileSize + partSize - 1) / partSize
+	partSize, total, layoutErr := storageutil.PartLayout(fileSize, options, c.partMaxSize)
+	if layoutErr != nil {
+		return nil, fmt.Errorf(" UploadLargeFile Object: %s Error: %v", object, layoutErr)
+	}
+	progress := storageutil.NewProgress(listener, "UploadLargeFile", object, int64(fileSize), total)
+	//空文件不能分块上传
+	if total == 0 {
+		put, putErr := c.Put(bytes.NewReader(nil), 0, bucket, object, initOptions)
+		if putErr != nil {
+			return nil, putErr
+		}
+		put["PartSize"] = partSize
+		put["PartNum"] = total
+		return put, nil
+	}
 	if total < threadNum {
 		threadNum = total
 	}
-	//初化化上传
-	initUpload, initErr := c.InitUpload(bucket, object, map[string]string{"disposition": options["disposition"], "acl": options["acl"]})
-	if initErr != nil {
-		return nil, initErr
+	//断点续传
+	checkpoint := &storageutil.Checkpoint{Bucket: bucket, Object: object, Source: filePath, Size: int64(fileSize), ModTime: localStat.ModTime().UnixNano(), PartSize: partSize}
+	resumed := checkpoint.Load(storageutil.CheckpointFile(options, filePath+".ucp"))
+	if resumed {
+		var resumeErr error
+		if resumed, resumeErr = checkpoint.Resume(c); resumeErr != nil {
+			return nil, fmt.Errorf(" UploadLargeFile Object: %s%v", object, resumeErr)
+		}
 	}
-	var queueMaxSize = make(chan bool, threadNum)
-	defer close(queueMaxSize)
+	if !resumed {
+		//初化化上传
+		initUpload, initErr := c.InitUpload(bucket, object, initOptions)
+		if initErr != nil {
+			return nil, initErr
+		}
+		checkpoint.UploadID = initUpload.UploadID
+		checkpoint.Parts = nil
+		if saveErr := checkpoint.Save(); saveErr != nil {
+			return nil, fmt.Errorf(" UploadLargeFile Save checkpoint Error: %v", saveErr)
+		}
+	}
+	uploadID := checkpoint.UploadID
+	var queueMaxSize = storageutil.NewConcurrency(threadNum, c.control.Throttle)
 	var uploadPartList = make([]string, total)
-	var uploadExit bool
-	var partErr error
+	var uploadChecksumList = make([]string, total)
+	var partErr storageutil.PartError
 	var wg sync.WaitGroup
 	for partNum := 0; partNum < total; partNum++ {
-		if uploadExit {
+		if partErr.Err() != nil {
 			break
 		}
+		//跳过已上传的分块
+		if part, ok := checkpoint.Part(partNum + 1); ok {
+			uploadPartList[partNum] = part.ETag
+			uploadChecksumList[partNum] = part.Checksum
+			progress.Transferred(object, int64(storageutil.PartLength(fileSize, partSize, partNum)))
+			progress.Done(object, nil)
+			continue
+		}
 		wg.Add(1)
-		queueMaxSize <- true
+		queueMaxSize.Acquire()
 		go func(partNum int, fd *os.File) {
 			defer func() {
-				if partErr != nil {
-					uploadExit = true
-				}
 				wg.Done()
-				<-queueMaxSize
+				queueMaxSize.Release()
 			}()
 			offset := partNum * partSize
 			num := partSize
 			if fileSize-offset < num {
 				num = fileSize - offset
 			}
-			for i := 0; i < c.maxRetryNum; i++ {
-				partReader := io.NewSectionReader(fd, int64(offset), int64(num))
-				partReaderSize := int(partReader.Size())
-				uploadPart, upErr := c.UploadPart(partReader, partReaderSize, bucket, object, partNum+1, initUpload.UploadID)
-				if upErr != nil {
-					partErr = upErr
-					continue
-				}
-				partErr = nil
-				uploadPartList[partNum] = uploadPart["Etag"].(string)
-				break
-			}
-			if partErr != nil {
+			partReader := io.NewSectionReader(fd, int64(offset), int64(num))
+			partReaderSize := int(partReader.Size())
+			uploadPart, upErr := c.UploadPart(progress.Reader(object, partReader), partReaderSize, bucket, object, partNum+1, uploadID, options)
+			if upErr != nil {
+				progress.Done(object, upErr)
+				partErr.Set(upErr)
 				return
 			}
+			uploadPartList[partNum] = uploadPart["Etag"].(string)
+			uploadChecksumList[partNum] = storageutil.ChecksumPartXML(options, uploadPart)
+			_ = checkpoint.SetPart(partNum+1, uploadPartList[partNum], uploadChecksumList[partNum])
 			//进度条
-			if percentChan != nil {
-				percentChan <- total
-			}
+			progress.Done(object, nil)
 		}(partNum, fd)
 	}
 	wg.Wait()
-	if partErr != nil {
-		return nil, partErr
+	if err := partErr.Err(); err != nil {
+		return nil, err
 	}
 	//上传完成
 	completeUploadInfo := "<CompleteMultipartUpload>"
 	for partNum, Etag := range uploadPartList {
-		completeUploadInfo += fmt.Sprintf("<Part><PartNumber>%d</PartNumber><ETag>%s</ETag></Part>", partNum+1, Etag)
+		completeUploadInfo += fmt.Sprintf("<Part><PartNumber>%d</PartNumber><ETag>%s</ETag>%s</Part>", partNum+1, Etag, uploadChecksumList[partNum])
 	}
 	completeUploadInfo += "</CompleteMultipartUpload>"
-	return c.CompleteUpload([]byte(completeUploadInfo), bucket, object, initUpload.UploadID, fileSize)
+	completeUpload, completeErr := c.CompleteUpload([]byte(completeUploadInfo), bucket, object, uploadID, fileSize)
+	if completeErr != nil {
+		return nil, completeErr
+	}
+	checkpoint.Remove()
+	//校验分块上传的ETag,SSE-KMS和SSE-C(包括bucket默认加密)的ETag不是md5
+	if options["sse"] != "aws:kms" && options["sse_c_key"] == "" && !storageutil.EncryptedETag(completeUpload) {
+		expectETag, eErr := storageutil.MultipartETag(uploadPartList)
+		if eErr == nil && storageutil.TrimETag(completeUpload["ETag"].(string)) != expectETag {
+			return nil, fmt.Errorf(" UploadLargeFile Object: %s ETag: %s Error: not equal %s", object, completeUpload["ETag"], expectETag)
+		}
+	}
+	completeUpload["PartSize"] = partSize
+	completeUpload["PartNum"] = total
+	return completeUpload, nil
 }
 
 // CopyLargeFile 分块复制文件
-func (c *Client) CopyLargeFile(bucket, object, source string, options map[string]string, percentChan chan int, exitChan <-chan bool) (map[string]interface{}, error) {
+func (c *Client) CopyLargeFile(bucket, object, source string, options map[string]string, listener storagebase.ProgressListener, exitChan <-chan bool) (map[string]interface{}, error) {
 	tmpSourceInfo := strings.Split(source, "/")
 	sourceBucket := tmpSourceInfo[1]
 	sourceObject := strings.Join(tmpSourceInfo[2:], "/")
-	sourceHead, headErr := c.Head(sourceBucket, sourceObject)
+	sourceHead, headErr := c.Head(sourceBucket, sourceObject, storageutil.SourceSSEOptions(options))
 	if headErr != nil {
 		return nil, headErr
 	}
-	var partSize = c.partMaxSize
-	if options["part_size"] != "" {
-		n, err := strconv.Atoi(options["part_size"])
-		if err == nil && n <= c.partMaxSize && n >= c.partMinSize {
-			partSize = n
-		}
-	}
 	var threadNum = c.threadMaxNum
 	if options["thread_num"] != "" {
 		n, err := strconv.Atoi(options["thread_num"])
@@ -162,16 +222,54 @@ func (c *Client) CopyLargeFile(bucket, object, source string, options map[string
 	if l, ok := sourceHead["Content-Length"]; ok {
 		objectSize, _ = strconv.Atoi(l.(string))
 	}
-	var total = (objectSize + partSize - 1) / partSize
+	var sourceETag string
+	if e, ok := sourceHead["Etag"]; ok {
+		sourceETag = e.(string)
+	}
+	partSize, total, layoutErr := storageutil.PartLayout(objectSize, options, c.partMaxSize)
+	if layoutErr != nil {
+		return nil, fmt.Errorf(" CopyLargeFile Object: %s Error: %v", object, layoutErr)
+	}
+	progress := storageutil.NewProgress(listener, "CopyLargeFile", object, int64(objectSize), total)
+	//空文件不能分块复制
+	if total == 0 {
+		copyResult, copyErr := c.Copy(bucket, object, source, options)
+		if copyErr != nil {
+			return nil, copyErr
+		}
+		copyResult["PartSize"] = partSize
+		copyResult["PartNum"] = total
+		return copyResult, nil
+	}
 	if total < threadNum {
 		threadNum = total
 	}
 
-	//初化化上传
-	initUpload, initErr := c.InitUpload(bucket, object, map[string]string{"disposition": options["disposition"], "acl": options["acl"]})
-	if initErr != nil {
-		return nil, initErr
+	//断点续传
+	checkpoint := &storageutil.Checkpoint{Bucket: bucket, Object: object, Source: source, SourceETag: sourceETag, Size: int64(objectSize), PartSize: partSize}
+	resumed := checkpoint.Load(storageutil.CheckpointFile(options, storageutil.TempCheckpointFile(source, bucket, object)))
+	if resumed {
+		var resumeErr error
+		if resumed, resumeErr = checkpoint.Resume(c); resumeErr != nil {
+			return nil, fmt.Errorf(" CopyLargeFile Object: %s%v", object, resumeErr)
+		}
 	}
+	if !resumed {
+		//初化化上传
+		initOptions := storageutil.MetaOptions(storageutil.SSEOptions(storageutil.ContentOptions(map[string]string{"acl": options["acl"]}, options), options), options)
+		//分块复制不会复制源文件的元数据
+		initOptions = storageutil.SourceHeaderOptions(initOptions, sourceHead, options)
+		initUpload, initErr := c.InitUpload(bucket, object, initOptions)
+		if initErr != nil {
+			return nil, initErr
+		}
+		checkpoint.UploadID = initUpload.UploadID
+		checkpoint.Parts = nil
+		if saveErr := checkpoint.Save(); saveErr != nil {
+			return nil, fmt.Errorf(" CopyLargeFile Save checkpoint Error: %v", saveErr)
+		}
+	}
+	uploadID := checkpoint.UploadID
 	var copyPartList = make([]string, total)
 
 	//取消处理
@@ -192,58 +290,54 @@ func (c *Client) CopyLargeFile(bucket, object, source string, options map[string
 	}()
 
 	//copy分片
-	var queueMaxSize = make(chan bool, threadNum)
-	defer close(queueMaxSize)
-	var partErr error
-	var copyExit bool
+	var queueMaxSize = storageutil.NewConcurrency(threadNum, c.control.Throttle)
+	var partErr storageutil.PartError
 	var wg sync.WaitGroup
 	for partNum := 0; partNum < total; partNum++ {
-		if copyExit {
+		if partErr.Err() != nil {
 			break
 		}
+		//跳过已复制的分块
+		if part, ok := checkpoint.Part(partNum + 1); ok {
+			copyPartList[partNum] = part.ETag
+			progress.Transferred(object, int64(storageutil.PartLength(objectSize, partSize, partNum)))
+			progress.Done(object, nil)
+			continue
+		}
 		wg.Add(1)
-		queueMaxSize <- true
+		queueMaxSize.Acquire()
 		go func(partNum int) {
 			defer func() {
 				wg.Done()
-				if partErr != nil {
-					copyExit = true
-				}
 			}()
 			//part范围,如：0-1023
 			tmpStart := partNum * partSize
 			tmpEnd := (partNum+1)*partSize - 1
-			if tmpEnd > objectSize {
-				tmpEnd = tmpStart + objectSize%partSize - 1
+			if tmpEnd > objectSize-1 {
+				tmpEnd = objectSize - 1
 			}
 			partRange := fmt.Sprintf("bytes=%d-%d", tmpStart, tmpEnd)
-			for i := 0; i < c.maxRetryNum; i++ {
-				if copyCancel {
-					partErr = errors.New("canceled")
-					break
-				}
-				copyPart, copyErr := c.CopyPart(partRange, bucket, object, source, partNum+1, initUpload.UploadID, copyExitChan)
-				if copyErr != nil {
-					partErr = copyErr
-					continue
-				}
-				partErr = nil
-				copyPartList[partNum] = copyPart["Etag"]
-				break
+			if copyCancel {
+				partErr.Set(errors.New("canceled"))
+				return
 			}
-			if partErr != nil {
+			copyPart, copyErr := c.CopyPart(partRange, bucket, object, source, partNum+1, uploadID, options, copyExitChan)
+			if copyErr != nil {
+				progress.Done(object, copyErr)
+				partErr.Set(copyErr)
 				return
 			}
+			copyPartList[partNum] = copyPart["Etag"]
+			_ = checkpoint.SetPart(partNum+1, copyPartList[partNum], "")
 			//进度条
-			if percentChan != nil {
-				percentChan <- total
-			}
-			<-queueMaxSize
+			progress.Transferred(object, int64(tmpEnd-tmpStart+1))
+			progress.Done(object, nil)
+			queueMaxSize.Release()
 		}(partNum)
 	}
 	wg.Wait()
-	if partErr != nil {
-		return nil, partErr
+	if err := partErr.Err(); err != nil {
+		return nil, err
 	}
 	//copy完成
 	completeCopyInfo := "<CompleteMultipartUpload>"
@@ -251,7 +345,14 @@ func (c *Client) CopyLargeFile(bucket, object, source string, options map[string
 		completeCopyInfo += fmt.Sprintf("<Part><PartNumber>%d</PartNumber><ETag>%s</ETag></Part>", partNum+1, Etag)
 	}
 	completeCopyInfo += "</CompleteMultipartUpload>"
-	return c.CompleteUpload([]byte(completeCopyInfo), bucket, object, initUpload.UploadID, objectSize)
+	completeCopy, completeErr := c.CompleteUpload([]byte(completeCopyInfo), bucket, object, uploadID, objectSize)
+	if completeErr != nil {
+		return nil, completeErr
+	}
+	checkpoint.Remove()
+	completeCopy["PartSize"] = partSize
+	completeCopy["PartNum"] = total
+	return completeCopy, nil
 }
 
 func (c *Client) InitUpload(bucket, object string, options map[string]string) (*InitUploadResult, error) {
@@ -259,6 +360,9 @@ func (c *Client) InitUpload(bucket, object string, options map[string]string) (*
 	addr := fmt.Sprintf("http://%s.%s/%s%s", bucket, c.host, object, subObject)
 	method := "POST"
 	contentType := mime.TypeByExtension(path.Ext(object))
+	if options["content_type"] != "" {
+		contentType = options["content_type"]
+	}
 	date := time.Unix(time.Now().Unix()-8*3600, 0).Format(c.dateTimeGMT)
 	headers := map[string]string{
 		"Content-Type": contentType,
@@ -267,12 +371,21 @@ func (c *Client) InitUpload(bucket, object string, options map[string]string) (*
 	if options["acl"] != "" {
 		headers["x-amz-acl"] = options["acl"]
 	}
+	for k, v := range storageutil.SSEHeaders(options) {
+		headers[k] = v
+	}
+	for k, v := range storageutil.ChecksumAlgorithmHeaders(options) {
+		headers[k] = v
+	}
+	for k, v := range storageutil.MetaHeaders(options) {
+		headers[k] = v
+	}
 	LF := "\n"
 	headers["Authorization"] = c.sign(method+LF, headers, bucket, object+subObject)
-	if options["disposition"] != "" {
-		headers["Content-Disposition"] = fmt.Sprintf(`attachment; filename="%s"`, options["disposition"])
+	for k, v := range storageutil.ContentHeaders(options) {
+		headers[k] = v
 	}
-	resp, err := storageutil.CURL(addr, method, headers, bytes.NewBufferString(""))
+	resp, err := c.curl(addr, method, headers, bytes.NewBufferString(""))
 	if err != nil {
 		return nil, fmt.Errorf(" InitUpload Object: %s Error: %v", object, err)
 	}
@@ -291,28 +404,49 @@ func (c *Client) InitUpload(bucket, object string, options map[string]string) (*
 	return initUpload, nil
 }
 
-func (c *Client) UploadPart(body io.Reader, bodySize int, bucket, object string, partNumber int, uploadID string) (map[string]interface{}, error) {
+func (c *Client) UploadPart(body io.Reader, bodySize int, bucket, object string, partNumber int, uploadID string, options map[string]string) (map[string]interface{}, error) {
 	subObject := fmt.Sprintf("?partNumber=%d&uploadId=%s", partNumber, uploadID)
 	addr := fmt.Sprintf("http://%s.%s/%s%s", bucket, c.host, object, subObject)
 	method := "PUT"
 	contentType := mime.TypeByExtension(path.Ext(object))
+	contentMd5 := storageutil.Md5ByteReader(body)
 	date := time.Unix(time.Now().Unix()-8*3600, 0).Format(c.dateTimeGMT)
 	headers := map[string]string{
+		"Content-Md5":  storageutil.Base64Encode(contentMd5),
 		"Content-Type": contentType,
 		"Date":         date,
 	}
-	LF := "\n"
+	for k, v := range storageutil.SSECHeaders(options) {
+		headers[k] = v
+	}
+	for k, v := range storageutil.ChecksumHeaders(options, body) {
+		headers[k] = v
+	}
 	object += subObject
-	headers["Authorization"] = c.sign(method+LF, headers, bucket, object)
+	headers["Authorization"] = c.sign(method, headers, bucket, object)
 	headers["Content-Length"] = fmt.Sprintf("%d", bodySize)
-	resp, err := storageutil.CURL(addr, method, headers, body)
+	//分块ETag与md5不一致时按重试策略重新上传
+	var resp map[string]interface{}
+	err := storageutil.RetryOperation(c.control.RetryPolicy, func() error {
+		_, _ = body.(io.Seeker).Seek(0, io.SeekStart)
+		var cErr error
+		resp, cErr = c.curl(addr, method, headers, body)
+		if cErr != nil {
+			return fmt.Errorf(" UploadPart Object: %s Error: %v", object, cErr)
+		}
+		status := resp["StatusCode"].(int)
+		reqID := resp["X-Amz-Request-Id"].(string)
+		if status != 200 {
+			return fmt.Errorf(" UploadPart Object: %s StatusCode: %d X-Amz-Request-Id: %s", object, status, reqID)
+		}
+		//校验分块ETag
+		if etag, ok := resp["Etag"].(string); ok && storageutil.ETagIsMD5(resp) && storageutil.TrimETag(etag) != hex.EncodeToString(contentMd5) {
+			return storageutil.Retryable(fmt.Errorf(" UploadPart Object: %s ETag: %s Error: md5 mismatch", object, etag))
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf(" UploadPart Object: %s Error: %v", object, err)
-	}
-	status := resp["StatusCode"].(int)
-	reqID := resp["X-Amz-Request-Id"].(string)
-	if status != 200 {
-		return nil, fmt.Errorf(" UploadPart Object: %s StatusCode: %d X-Amz-Request-Id: %s", object, status, reqID)
+		return nil, err
 	}
 	return resp, nil
 }
@@ -330,7 +464,7 @@ func (c *Client) CancelPart(bucket, object string, uploadID string) (map[string]
 	LF := "\n"
 	object += subObject
 	headers["Authorization"] = c.sign(method+LF, headers, bucket, object)
-	resp, err := storageutil.CURL(addr, method, headers, bytes.NewBufferString(""))
+	resp, err := c.curl(addr, method, headers, bytes.NewBufferString(""))
 	if err != nil {
 		return nil, fmt.Errorf(" CancelPart Object: %s Error: %v", object, err)
 	}
@@ -342,20 +476,63 @@ func (c *Client) CancelPart(bucket, object string, uploadID string) (map[string]
 	return resp, nil
 }
 
-func (c *Client) CopyPart(partRange, bucket, object, source string, partNumber int, uploadID string, copyExitChan <-chan bool) (map[string]string, error) {
+// ListUploadedParts 查看某个uploadID已上传的分块
+func (c *Client) ListUploadedParts(bucket, object, uploadID string, options map[string]string) (*ListUploadedPartsResult, error) {
+	param := ""
+	if options["max-parts"] != "" {
+		param += "&max-parts=" + options["max-parts"]
+	}
+	if options["part-number-marker"] != "" {
+		param += "&part-number-marker=" + options["part-number-marker"]
+	}
+	subObject := fmt.Sprintf("?uploadId=%s", uploadID)
+	addr := fmt.Sprintf("http://%s.%s/%s%s%s", bucket, c.host, object, subObject, param)
+	method := "GET"
+	date := time.Unix(time.Now().Unix()-8*3600, 0).Format(c.dateTimeGMT)
+	headers := map[string]string{
+		"Date": date,
+	}
+	LF := "\n"
+	headers["Authorization"] = c.sign(method+LF+LF, headers, bucket, object+subObject)
+	resp, err := c.curl(addr, method, headers, bytes.NewBufferString(""))
+	if err != nil {
+		return nil, fmt.Errorf(" ListUploadedParts Object: %s Error: %v", object, err)
+	}
+	status := resp["StatusCode"].(int)
+	reqID := resp["X-Amz-Request-Id"].(string)
+	if status != 200 {
+		return nil, fmt.Errorf(" ListUploadedParts Object: %s StatusCode: %d X-Amz-Request-Id: %s", object, status, reqID)
+	}
+	if _, ok := resp["Body"]; !ok {
+		return nil, fmt.Errorf(" ListUploadedParts Object: %s Error: respond body is nil", object)
+	}
+	var listParts = &ListUploadedPartsResult{}
+	if err := xml.Unmarshal(resp["Body"].(*bytes.Buffer).Bytes(), listParts); err != nil {
+		return nil, fmt.Errorf(" ListUploadedParts Object: %s Error: %v", object, err)
+	}
+	return listParts, nil
+}
+
+func (c *Client) CopyPart(partRange, bucket, object, source string, partNumber int, uploadID string, options map[string]string, copyExitChan <-chan bool) (map[string]string, error) {
 	subObject := fmt.Sprintf("?partNumber=%d&uploadId=%s", partNumber, uploadID)
 	addr := fmt.Sprintf("http://%s.%s/%s%s", bucket, c.host, object, subObject)
 	method := "PUT"
 	date := time.Unix(time.Now().Unix()-8*3600, 0).Format(c.dateTimeGMT)
 	headers := map[string]string{
 		"Date":                    date,
-		"x-amz-copy-source":       source,
+		"x-amz-copy-source":       storageutil.CopySource(source, options),
 		"x-amz-copy-source-range": partRange,
 	}
+	for k, v := range storageutil.SSECHeaders(options) {
+		headers[k] = v
+	}
+	for k, v := range storageutil.CopySourceSSECHeaders(options) {
+		headers[k] = v
+	}
 	LF := "\n"
 	object += subObject
 	headers["Authorization"] = c.sign(method+LF+LF, headers, bucket, object)
-	resp, err := storageutil.CURL2Reader(addr, method, headers, strings.NewReader(""), copyExitChan)
+	resp, err := storageutil.CURLWithRetry(c.control, bucket, addr, method, headers, strings.NewReader(""), copyExitChan)
 	if err != nil {
 		return nil, fmt.Errorf(" CopyPart Object: %s Error: %v", object, err)
 	}
@@ -390,7 +567,7 @@ func (c *Client) CompleteUpload(body []byte, bucket, object, uploadID string, ob
 
 	headers["Authorization"] = c.sign(method, headers, bucket, object+subObject)
 	headers["Content-Length"] = contentLength
-	resp, err := storageutil.CURL(addr, method, headers, bytes.NewReader(body))
+	resp, err := c.curl(addr, method, headers, bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf(" CompleteUpload Object: %s Error: %v", object, err)
 	}
@@ -406,11 +583,18 @@ func (c *Client) CompleteUpload(body []byte, bucket, object, uploadID string, ob
 	if err := xml.Unmarshal(resp["Body"].(*bytes.Buffer).Bytes(), completeUpload); err != nil {
 		return nil, fmt.Errorf(" CompleteUpload Object: %s Error: %v", object, err)
 	}
-	return map[string]interface{}{
+	result := map[string]interface{}{
 		"Location": fmt.Sprintf("http://%s.%s/%s", bucket, c.host, object),
 		"Bucket":   completeUpload.Bucket,
 		"Key":      completeUpload.Key,
 		"ETag":     completeUpload.ETag,
 		"Size":     objectSize,
-	}, nil
+	}
+	//服务端加密方式,用于判断ETag是否可以校验
+	for _, k := range []string{"X-Amz-Server-Side-Encryption", "X-Amz-Server-Side-Encryption-Customer-Algorithm"} {
+		if v, ok := resp[k]; ok {
+			result[k] = v
+		}
+	}
+	return result, nil
 }
@@ -2,10 +2,12 @@ package s3v2
 
 import (
 	"bytes"
+	"encoding/hex"
 	"encoding/xml"
 	"fmt"
 	"io"
 	"mime"
+	"net/url"
 	"os"
 	"path"
 	"strconv"
@@ -30,6 +32,15 @@ type ListObjectPrefixes = storagebase.ListObjectPrefixes
 // ListObjectContents 列表内容
 type ListObjectContents = storagebase.ListObjectContents
 
+// DeleteResult 批量删除结果
+type DeleteResult = storagebase.DeleteResult
+
+// ObjectIdentifier 批量删除的object
+type ObjectIdentifier = storagebase.ObjectIdentifier
+
+// DeleteObjectResult 批量删除中每个object的结果
+type DeleteObjectResult = storagebase.DeleteObjectResult
+
 // UploadFile 上传文件根据路径
 func (c *Client) UploadFile(filePath, bucket, object string, options map[string]string) (map[string]interface{}, error) {
 	fd, err := os.Open(filePath)
@@ -50,7 +61,61 @@ func (c *Client) UploadFile(filePath, bucket, object string, options map[string]
 	if strings.TrimSuffix(object, "/") == path.Dir(object) {
 		object = path.Dir(object) + "/" + path.Base(filePath)
 	}
-	return c.Put(fd, bodySize, bucket, object, map[string]string{"disposition": options["disposition"], "acl": options["acl"]})
+	putOptions := storageutil.MetaOptions(storageutil.SSEOptions(map[string]string{"disposition": options["disposition"], "acl": options["acl"], "checksum": options["checksum"]}, options), options)
+	return c.Put(fd, bodySize, bucket, object, storageutil.FileAttrOptions(putOptions, stat, options))
+}
+
+// Upload 上传文件,大小超过分块阈值时自动分块上传
+func (c *Client) Upload(filePath, bucket, object string, options map[string]string, listener storagebase.ProgressListener) (map[string]interface{}, error) {
+	localStat, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf(" Upload Stat localFile: %s Error: %v", filePath, err)
+	}
+	if localStat.Size() >= storageutil.MultipartThreshold(options, c.multipartThreshold) {
+		return c.UploadLargeFile(filePath, bucket, object, options, listener)
+	}
+	if object == "" {
+		object = path.Base(filePath)
+	}
+	if strings.TrimSuffix(object, "/") == path.Dir(object) {
+		object = path.Dir(object) + "/" + path.Base(filePath)
+	}
+	uploadFile := filePath
+	putOptions := storageutil.MetaOptions(storageutil.SSEOptions(map[string]string{"disposition": options["disposition"], "acl": options["acl"], "checksum": options["checksum"]}, options), options)
+	putOptions = storageutil.FileAttrOptions(putOptions, localStat, options)
+	//压缩上传
+	if encoding := storageutil.CompressEncoding(options, filePath); encoding != "" {
+		tmpFile, cErr := storageutil.CompressFile(encoding, filePath)
+		if cErr != nil {
+			return nil, fmt.Errorf(" Upload Compress localFile: %s Error: %v", filePath, cErr)
+		}
+		defer os.Remove(tmpFile)
+		uploadFile = tmpFile
+		putOptions["content_encoding"] = encoding
+		putOptions[storageutil.UncompressedSizeMeta] = strconv.FormatInt(localStat.Size(), 10)
+	}
+	fd, err := os.Open(uploadFile)
+	if fd != nil {
+		defer fd.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf(" Upload Open localFile: %s Error: %v", uploadFile, err)
+	}
+	stat, err := fd.Stat()
+	if err != nil {
+		return nil, fmt.Errorf(" Upload Stat localFile: %s Error: %v", uploadFile, err)
+	}
+	//保存整个文件的md5,下载时校验
+	if options["store_md5"] == "true" {
+		putOptions[storageutil.ContentMd5Meta] = hex.EncodeToString(storageutil.Md5ByteReader(fd))
+	}
+	progress := storageutil.NewProgress(listener, "Upload", object, stat.Size(), 1)
+	result, err := c.Put(progress.Reader(object, fd), int(stat.Size()), bucket, object, putOptions)
+	progress.Done(object, err)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
 // Put 上传文件根据内容
@@ -58,6 +123,9 @@ func (c *Client) Put(body io.Reader, bodySize int, bucket, object string, option
 	addr := fmt.Sprintf("http://%s.%s/%s", bucket, c.host, object)
 	method := "PUT"
 	contentType := mime.TypeByExtension(path.Ext(object))
+	if options["content_type"] != "" {
+		contentType = options["content_type"]
+	}
 	contentMd5 := storageutil.Base64Encode(storageutil.Md5ByteReader(body))
 	date := time.Unix(time.Now().Unix()-8*3600, 0).Format(c.dateTimeGMT)
 	headers := map[string]string{
@@ -68,12 +136,21 @@ func (c *Client) Put(body io.Reader, bodySize int, bucket, object string, option
 	if options["acl"] != "" {
 		headers["x-amz-acl"] = options["acl"]
 	}
+	for k, v := range storageutil.SSEHeaders(options) {
+		headers[k] = v
+	}
+	for k, v := range storageutil.ChecksumHeaders(options, body) {
+		headers[k] = v
+	}
+	for k, v := range storageutil.MetaHeaders(options) {
+		headers[k] = v
+	}
 	headers["Authorization"] = c.sign(method, headers, bucket, object)
 	headers["Content-Length"] = fmt.Sprintf("%d", bodySize)
-	if options["disposition"] != "" {
-		headers["Content-Disposition"] = fmt.Sprintf(`attachment; filename="%s"`, options["disposition"])
+	for k, v := range storageutil.ContentHeaders(options) {
+		headers[k] = v
 	}
-	resp, err := storageutil.CURL(addr, method, headers, body)
+	resp, err := c.curl(addr, method, headers, body)
 	if err != nil {
 		return nil, fmt.Errorf(" Put Object: %s Error: %v", object, err)
 	}
@@ -99,7 +176,7 @@ func (c *Client) Copy(bucket, object, source string, options map[string]string)
 	tmpSourceInfo := strings.Split(source, "/")
 	sourceBucket := tmpSourceInfo[1]
 	sourceObject := strings.Join(tmpSourceInfo[2:], "/")
-	sourceHead, err := c.Head(sourceBucket, sourceObject)
+	sourceHead, err := c.Head(sourceBucket, sourceObject, storageutil.SourceSSEOptions(options))
 	if err != nil {
 		return nil, err
 	}
@@ -111,17 +188,42 @@ func (c *Client) Copy(bucket, object, source string, options map[string]string)
 	date := time.Unix(time.Now().Unix()-8*3600, 0).Format(c.dateTimeGMT)
 	headers := map[string]string{
 		"Date":              date,
-		"x-amz-copy-source": source,
+		"x-amz-copy-source": storageutil.CopySource(source, options),
 	}
 	if options["acl"] != "" {
 		headers["x-amz-acl"] = options["acl"]
 	}
+	for k, v := range storageutil.SSEHeaders(options) {
+		headers[k] = v
+	}
+	for k, v := range storageutil.CopySourceSSECHeaders(options) {
+		headers[k] = v
+	}
+	//REPLACE时使用options中的自定义元数据
+	if options["metadata_directive"] != "" {
+		headers["x-amz-metadata-directive"] = options["metadata_directive"]
+		for k, v := range storageutil.MetaHeaders(options) {
+			headers[k] = v
+		}
+	}
 	LF := "\n"
-	headers["Authorization"] = c.sign(method+LF+LF, headers, bucket, object)
+	contentHeaders := storageutil.ContentHeaders(options)
+	//REPLACE时不保留源文件的内容header,Content-Type参与签名
+	if options["metadata_directive"] != "" && contentHeaders["Content-Type"] != "" {
+		headers["Content-Type"] = contentHeaders["Content-Type"]
+		headers["Authorization"] = c.sign(method+LF, headers, bucket, object)
+	} else {
+		headers["Authorization"] = c.sign(method+LF+LF, headers, bucket, object)
+	}
+	if options["metadata_directive"] != "" {
+		for k, v := range contentHeaders {
+			headers[k] = v
+		}
+	}
 	if options["disposition"] != "" {
 		headers["response-content-disposition"] = fmt.Sprintf(`attachment; filename="%s"`, options["disposition"])
 	}
-	resp, err := storageutil.CURL(addr, method, headers, bytes.NewBufferString(""))
+	resp, err := c.curl(addr, method, headers, bytes.NewBufferString(""))
 	if err != nil {
 		return nil, fmt.Errorf(" Copy Object: %s Error: %v", object, err)
 	}
@@ -152,6 +254,31 @@ func (c *Client) Copy(bucket, object, source string, options map[string]string)
 	}, nil
 }
 
+// CopyObject 复制文件,大小超过分块阈值时自动分块复制
+func (c *Client) CopyObject(bucket, object, source string, options map[string]string, listener storagebase.ProgressListener) (map[string]interface{}, error) {
+	tmpSourceInfo := strings.Split(source, "/")
+	sourceBucket := tmpSourceInfo[1]
+	sourceObject := strings.Join(tmpSourceInfo[2:], "/")
+	sourceHead, err := c.Head(sourceBucket, sourceObject, storageutil.SourceSSEOptions(options))
+	if err != nil {
+		return nil, err
+	}
+	size := storageutil.HeadSize(sourceHead, false)
+	if size >= storageutil.MultipartThreshold(options, c.multipartThreshold) {
+		return c.CopyLargeFile(bucket, object, source, options, listener, nil)
+	}
+	progress := storageutil.NewProgress(listener, "CopyObject", object, size, 1)
+	result, err := c.Copy(bucket, object, source, options)
+	if err == nil {
+		progress.Transferred(object, size)
+	}
+	progress.Done(object, err)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // Delete 删除文件
 func (c *Client) Delete(bucket, object string) (map[string]interface{}, error) {
 	addr := fmt.Sprintf("http://%s.%s/%s", bucket, c.host, object)
@@ -162,7 +289,7 @@ func (c *Client) Delete(bucket, object string) (map[string]interface{}, error) {
 	}
 	LF := "\n"
 	headers["Authorization"] = c.sign(method+LF+LF, headers, bucket, object)
-	resp, err := storageutil.CURL(addr, method, headers, bytes.NewBufferString(""))
+	resp, err := c.curl(addr, method, headers, bytes.NewBufferString(""))
 	if err != nil {
 		return nil, fmt.Errorf(" Delete Object: %s Error: %v", object, err)
 	}
@@ -174,17 +301,174 @@ func (c *Client) Delete(bucket, object string) (map[string]interface{}, error) {
 	return resp, nil
 }
 
+// PutObjectTagging 设置object的标签,替换已有的标签
+func (c *Client) PutObjectTagging(bucket, object string, tags map[string]string) (map[string]interface{}, error) {
+	body := storageutil.TaggingBody(tags)
+	subObject := "?tagging"
+	addr := fmt.Sprintf("http://%s.%s/%s%s", bucket, c.host, object, subObject)
+	method := "PUT"
+	date := time.Unix(time.Now().Unix()-8*3600, 0).Format(c.dateTimeGMT)
+	contentLength := strconv.Itoa(len(body))
+	contentMd5 := storageutil.Base64Encode(storageutil.Md5Byte([]byte(body)))
+	headers := map[string]string{
+		"Content-Md5": contentMd5 + "\n",
+		"Date":        date,
+	}
+	headers["Authorization"] = c.sign(method, headers, bucket, object+subObject)
+	headers["Content-Length"] = contentLength
+	headers["Content-Md5"] = strings.TrimSuffix(headers["Content-Md5"], "\n")
+	resp, err := c.curl(addr, method, headers, bytes.NewBufferString(body))
+	if err != nil {
+		return nil, fmt.Errorf(" PutObjectTagging Object: %s Error: %v", object, err)
+	}
+	status := resp["StatusCode"].(int)
+	reqID := resp["X-Amz-Request-Id"].(string)
+	if status != 200 {
+		return nil, fmt.Errorf(" PutObjectTagging Object: %s StatusCode: %d X-Amz-Request-Id: %s", object, status, reqID)
+	}
+	return resp, nil
+}
+
+// RestoreObject 取回归档的object,days为取回后保留的天数,options["restore_tier"]为取回方式Standard,Bulk或Expedited
+// 已经取回过时返回200,开始取回时返回202
+func (c *Client) RestoreObject(bucket, object string, days int, options map[string]string) (map[string]interface{}, error) {
+	body := storageutil.RestoreBody(days, options["restore_tier"])
+	subObject := "?restore"
+	addr := fmt.Sprintf("http://%s.%s/%s%s", bucket, c.host, object, subObject)
+	method := "POST"
+	date := time.Unix(time.Now().Unix()-8*3600, 0).Format(c.dateTimeGMT)
+	contentLength := strconv.Itoa(len(body))
+	contentMd5 := storageutil.Base64Encode(storageutil.Md5Byte([]byte(body)))
+	headers := map[string]string{
+		"Content-Md5": contentMd5 + "\n",
+		"Date":        date,
+	}
+	headers["Authorization"] = c.sign(method, headers, bucket, object+subObject)
+	headers["Content-Length"] = contentLength
+	headers["Content-Md5"] = strings.TrimSuffix(headers["Content-Md5"], "\n")
+	resp, err := c.curl(addr, method, headers, bytes.NewBufferString(body))
+	if err != nil {
+		return nil, fmt.Errorf(" RestoreObject Object: %s Error: %v", object, err)
+	}
+	status := resp["StatusCode"].(int)
+	reqID := resp["X-Amz-Request-Id"].(string)
+	if status != 200 && status != 202 {
+		return nil, fmt.Errorf(" RestoreObject Object: %s StatusCode: %d X-Amz-Request-Id: %s", object, status, reqID)
+	}
+	return resp, nil
+}
+
+// deleteBatch 一次请求批量删除object,最多DeleteMaxKeys个,返回失败的object
+func (c *Client) deleteBatch(bucket string, objects []ObjectIdentifier) (*DeleteResult, error) {
+	body := storageutil.DeleteBody(objects)
+	object := "?delete"
+	addr := fmt.Sprintf("http://%s.%s/%s", bucket, c.host, object)
+	method := "POST"
+	date := time.Unix(time.Now().Unix()-8*3600, 0).Format(c.dateTimeGMT)
+	contentLength := strconv.Itoa(len(body))
+	contentMd5 := storageutil.Base64Encode(storageutil.Md5Byte([]byte(body)))
+	headers := map[string]string{
+		"Content-Md5": contentMd5 + "\n",
+		"Date":        date,
+	}
+	headers["Authorization"] = c.sign(method, headers, bucket, object)
+	headers["Content-Length"] = contentLength
+	headers["Content-Md5"] = strings.TrimSuffix(headers["Content-Md5"], "\n")
+	resp, err := c.curl(addr, method, headers, bytes.NewBufferString(body))
+	if err != nil {
+		return nil, fmt.Errorf(" DeleteBatch Bucket: %s Error: %v", bucket, err)
+	}
+	status := resp["StatusCode"].(int)
+	reqID := resp["X-Amz-Request-Id"].(string)
+	if status != 200 {
+		return nil, fmt.Errorf(" DeleteBatch Bucket: %s StatusCode: %d X-Amz-Request-Id: %s", bucket, status, reqID)
+	}
+	var result = &DeleteResult{}
+	if b, ok := resp["Body"].(*bytes.Buffer); ok && b.Len() > 0 {
+		if err := xml.Unmarshal(b.Bytes(), result); err != nil {
+			return nil, fmt.Errorf(" DeleteBatch Bucket: %s Error: %v", bucket, err)
+		}
+	}
+	return result, nil
+}
+
+// DeleteObjects 批量删除指定的object,每DeleteMaxKeys个一个请求并发执行
+// 返回每个object的结果,顺序与objects相同,有失败时同时返回*storagebase.BulkError
+func (c *Client) DeleteObjects(bucket string, objects []ObjectIdentifier, options map[string]string, listener storagebase.ProgressListener) ([]DeleteObjectResult, error) {
+	var threadNum = c.threadMaxNum
+	if options["thread_num"] != "" {
+		n, err := strconv.Atoi(options["thread_num"])
+		if err == nil && n <= c.threadMaxNum && n >= c.threadMinNum {
+			threadNum = n
+		}
+	}
+	results := make([]DeleteObjectResult, len(objects))
+	progress := storageutil.NewProgress(listener, "DeleteObjects", bucket, 0, len(objects))
+	var queueMaxSize = storageutil.NewConcurrency(threadNum, c.control.Throttle)
+	var wg sync.WaitGroup
+	for start := 0; start < len(objects); start += storageutil.DeleteMaxKeys {
+		end := start + storageutil.DeleteMaxKeys
+		if end > len(objects) {
+			end = len(objects)
+		}
+		wg.Add(1)
+		queueMaxSize.Acquire()
+		go func(start, end int) {
+			defer func() {
+				wg.Done()
+				queueMaxSize.Release()
+			}()
+			batch := objects[start:end]
+			result, dErr := c.deleteBatch(bucket, batch)
+			keyErrs := storageutil.DeleteErrors(result)
+			for i, v := range batch {
+				keyErr := dErr
+				if e, ok := keyErrs[v]; ok {
+					keyErr = fmt.Errorf(" DeleteObjects Object: %s %v", v.Key, e)
+				}
+				results[start+i] = DeleteObjectResult{Key: v.Key, VersionID: v.VersionID, Err: keyErr}
+				progress.Action(v.Key, "delete", "", 0, keyErr)
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	return results, storageutil.DeleteFailures("DeleteObjects", results)
+}
+
+// RunManifest 按清单批量执行copy,delete,tag,restore或metadata,参数见storageutil.RunManifest
+func (c *Client) RunManifest(manifestFile string, options map[string]string, listener storagebase.ProgressListener) (map[string]int, error) {
+	var threadNum = c.threadMaxNum
+	if options["thread_num"] != "" {
+		n, err := strconv.Atoi(options["thread_num"])
+		if err == nil && n <= c.threadMaxNum && n >= c.threadMinNum {
+			threadNum = n
+		}
+	}
+	return storageutil.RunManifest(c, manifestFile, options, listener, threadNum, c.control.Throttle)
+}
+
 // Head 查看文件信息
-func (c *Client) Head(bucket, object string) (map[string]interface{}, error) {
+func (c *Client) Head(bucket, object string, options map[string]string) (map[string]interface{}, error) {
 	addr := fmt.Sprintf("http://%s.%s/%s", bucket, c.host, object)
+	//options["version_id"]不为空时查看指定版本
+	var subObject string
+	if options["version_id"] != "" {
+		subObject = "?versionId=" + options["version_id"]
+		addr += "?versionId=" + url.QueryEscape(options["version_id"])
+	}
 	method := "HEAD"
 	date := time.Unix(time.Now().Unix()-8*3600, 0).Format(c.dateTimeGMT)
 	headers := map[string]string{
 		"Date": date,
 	}
+	for k, v := range storageutil.SSECHeaders(options) {
+		headers[k] = v
+	}
+	//返回x-amz-checksum-*用于下载校验
+	headers["x-amz-checksum-mode"] = "ENABLED"
 	LF := "\n"
-	headers["Authorization"] = c.sign(method+LF+LF, headers, bucket, object)
-	resp, err := storageutil.Header(addr, method, headers)
+	headers["Authorization"] = c.sign(method+LF+LF, headers, bucket, object+subObject)
+	resp, err := storageutil.HeaderWithRetry(c.control, bucket, addr, method, headers)
 	if err != nil {
 		return nil, fmt.Errorf(" Head Object: %s Error: %v", object, err)
 	}
@@ -196,9 +480,23 @@ func (c *Client) Head(bucket, object string) (map[string]interface{}, error) {
 	return resp, nil
 }
 
-// Get 下载文件到本地
-func (c *Client) Get(bucket, object, localFile string, options map[string]string, percentChan chan int) (map[string]string, error) {
-	objectHead, headErr := c.Head(bucket, object)
+// Get 下载文件到本地,下载过程中object被修改(ETag变化)时按重试策略重新下载
+func (c *Client) Get(bucket, object, localFile string, options map[string]string, listener storagebase.ProgressListener) (map[string]string, error) {
+	var result map[string]string
+	err := storageutil.RetryOperation(c.control.RetryPolicy, func() error {
+		var gErr error
+		result, gErr = c.get(bucket, object, localFile, options, listener)
+		return gErr
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// get 下载一次,ETag变化时返回Retryable的错误
+func (c *Client) get(bucket, object, localFile string, options map[string]string, listener storagebase.ProgressListener) (map[string]string, error) {
+	objectHead, headErr := c.Head(bucket, object, options)
 	if headErr != nil {
 		return nil, headErr
 	}
@@ -210,6 +508,13 @@ func (c *Client) Get(bucket, object, localFile string, options map[string]string
 	if strings.TrimSuffix(localFile, "/") == path.Dir(localFile) {
 		localFile = path.Dir(localFile) + "/" + path.Base(object)
 	}
+	//symlinks为preserve时符号链接标记object恢复为符号链接,链接目标不能超出local_dir
+	if target, ok := storageutil.HeadMeta(objectHead)[storageutil.SymlinkMeta]; ok && options["symlinks"] == "preserve" {
+		if lErr := storageutil.CreateSymlink(localFile, target, options["local_dir"]); lErr != nil {
+			return nil, fmt.Errorf(" Get Symlink localFile: %s Error: %v", localFile, lErr)
+		}
+		return map[string]string{"Object": object, "Localfile": localFile}, nil
+	}
 	var partSize = c.partMinSize
 	if options["part_size"] != "" {
 		n, err := strconv.Atoi(options["part_size"])
@@ -225,83 +530,143 @@ func (c *Client) Get(bucket, object, localFile string, options map[string]string
 		}
 	}
 
+	var objectETag string
+	if e, ok := objectHead["Etag"]; ok {
+		objectETag = e.(string)
+	}
+
 	//创建local文件
 	var localDir = path.Dir(localFile)
 	err := os.MkdirAll(localDir, 0755)
 	if err != nil {
 		return nil, fmt.Errorf(" Get MkdirAll LocalDir: %s Error: %v", localDir, err)
 	}
-	fd, oErr := os.OpenFile(localFile, os.O_CREATE|os.O_WRONLY, 0755)
+	//断点续传,先下载到临时文件,完成后再重命名
+	tmpFile := localFile + ".download"
+	checkpoint := &storageutil.Checkpoint{Bucket: bucket, Object: object, Source: localFile, SourceETag: objectETag, Size: int64(objectSize), PartSize: partSize}
+	resumed := checkpoint.Load(localFile + ".dcp")
+	if tmpStat, sErr := os.Stat(tmpFile); sErr != nil || tmpStat.Size() != int64(objectSize) {
+		resumed = false
+	}
+	if !resumed {
+		//远程文件已变化或没有断点,重新下载
+		checkpoint.Parts = nil
+		_ = os.Remove(tmpFile)
+	}
+	fd, oErr := os.OpenFile(tmpFile, os.O_CREATE|os.O_WRONLY, 0644)
 	if fd != nil {
 		defer fd.Close()
 	}
 	if oErr != nil {
-		return nil, fmt.Errorf(" Get OpenFile localFile: %s Error: %v", localFile, oErr)
+		return nil, fmt.Errorf(" Get OpenFile tmpFile: %s Error: %v", tmpFile, oErr)
+	}
+	if tErr := fd.Truncate(int64(objectSize)); tErr != nil {
+		return nil, fmt.Errorf(" Get Truncate tmpFile: %s Error: %v", tmpFile, tErr)
+	}
+	if sErr := checkpoint.Save(); sErr != nil {
+		return nil, fmt.Errorf(" Get Save checkpoint Error: %v", sErr)
 	}
 
 	var total = (objectSize + partSize - 1) / partSize
-	var queueMaxSize = make(chan bool, threadNum)
-	defer close(queueMaxSize)
-	var partErr error
-	var partExit bool
+	progress := storageutil.NewProgress(listener, "Get", object, int64(objectSize), total)
+	var queueMaxSize = storageutil.NewConcurrency(threadNum, c.control.Throttle)
+	var partErr storageutil.PartError
 	var wg sync.WaitGroup
 	for partNum := 0; partNum < total; partNum++ {
-		if partExit {
+		if partErr.Err() != nil {
 			break
 		}
+		//跳过已下载的分片
+		if _, ok := checkpoint.Part(partNum + 1); ok {
+			progress.Transferred(object, int64(storageutil.PartLength(objectSize, partSize, partNum)))
+			progress.Done(object, nil)
+			continue
+		}
 		wg.Add(1)
-		queueMaxSize <- true
+		queueMaxSize.Acquire()
 		go func(partNum int) {
 			defer func() {
-				if partErr != nil {
-					partExit = true
-				}
 				wg.Done()
-				<-queueMaxSize
+				queueMaxSize.Release()
 			}()
 			//part范围,如：0-1023
 			tmpStart := partNum * partSize
 			tmpEnd := (partNum+1)*partSize - 1
-			if tmpEnd > objectSize {
-				tmpEnd = tmpStart + objectSize%partSize - 1
+			if tmpEnd > objectSize-1 {
+				tmpEnd = objectSize - 1
 			}
 			partRange := fmt.Sprintf("bytes=%d-%d", tmpStart, tmpEnd)
-			for i := 0; i < c.maxRetryNum; i++ {
-				cat, cErr := c.Cat(bucket, object, partRange)
-				if cErr != nil {
-					partErr = cErr
-					continue
-				}
-				_, _ = fd.Seek(int64(tmpStart), 0)
-				_, cErr = io.Copy(fd, cat["Body"].(*bytes.Buffer))
-				if cErr != nil {
-					partErr = cErr
-					continue
-				}
-				partErr = nil
-				break
+			cat, cErr := c.Cat(bucket, object, options, partRange)
+			if cErr != nil {
+				progress.Done(object, cErr)
+				partErr.Set(cErr)
+				return
 			}
-			if partErr != nil {
+			if e, ok := cat["Etag"]; ok && objectETag != "" && e.(string) != objectETag {
+				etagErr := storageutil.Retryable(fmt.Errorf(" Get Object: %s Error: ETag changed from %s to %s", object, objectETag, e.(string)))
+				progress.Done(object, etagErr)
+				partErr.Set(etagErr)
 				return
 			}
-			percentChan <- total
+			partBody := cat["Body"].(*bytes.Buffer).Bytes()
+			//写本地文件失败时按重试策略重试
+			cErr = storageutil.RetryOperation(c.control.RetryPolicy, func() error {
+				_, wErr := fd.WriteAt(partBody, int64(tmpStart))
+				return storageutil.Retryable(wErr)
+			})
+			if cErr != nil {
+				progress.Done(object, cErr)
+				partErr.Set(cErr)
+				return
+			}
+			_ = checkpoint.SetPart(partNum+1, objectETag, "")
+			progress.Transferred(object, int64(len(partBody)))
+			progress.Done(object, nil)
 		}(partNum)
 	}
 	wg.Wait()
-	if partErr != nil {
-		return nil, partErr
+	if err := partErr.Err(); err != nil {
+		return nil, err
+	}
+	_ = fd.Close()
+	//校验下载内容
+	if options["verify"] != "false" {
+		if vErr := storageutil.VerifyFile(tmpFile, objectHead); vErr != nil {
+			checkpoint.Remove()
+			_ = os.Remove(tmpFile)
+			return nil, fmt.Errorf(" Get Verify localFile: %s Error: %v", localFile, vErr)
+		}
+	}
+	if rErr := os.Rename(tmpFile, localFile); rErr != nil {
+		return nil, fmt.Errorf(" Get Rename localFile: %s Error: %v", localFile, rErr)
+	}
+	checkpoint.Remove()
+	//自动解压
+	if encoding, ok := objectHead["Content-Encoding"].(string); ok && options["decompress"] != "false" {
+		if _, ok := storageutil.GetCodec(encoding); ok {
+			if dErr := storageutil.DecompressFile(encoding, localFile); dErr != nil {
+				return nil, fmt.Errorf(" Get Decompress localFile: %s Error: %v", localFile, dErr)
+			}
+		}
+	}
+	//恢复上传时记录的文件属性
+	if aErr := storageutil.RestoreFileAttrs(localFile, objectHead, options); aErr != nil {
+		return nil, fmt.Errorf(" Get Restore localFile: %s Error: %v", localFile, aErr)
 	}
 	return map[string]string{"Object": object, "Localfile": localFile}, nil
 }
 
 // Cat 读取文件内容
-func (c *Client) Cat(bucket, object string, param ...string) (map[string]interface{}, error) {
+func (c *Client) Cat(bucket, object string, options map[string]string, param ...string) (map[string]interface{}, error) {
 	addr := fmt.Sprintf("http://%s.%s/%s", bucket, c.host, object)
 	method := "GET"
 	date := time.Unix(time.Now().Unix()-8*3600, 0).Format(c.dateTimeGMT)
 	headers := map[string]string{
 		"Date": date,
 	}
+	for k, v := range storageutil.SSECHeaders(options) {
+		headers[k] = v
+	}
 	LF := "\n"
 	headers["Authorization"] = c.sign(method+LF+LF, headers, bucket, object)
 	//分片请求
@@ -312,7 +677,9 @@ func (c *Client) Cat(bucket, object string, param ...string) (map[string]interfa
 	if partRange != "" {
 		headers["Range"] = partRange
 	}
-	resp, err := storageutil.CURL(addr, method, headers, bytes.NewBufferString(""))
+	//禁止http客户端自动解压,由decompress决定是否解压
+	headers["Accept-Encoding"] = "identity"
+	resp, err := c.curl(addr, method, headers, bytes.NewBufferString(""))
 	if err != nil {
 		return nil, fmt.Errorf(" Cat Object: %s Error: %v", object, err)
 	}
@@ -321,21 +688,26 @@ func (c *Client) Cat(bucket, object string, param ...string) (map[string]interfa
 	if status != 200 && status != 206 {
 		return nil, fmt.Errorf(" Cat Object: %s StatusCode: %d X-Amz-Request-Id: %s", object, status, reqID)
 	}
+	//自动解压,分片请求返回原始内容
+	if encoding, ok := resp["Content-Encoding"].(string); ok && partRange == "" && options["decompress"] != "false" {
+		if _, ok := storageutil.GetCodec(encoding); ok {
+			if _, ok := resp["Body"]; !ok {
+				return nil, fmt.Errorf(" Cat Object: %s Error: respond body is nil", object)
+			}
+			body, dErr := storageutil.Decompress(encoding, resp["Body"].(*bytes.Buffer).Bytes())
+			if dErr != nil {
+				return nil, fmt.Errorf(" Cat Object: %s Decompress Error: %v", object, dErr)
+			}
+			resp["Body"] = bytes.NewBuffer(body)
+			resp["Content-Length"] = strconv.Itoa(len(body))
+			delete(resp, "Content-Encoding")
+		}
+	}
 	return resp, nil
 }
 
 // UploadFromDir 上传目录
-func (c *Client) UploadFromDir(localDir, bucket, prefix string, options map[string]string, percentChan chan int) (map[string]int, error) {
-	if prefix != "" {
-		prefix = strings.TrimSuffix(prefix, "/") + "/"
-	}
-	suffix := ""
-	if options["suffix"] != "" {
-		suffix = options["suffix"]
-	}
-	localDir = strings.TrimSuffix(localDir, "/") + "/"
-	fileList := storageutil.WalkDir(localDir, suffix)
-	total := len(fileList)
+func (c *Client) UploadFromDir(localDir, bucket, prefix string, options map[string]string, listener storagebase.ProgressListener) (map[string]int, error) {
 	var threadNum = c.threadMaxNum
 	if options["thread_num"] != "" {
 		n, err := strconv.Atoi(options["thread_num"])
@@ -343,97 +715,10 @@ func (c *Client) UploadFromDir(localDir, bucket, prefix string, options map[stri
 			threadNum = n
 		}
 	}
-	if total < threadNum {
-		threadNum = total
-	}
-
-	var queueMaxSize = make(chan bool, threadNum)
-	defer close(queueMaxSize)
-	var fileErr error
-	var fileExit bool
-	var tmpSize int64
-	var tmpSkip int64
-	var tmpFinish int64
-	var wg sync.WaitGroup
-	for fileNum := 0; fileNum < total; fileNum++ {
-		if fileExit {
-			break
-		}
-		wg.Add(1)
-		queueMaxSize <- true
-		go func(fileName string) {
-			defer func() {
-				if fileErr != nil {
-					fileExit = true
-				}
-				wg.Done()
-				<-queueMaxSize
-			}()
-			object := prefix + fileName
-			isSkipped := false
-			localFileStat, err := os.Stat(localDir + fileName)
-			if err != nil {
-				fileErr = fmt.Errorf(" UploadFromDir Stat localFile: %s%s Error: %v", localDir, fileName, err)
-				return
-			}
-			localFileSize := localFileStat.Size()
-			localFileTime := localFileStat.ModTime()
-			if options["replace"] != "true" {
-				var objectHead, _ = c.Head(bucket, object)
-				var objectHeadSize int64
-				if l, ok := objectHead["Content-Length"]; ok {
-					objectHeadSize, _ = strconv.ParseInt(l.(string), 10, 64)
-				}
-				if localFileSize == objectHeadSize {
-					var objectTime time.Time
-					if m, ok := objectHead["Last-Modified"]; ok {
-						objectTime, _ = time.Parse(c.dateTimeGMT, m.(string))
-					}
-					if objectTime.Unix() >= localFileTime.Unix() {
-						isSkipped = true
-						atomic.AddInt64(&tmpSkip, 1)
-					}
-				}
-			}
-			if !isSkipped {
-				fd, oErr := os.Open(localDir + fileName)
-				if fd != nil {
-					defer fd.Close()
-				}
-				if oErr != nil {
-					fileErr = fmt.Errorf(" UploadFromDir Open localFile: %s%s Error: %v", localDir, fileName, oErr)
-					return
-				}
-				stat, sErr := fd.Stat()
-				if sErr != nil {
-					fileErr = fmt.Errorf(" UploadFromDir Stat localFile: %s%s Error: %v", localDir, fileName, sErr)
-					return
-				}
-				bodySize := int(stat.Size())
-				for i := 0; i < c.maxRetryNum; i++ {
-					_, fileErr = c.Put(fd, bodySize, bucket, object, map[string]string{"disposition": fileName, "acl": options["acl"]})
-					if fileErr != nil {
-						continue
-					}
-					break
-				}
-				if fileErr != nil {
-					return
-				}
-				atomic.AddInt64(&tmpSize, localFileSize)
-				atomic.AddInt64(&tmpFinish, 1)
-			}
-			percentChan <- total
-		}(fileList[fileNum])
-	}
-	wg.Wait()
-	if fileErr != nil {
-		return nil, fileErr
-	}
-	skip := int(atomic.LoadInt64(&tmpSkip))
-	finish := int(atomic.LoadInt64(&tmpFinish))
-	size := int(atomic.LoadInt64(&tmpSize))
-	return map[string]int{"Total": total, "Skip": skip, "Finish": finish, "Size": size}, nil
+	return storageutil.UploadFromDir(c, localDir, bucket, prefix, options, listener, threadNum, c.control.Throttle, nil, func(localFile, object string, options map[string]string, listener storagebase.ProgressListener) error {
+		_, err := c.Upload(localFile, bucket, object, options, listener)
+		return err
+	})
 }
 
 // ListObject 查看列表
@@ -459,7 +744,7 @@ func (c *Client) ListObject(bucket string, options map[string]string) (*ListObje
 	}
 	LF := "\n"
 	headers["Authorization"] = c.sign(method+LF+LF, headers, bucket+"/", "")
-	resp, err := storageutil.CURL(addr, method, headers, bytes.NewBufferString(""))
+	resp, err := c.curl(addr, method, headers, bytes.NewBufferString(""))
 	if err != nil {
 		return nil, fmt.Errorf(" ListObject Bucket: %s Error: %v", bucket, err)
 	}
@@ -479,7 +764,7 @@ func (c *Client) ListObject(bucket string, options map[string]string) (*ListObje
 }
 
 // CopyAllObject 复制目录
-func (c *Client) CopyAllObject(bucket, prefix, source string, options map[string]string, percentChan chan int) (map[string]int, error) {
+func (c *Client) CopyAllObject(bucket, prefix, source string, options map[string]string, listener storagebase.ProgressListener) (map[string]int, error) {
 	if prefix != "" {
 		prefix = strings.TrimSuffix(prefix, "/") + "/"
 	}
@@ -495,13 +780,22 @@ func (c *Client) CopyAllObject(bucket, prefix, source string, options map[string
 			threadNum = n
 		}
 	}
-	var queueMaxSize = make(chan bool, threadNum)
-	defer close(queueMaxSize)
-	var copyExit bool
+	var queueMaxSize = storageutil.NewConcurrency(threadNum, c.control.Throttle)
 	var tmpSize int64
 	var tmpSkip int64
 	var tmpFinish int64
 	var wg sync.WaitGroup
+	bulk := storageutil.NewBulk("CopyAllObject", options)
+	dryRun := storageutil.DryRun(options)
+	filter, filterErr := storageutil.NewFilter(options)
+	if filterErr != nil {
+		return nil, fmt.Errorf(" CopyAllObject Filter Error: %v", filterErr)
+	}
+	comparer, compareErr := storageutil.NewComparer(options)
+	if compareErr != nil {
+		return nil, fmt.Errorf(" CopyAllObject Compare Error: %v", compareErr)
+	}
+	progress := storageutil.NewProgress(listener, "CopyAllObject", prefix, 0, 0)
 LIST:
 	sourceList, err := c.ListObject(sourceBucket, map[string]string{"prefix": sourcePrefix, "marker": marker, "max-keys": "1000"})
 	if err != nil {
@@ -509,34 +803,18 @@ LIST:
 	}
 	sourceObjectNum := len(sourceList.Contents)
 	total += sourceObjectNum
-	var fileErr error
+	progress.AddTotal(0, sourceObjectNum)
 	for fileNum := 0; fileNum < sourceObjectNum; fileNum++ {
-		if copyExit {
+		if bulk.Exit() {
 			break
 		}
 		wg.Add(1)
-		queueMaxSize <- true
+		queueMaxSize.Acquire()
 		go func(objectInfo ListObjectContents) {
 			defer func() {
-				if fileErr != nil {
-					copyExit = true
-				}
 				wg.Done()
-				<-queueMaxSize
+				queueMaxSize.Release()
 			}()
-			//根据后缀过滤处理
-			isSkipped := false
-			if options["suffix"] != "" {
-				suffixList := strings.Split(options["suffix"], ",")
-				for _, tmpSuffix := range suffixList {
-					if tmpSuffix != "" {
-						if strings.HasSuffix(strings.ToLower(objectInfo.Key), tmpSuffix) {
-							isSkipped = true
-							break
-						}
-					}
-				}
-			}
 			//支持自定义前缀
 			object := prefix
 			if options["full_path"] == "true" {
@@ -544,158 +822,153 @@ LIST:
 			} else {
 				object += path.Base(objectInfo.Key)
 			}
-			var sourceHead, _ = c.Head(sourceBucket, objectInfo.Key)
-			var disposition string
-			if d, ok := sourceHead["Content-Disposition"]; ok {
-				disposition = d.(string)
-			}
-			var sourceHeadSize int64
-			if l, ok := sourceHead["Content-Length"]; ok {
-				sourceHeadSize, _ = strconv.ParseInt(l.(string), 10, 64)
-			}
-			if options["replace"] != "true" {
-				var objectHead, _ = c.Head(bucket, object)
-				var objectHeadSize int64
-				if l, ok := objectHead["Content-Length"]; ok {
-					objectHeadSize, _ = strconv.ParseInt(l.(string), 10, 64)
+			var action, reason string
+			var itemSize int64
+			err := bulk.Do(objectInfo.Key, func() error {
+				action, reason = "copy", "replace"
+				if ok, why := filter.MatchObject(sourcePrefix, objectInfo); !ok {
+					action, reason = "skip", why
+					atomic.AddInt64(&tmpSkip, 1)
+					return nil
 				}
-				if sourceHeadSize == objectHeadSize {
-					var objectTime, sourceTime time.Time
-					if m, ok := objectHead["Last-Modified"]; ok {
-						objectTime, _ = time.Parse(c.dateTimeGMT, m.(string))
-					}
-					if m, ok := sourceHead["Last-Modified"]; ok {
-						sourceTime, _ = time.Parse(c.dateTimeGMT, m.(string))
+				var isSkipped bool
+				var sourceHead, _ = c.Head(sourceBucket, objectInfo.Key, storageutil.SourceSSEOptions(options))
+				var sourceHeadSize int64
+				if l, ok := sourceHead["Content-Length"]; ok {
+					sourceHeadSize, _ = strconv.ParseInt(l.(string), 10, 64)
+				}
+				if !comparer.Always() {
+					var objectHead, _ = c.Head(bucket, object, options)
+					isSkipped, reason = comparer.Skip(storageutil.HeadState(sourceHead, false), storageutil.HeadState(objectHead, false))
+				}
+				itemSize = sourceHeadSize
+				if isSkipped {
+					action = "skip"
+					atomic.AddInt64(&tmpSkip, 1)
+				} else {
+					if dryRun {
+						atomic.AddInt64(&tmpSize, sourceHeadSize)
+						atomic.AddInt64(&tmpFinish, 1)
+						return nil
 					}
-					if objectTime.Unix() >= sourceTime.Unix() {
-						isSkipped = true
+					tmpSourceObject := "/" + sourceBucket + "/" + objectInfo.Key
+					progress.AddTotal(sourceHeadSize, 0)
+					if _, err := c.CopyObject(bucket, object, tmpSourceObject, storageutil.SSEOptions(map[string]string{"acl": options["acl"], "multipart_threshold": options["multipart_threshold"], "part_size": options["part_size"]}, options), progress.Child()); err != nil {
+						return err
 					}
+					atomic.AddInt64(&tmpSize, sourceHeadSize)
+					atomic.AddInt64(&tmpFinish, 1)
 				}
-			}
-			if isSkipped {
-				atomic.AddInt64(&tmpSkip, 1)
-			} else {
-				tmpSourceObject := "/" + sourceBucket + "/" + objectInfo.Key
-				_, fileErr = c.CopyLargeFile(bucket, object, tmpSourceObject, map[string]string{"disposition": disposition, "acl": options["acl"]}, nil, nil)
-				if fileErr != nil {
-					return
-				}
-				atomic.AddInt64(&tmpSize, sourceHeadSize)
-				atomic.AddInt64(&tmpFinish, 1)
-			}
-			percentChan <- total
+				return nil
+			})
+			progress.Action(object, action, reason, itemSize, err)
 		}(sourceList.Contents[fileNum])
 	}
 	wg.Wait()
-	if fileErr == nil && sourceList.IsTruncated == "true" {
+	if !bulk.Exit() && sourceList.IsTruncated == "true" {
 		marker = sourceList.Contents[sourceObjectNum-1].Key
 		goto LIST
 	}
-	if fileErr != nil {
-		return nil, fileErr
-	}
 	skip := int(atomic.LoadInt64(&tmpSkip))
 	finish := int(atomic.LoadInt64(&tmpFinish))
 	size := int(atomic.LoadInt64(&tmpSize))
-	return map[string]int{"Total": total, "Skip": skip, "Finish": finish, "Size": size}, nil
+	return bulk.Result(map[string]int{"Total": total, "Skip": skip, "Finish": finish, "Size": size})
 }
 
 // DeleteAllObject 删除目录
-func (c *Client) DeleteAllObject(bucket, prefix string, options map[string]string, percentChan chan int) (map[string]int, error) {
-	bodyList := make([]string, 0)
-	bodyListNum := make([]int, 0)
+func (c *Client) DeleteAllObject(bucket, prefix string, options map[string]string, listener storagebase.ProgressListener) (map[string]int, error) {
 	marker := ""
 	total := 0
 	var tmpFinish int64
+	skip := 0
+	dryRun := storageutil.DryRun(options)
+	filter, filterErr := storageutil.NewFilter(options)
+	if filterErr != nil {
+		return nil, fmt.Errorf(" DeleteAllObject Filter Error: %v", filterErr)
+	}
+	dryRunSize := 0
+	var threadNum = c.threadMaxNum
+	if options["thread_num"] != "" {
+		n, err := strconv.Atoi(options["thread_num"])
+		if err == nil && n <= c.threadMaxNum && n >= c.threadMinNum {
+			threadNum = n
+		}
+	}
+	//边列表边删除,同时只保留threadNum页
+	var queueMaxSize = storageutil.NewConcurrency(threadNum, c.control.Throttle)
+	var wg sync.WaitGroup
+	bulk := storageutil.NewBulk("DeleteAllObject", options)
+	progress := storageutil.NewProgress(listener, "DeleteAllObject", prefix, 0, 0)
 LIST:
 	list, err := c.ListObject(bucket, map[string]string{"prefix": prefix, "marker": marker, "max-keys": "1000"})
 	if err != nil {
+		wg.Wait()
 		return nil, err
 	}
 	total += len(list.Contents)
+	progress.AddTotal(0, len(list.Contents))
 	if total <= 0 {
 		return map[string]int{"total": 0, "finish": 0}, nil
 	}
-	body := "<Delete>"
-	body += "<Quiet>true</Quiet>"
+	objectList := make([]ListObjectContents, 0, len(list.Contents))
 	for _, v := range list.Contents {
-		body += "<Object><Key>" + v.Key + "</Key></Object>"
 		marker = v.Key
-	}
-	body += "</Delete>"
-	bodyList = append(bodyList, body)
-	bodyListNum = append(bodyListNum, len(list.Contents))
-	if list.IsTruncated == "true" {
-		goto LIST
-	}
-	var threadNum = c.threadMaxNum
-	if options["thread_num"] != "" {
-		n, err := strconv.Atoi(options["thread_num"])
-		if err == nil && n <= c.threadMaxNum && n >= c.threadMinNum {
-			threadNum = n
+		if ok, why := filter.MatchObject(prefix, v); !ok {
+			skip++
+			progress.Action(v.Key, "skip", why, int64(v.Size), nil)
+			continue
 		}
-	}
-	var bodyNum = len(bodyList)
-	if bodyNum < threadNum {
-		threadNum = bodyNum
-	}
-	var queueMaxSize = make(chan bool, threadNum)
-	defer close(queueMaxSize)
-	var fileErr error
-	var fileExit bool
-	var wg sync.WaitGroup
-	for fileNum := 0; fileNum < bodyNum; fileNum++ {
-		if fileExit {
-			break
+		if dryRun {
+			dryRunSize += v.Size
+			progress.Action(v.Key, "delete", "prefix", int64(v.Size), nil)
+			continue
 		}
+		objectList = append(objectList, v)
+	}
+	if len(objectList) > 0 {
 		wg.Add(1)
-		queueMaxSize <- true
-		go func(fileNum int, body string) {
+		queueMaxSize.Acquire()
+		go func(objectList []ListObjectContents) {
 			defer func() {
-				if fileErr != nil {
-					fileExit = true
-				}
 				wg.Done()
-				<-queueMaxSize
+				queueMaxSize.Release()
 			}()
-			object := "?delete"
-			addr := fmt.Sprintf("http://%s.%s/%s", bucket, c.host, object)
-			method := "POST"
-			date := time.Unix(time.Now().Unix()-8*3600, 0).Format(c.dateTimeGMT)
-			contentLength := strconv.Itoa(len(body))
-			contentMd5 := storageutil.Base64Encode(storageutil.Md5Byte([]byte(body)))
-			headers := map[string]string{
-				"Content-Md5": contentMd5 + "\n",
-				"Date":        date,
+			objects := make([]ObjectIdentifier, len(objectList))
+			for i, v := range objectList {
+				objects[i].Key = v.Key
 			}
-			headers["Authorization"] = c.sign(method, headers, bucket, object)
-			headers["Content-Length"] = contentLength
-			headers["Content-Md5"] = strings.TrimSuffix(headers["Content-Md5"], "\n")
-			resp, cErr := storageutil.CURL(addr, method, headers, bytes.NewBufferString(body))
-			if cErr != nil {
-				fileErr = fmt.Errorf(" DeleteAllObject Prefix: %s Error: %v", prefix, cErr)
-				return
+			result, dErr := c.deleteBatch(bucket, objects)
+			if dErr != nil {
+				dErr = fmt.Errorf(" DeleteAllObject Prefix: %s%v", prefix, dErr)
 			}
-			status := resp["StatusCode"].(int)
-			reqID := resp["X-Amz-Request-Id"].(string)
-			if status != 200 {
-				fileErr = fmt.Errorf(" DeleteAllObject Prefix: %s StatusCode: %d X-Amz-Request-Id: %s", prefix, status, reqID)
-				return
+			keyErrs := storageutil.DeleteErrors(result)
+			for _, v := range objectList {
+				keyErr := dErr
+				if e, ok := keyErrs[ObjectIdentifier{Key: v.Key}]; ok {
+					keyErr = fmt.Errorf(" DeleteAllObject Object: %s %v", v.Key, e)
+				}
+				if keyErr != nil {
+					bulk.Fail(v.Key, keyErr)
+				} else {
+					atomic.AddInt64(&tmpFinish, 1)
+				}
+				progress.Action(v.Key, "delete", "prefix", int64(v.Size), keyErr)
 			}
-			atomic.AddInt64(&tmpFinish, int64(bodyListNum[fileNum]))
-			percentChan <- total
-		}(fileNum, bodyList[fileNum])
+		}(objectList)
+	}
+	if list.IsTruncated == "true" && !bulk.Exit() {
+		goto LIST
 	}
 	wg.Wait()
-	if fileErr != nil {
-		return nil, fileErr
+	if dryRun {
+		return map[string]int{"Total": total, "Skip": skip, "Finish": total - skip, "Size": dryRunSize}, nil
 	}
 	finish := int(atomic.LoadInt64(&tmpFinish))
-	return map[string]int{"Total": total, "Finish": finish}, nil
+	return bulk.Result(map[string]int{"Total": total, "Skip": skip, "Finish": finish})
 }
 
 // MoveAllObject 移动目录
-func (c *Client) MoveAllObject(bucket, prefix, source string, options map[string]string, percentChan chan int) (map[string]int, error) {
+func (c *Client) MoveAllObject(bucket, prefix, source string, options map[string]string, listener storagebase.ProgressListener) (map[string]int, error) {
 	if prefix != "" {
 		prefix = strings.TrimSuffix(prefix, "/") + "/"
 	}
@@ -711,13 +984,22 @@ func (c *Client) MoveAllObject(bucket, prefix, source string, options map[string
 			threadNum = n
 		}
 	}
-	var queueMaxSize = make(chan bool, threadNum)
-	defer close(queueMaxSize)
-	var copyExit bool
+	var queueMaxSize = storageutil.NewConcurrency(threadNum, c.control.Throttle)
 	var tmpSize int64
 	var tmpSkip int64
 	var tmpFinish int64
 	var wg sync.WaitGroup
+	bulk := storageutil.NewBulk("MoveAllObject", options)
+	dryRun := storageutil.DryRun(options)
+	filter, filterErr := storageutil.NewFilter(options)
+	if filterErr != nil {
+		return nil, fmt.Errorf(" MoveAllObject Filter Error: %v", filterErr)
+	}
+	comparer, compareErr := storageutil.NewComparer(options)
+	if compareErr != nil {
+		return nil, fmt.Errorf(" MoveAllObject Compare Error: %v", compareErr)
+	}
+	progress := storageutil.NewProgress(listener, "MoveAllObject", prefix, 0, 0)
 LIST:
 	sourceList, err := c.ListObject(sourceBucket, map[string]string{"prefix": sourcePrefix, "marker": marker, "max-keys": "1000"})
 	if err != nil {
@@ -725,34 +1007,18 @@ LIST:
 	}
 	sourceObjectNum := len(sourceList.Contents)
 	total += sourceObjectNum
-	var fileErr error
+	progress.AddTotal(0, sourceObjectNum)
 	for fileNum := 0; fileNum < sourceObjectNum; fileNum++ {
-		if copyExit {
+		if bulk.Exit() {
 			break
 		}
 		wg.Add(1)
-		queueMaxSize <- true
+		queueMaxSize.Acquire()
 		go func(objectInfo ListObjectContents) {
 			defer func() {
-				if fileErr != nil {
-					copyExit = true
-				}
 				wg.Done()
-				<-queueMaxSize
+				queueMaxSize.Release()
 			}()
-			//根据后缀过滤处理
-			isSkipped := false
-			if options["suffix"] != "" {
-				suffixList := strings.Split(options["suffix"], ",")
-				for _, tmpSuffix := range suffixList {
-					if tmpSuffix != "" {
-						if strings.HasSuffix(strings.ToLower(objectInfo.Key), tmpSuffix) {
-							isSkipped = true
-							break
-						}
-					}
-				}
-			}
 			//支持自定义前缀
 			object := prefix
 			if options["full_path"] == "true" {
@@ -760,77 +1026,65 @@ LIST:
 			} else {
 				object += path.Base(objectInfo.Key)
 			}
-			var sourceHead, _ = c.Head(sourceBucket, objectInfo.Key)
-			var disposition string
-			if d, ok := sourceHead["Content-Disposition"]; ok {
-				disposition = d.(string)
-			}
-			var sourceHeadSize int64
-			if l, ok := sourceHead["Content-Length"]; ok {
-				sourceHeadSize, _ = strconv.ParseInt(l.(string), 10, 64)
-			}
-			if options["replace"] != "true" {
-				var objectHead, _ = c.Head(bucket, object)
-				var objectHeadSize int64
-				if l, ok := objectHead["Content-Length"]; ok {
-					objectHeadSize, _ = strconv.ParseInt(l.(string), 10, 64)
+			var action, reason string
+			var itemSize int64
+			err := bulk.Do(objectInfo.Key, func() error {
+				action, reason = "move", "replace"
+				if ok, why := filter.MatchObject(sourcePrefix, objectInfo); !ok {
+					action, reason = "skip", why
+					atomic.AddInt64(&tmpSkip, 1)
+					return nil
 				}
-				if sourceHeadSize == objectHeadSize {
-					var objectTime, sourceTime time.Time
-					if m, ok := objectHead["Last-Modified"]; ok {
-						objectTime, _ = time.Parse(c.dateTimeGMT, m.(string))
-					}
-					if m, ok := sourceHead["Last-Modified"]; ok {
-						sourceTime, _ = time.Parse(c.dateTimeGMT, m.(string))
-					}
-					if objectTime.Unix() >= sourceTime.Unix() {
-						isSkipped = true
-					}
+				var isSkipped bool
+				var sourceHead, _ = c.Head(sourceBucket, objectInfo.Key, storageutil.SourceSSEOptions(options))
+				var sourceHeadSize int64
+				if l, ok := sourceHead["Content-Length"]; ok {
+					sourceHeadSize, _ = strconv.ParseInt(l.(string), 10, 64)
 				}
-			}
-			if isSkipped {
-				atomic.AddInt64(&tmpSkip, 1)
-			} else {
-				tmpSourceObject := "/" + sourceBucket + "/" + objectInfo.Key
-				_, fileErr = c.CopyLargeFile(bucket, object, tmpSourceObject, map[string]string{"disposition": disposition, "acl": options["acl"]}, nil, nil)
-				if fileErr != nil {
-					return
+				if !comparer.Always() {
+					var objectHead, _ = c.Head(bucket, object, options)
+					isSkipped, reason = comparer.Skip(storageutil.HeadState(sourceHead, false), storageutil.HeadState(objectHead, false))
 				}
-				//删除源文件
-				for i := 0; i < c.maxRetryNum; i++ {
-					_, fileErr = c.Delete(sourceBucket, objectInfo.Key)
-					if fileErr != nil {
-						continue
+				itemSize = sourceHeadSize
+				if isSkipped {
+					action = "skip"
+					atomic.AddInt64(&tmpSkip, 1)
+				} else {
+					if dryRun {
+						atomic.AddInt64(&tmpSize, sourceHeadSize)
+						atomic.AddInt64(&tmpFinish, 1)
+						return nil
 					}
-					break
-				}
-				if fileErr != nil {
-					return
+					tmpSourceObject := "/" + sourceBucket + "/" + objectInfo.Key
+					progress.AddTotal(sourceHeadSize, 0)
+					if _, err := c.CopyObject(bucket, object, tmpSourceObject, storageutil.SSEOptions(map[string]string{"acl": options["acl"], "multipart_threshold": options["multipart_threshold"], "part_size": options["part_size"]}, options), progress.Child()); err != nil {
+						return err
+					}
+					//删除源文件
+					if _, err := c.Delete(sourceBucket, objectInfo.Key); err != nil {
+						return err
+					}
+					atomic.AddInt64(&tmpSize, sourceHeadSize)
+					atomic.AddInt64(&tmpFinish, 1)
 				}
-				atomic.AddInt64(&tmpSize, sourceHeadSize)
-				atomic.AddInt64(&tmpFinish, 1)
-			}
-			percentChan <- total
+				return nil
+			})
+			progress.Action(object, action, reason, itemSize, err)
 		}(sourceList.Contents[fileNum])
 	}
 	wg.Wait()
-	if fileErr == nil && sourceList.IsTruncated == "true" {
+	if !bulk.Exit() && sourceList.IsTruncated == "true" {
 		marker = sourceList.Contents[sourceObjectNum-1].Key
 		goto LIST
 	}
-	if fileErr != nil {
-		return nil, fileErr
-	}
 	skip := int(atomic.LoadInt64(&tmpSkip))
 	finish := int(atomic.LoadInt64(&tmpFinish))
 	size := int(atomic.LoadInt64(&tmpSize))
-	return map[string]int{"Total": total, "Skip": skip, "Finish": finish, "Size": size}, nil
+	return bulk.Result(map[string]int{"Total": total, "Skip": skip, "Finish": finish, "Size": size})
 }
 
 // DownloadAllObject 下载目录
-func (c *Client) DownloadAllObject(bucket, prefix, localDir string, options map[string]string, percentChan chan int) (map[string]int, error) {
-	marker := ""
-	total := 0
+func (c *Client) DownloadAllObject(bucket, prefix, localDir string, options map[string]string, listener storagebase.ProgressListener) (map[string]int, error) {
 	var threadNum = c.threadMaxNum
 	if options["thread_num"] != "" {
 		n, err := strconv.Atoi(options["thread_num"])
@@ -838,86 +1092,20 @@ func (c *Client) DownloadAllObject(bucket, prefix, localDir string, options map[
 			threadNum = n
 		}
 	}
-	var queueMaxSize = make(chan bool, threadNum)
-	defer close(queueMaxSize)
-	var tmpSkip int64
-	var tmpFinish int64
-	var wg sync.WaitGroup
-LIST:
-	list, err := c.ListObject(bucket, map[string]string{"prefix": prefix, "marker": marker, "max-keys": "1000"})
-	if err != nil {
-		return nil, err
-	}
-	objectNum := len(list.Contents)
-	total += objectNum
-	var fileErr error
-	var fileExit bool
-	for fileNum := 0; fileNum < objectNum; fileNum++ {
-		if fileExit {
-			break
-		}
-		wg.Add(1)
-		queueMaxSize <- true
-		go func(objectInfo ListObjectContents) {
-			defer func() {
-				if fileErr != nil {
-					fileExit = true
-				}
-				wg.Done()
-				<-queueMaxSize
-			}()
-			localFile := strings.TrimSuffix(localDir, "/") + "/" + objectInfo.Key
-			isSkipped := false
-			if options["replace"] != "true" {
-				var objectHead, _ = c.Head(bucket, objectInfo.Key)
-				var objectHeadSize int64
-				if l, ok := objectHead["Content-Length"]; ok {
-					objectHeadSize, _ = strconv.ParseInt(l.(string), 10, 64)
-				}
-				fileStat, sErr := os.Stat(localFile)
-				if sErr == nil && objectHeadSize == fileStat.Size() {
-					var objectTime time.Time
-					if m, ok := objectHead["Last-Modified"]; ok {
-						objectTime, _ = time.Parse(c.dateTimeGMT, m.(string))
-					}
-					if objectTime.Unix() >= fileStat.ModTime().Unix() {
-						isSkipped = true
-						atomic.AddInt64(&tmpSkip, 1)
-					}
-				}
-			}
-			if !isSkipped {
-				var getPercent = make(chan int)
-				defer close(getPercent)
-				go func() {
-					for {
-						_, ok := <-getPercent
-						if !ok {
-							break
-						}
-					}
-				}()
-				_, fileErr = c.Get(bucket, objectInfo.Key, localFile, map[string]string{
-					"thread_num": options["thread_num"],
-					"part_size":  options["part_size"],
-				}, getPercent)
-				if fileErr != nil {
-					return
-				}
-				atomic.AddInt64(&tmpFinish, 1)
-			}
-			percentChan <- total
-		}(list.Contents[fileNum])
-	}
-	wg.Wait()
-	if fileErr == nil && list.IsTruncated == "true" {
-		marker = list.Contents[objectNum-1].Key
-		goto LIST
-	}
-	if fileErr != nil {
-		return nil, fileErr
-	}
-	skip := int(atomic.LoadInt64(&tmpSkip))
-	finish := int(atomic.LoadInt64(&tmpFinish))
-	return map[string]int{"Total": total, "Skip": skip, "Finish": finish}, nil
+	headState := func(head map[string]interface{}) *storageutil.FileState {
+		return storageutil.HeadState(head, options["decompress"] != "false")
+	}
+	return storageutil.DownloadAllObject(c, bucket, prefix, localDir, options, listener, threadNum, c.control.Throttle, headState, func(object, localFile string, listener storagebase.ProgressListener) error {
+		_, err := c.Get(bucket, object, localFile, storageutil.SSEOptions(map[string]string{
+			"thread_num":     options["thread_num"],
+			"part_size":      options["part_size"],
+			"decompress":     options["decompress"],
+			"verify":         options["verify"],
+			"preserve_attrs": options["preserve_attrs"],
+			"preserve_owner": options["preserve_owner"],
+			"symlinks":       options["symlinks"],
+			"local_dir":      localDir,
+		}, options), listener)
+		return err
+	})
 }
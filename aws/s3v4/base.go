@@ -6,9 +6,12 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"net/url"
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/shideqin/storage/storageutil"
 )
 
 func (c *Client) sign(method string, headers map[string]string, uri, canonQuery string) string {
@@ -125,3 +128,17 @@ func hashSHA256Reader(body io.Reader) []byte {
 	_, _ = rs.Seek(0, 0)
 	return h.Sum(nil)
 }
+
+// curl 按重试策略发送请求
+func (c *Client) curl(addr, method string, headers map[string]string, body io.Reader) (map[string]interface{}, error) {
+	return storageutil.CURLWithRetry(c.control, c.bucketOf(addr), addr, method, headers, body, nil)
+}
+
+// bucketOf 根据请求地址获取bucket,用于bucket的请求频率限制
+func (c *Client) bucketOf(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil || !strings.HasSuffix(u.Host, "."+c.host) {
+		return ""
+	}
+	return strings.TrimSuffix(u.Host, "."+c.host)
+}
@@ -35,7 +35,7 @@ func (c *Client) GetService() (*ServiceResult, error) {
 		"x-amz-content-sha256": c.emptyStringSHA256,
 	}
 	headers["Authorization"] = c.sign(method, headers, "/", "")
-	resp, err := storageutil.CURL(addr, method, headers, bytes.NewBufferString(""))
+	resp, err := c.curl(addr, method, headers, bytes.NewBufferString(""))
 	if err != nil {
 		return nil, fmt.Errorf(" GetService Error: %v", err)
 	}
@@ -72,7 +72,7 @@ func (c *Client) CreateBucket(bucket string, options map[string]string) (map[str
 		headers["x-amz-acl"] = options["acl"]
 	}
 	headers["Authorization"] = c.sign(method, headers, "/", "")
-	resp, err := storageutil.CURL(addr, method, headers, bytes.NewBufferString(body))
+	resp, err := c.curl(addr, method, headers, bytes.NewBufferString(body))
 	if err != nil {
 		return nil, fmt.Errorf(" CreateBucket Bucket: %s Error: %v", bucket, err)
 	}
@@ -99,7 +99,7 @@ func (c *Client) DeleteBucket(bucket string) (map[string]interface{}, error) {
 		"x-amz-content-sha256": c.emptyStringSHA256,
 	}
 	headers["Authorization"] = c.sign(method, headers, "/", "")
-	resp, err := storageutil.CURL(addr, method, headers, bytes.NewBufferString(""))
+	resp, err := c.curl(addr, method, headers, bytes.NewBufferString(""))
 	if err != nil {
 		return nil, fmt.Errorf(" DeleteBucket Bucket: %s Error: %v", bucket, err)
 	}
@@ -129,6 +129,9 @@ func (c *Client) ListPart(bucket string, options map[string]string) (*ListPartsR
 	if options["prefix"] != "" {
 		param += "&prefix=" + options["prefix"]
 	}
+	if options["upload-id-marker"] != "" {
+		param += "&upload-id-marker=" + options["upload-id-marker"]
+	}
 	object := strings.TrimPrefix(param, "&")
 	host := fmt.Sprintf("%s.%s", bucket, c.host)
 	addr := fmt.Sprintf("http://%s/?uploads&%s", host, object)
@@ -140,7 +143,7 @@ func (c *Client) ListPart(bucket string, options map[string]string) (*ListPartsR
 		"x-amz-content-sha256": c.emptyStringSHA256,
 	}
 	headers["Authorization"] = c.sign(method, headers, "/", object+"&uploads=")
-	resp, err := storageutil.CURL(addr, method, headers, bytes.NewBufferString(""))
+	resp, err := c.curl(addr, method, headers, bytes.NewBufferString(""))
 	if err != nil {
 		return nil, fmt.Errorf(" ListPart Bucket: %s Error: %v", bucket, err)
 	}
@@ -160,87 +163,87 @@ func (c *Client) ListPart(bucket string, options map[string]string) (*ListPartsR
 }
 
 // DeleteAllPart 删除所有分块
-func (c *Client) DeleteAllPart(bucket, prefix string, options map[string]string, percentChan chan int) (map[string]int, error) {
-	bodyList := make([]map[string]string, 0)
+func (c *Client) DeleteAllPart(bucket, prefix string, options map[string]string, listener storagebase.ProgressListener) (map[string]int, error) {
 	marker := ""
+	uploadIDMarker := ""
 	total := 0
 	var tmpFinish int64
 	var tmpSkip int64
 	var wg sync.WaitGroup
+	dryRun := storageutil.DryRun(options)
+	filter, filterErr := storageutil.NewFilter(options)
+	if filterErr != nil {
+		return nil, fmt.Errorf(" DeleteAllPart Filter Error: %v", filterErr)
+	}
+	var threadNum = c.threadMaxNum
+	if options["thread_num"] != "" {
+		n, err := strconv.Atoi(options["thread_num"])
+		if err == nil && n <= c.threadMaxNum && n >= c.threadMinNum {
+			threadNum = n
+		}
+	}
+	//边列表边取消
+	var queueMaxSize = storageutil.NewConcurrency(threadNum, c.control.Throttle)
+	bulk := storageutil.NewBulk("DeleteAllPart", options)
+	expired, _ := strconv.Atoi(options["expired"])
+	progress := storageutil.NewProgress(listener, "DeleteAllPart", prefix, 0, 0)
 LIST:
-	list, err := c.ListPart(bucket, map[string]string{"prefix": prefix, "key-marker": marker, "max-keys": "1000"})
+	list, err := c.ListPart(bucket, map[string]string{"prefix": prefix, "key-marker": marker, "upload-id-marker": uploadIDMarker, "max-keys": "1000"})
 	if err != nil {
+		wg.Wait()
 		return nil, err
 	}
 	total += len(list.Upload)
+	progress.AddTotal(0, len(list.Upload))
 	if total <= 0 {
 		return map[string]int{"Total": 0, "Finish": 0}, nil
 	}
-	expired, _ := strconv.Atoi(options["expired"])
 	for _, v := range list.Upload {
+		if bulk.Exit() {
+			break
+		}
 		lastModified, err := time.Parse("2006-01-02T15:04:05.000Z", v.Initiated)
 		if err == nil && time.Since(lastModified).Seconds() < float64(expired) {
 			atomic.AddInt64(&tmpSkip, 1)
+			progress.Action(v.Key, "skip", "not_expired", 0, nil)
 			continue
 		}
-		bodyList = append(bodyList, map[string]string{"Bucket": bucket, "Key": v.Key, "UploadID": v.UploadID})
-	}
-	if list.IsTruncated == "true" {
-		marker = list.NextKeyMarker
-		goto LIST
-	}
-
-	var threadNum = c.threadMaxNum
-	if options["thread_num"] != "" {
-		n, err := strconv.Atoi(options["thread_num"])
-		if err == nil && n <= c.threadMaxNum && n >= c.threadMinNum {
-			threadNum = n
+		if ok, why := filter.Match(strings.TrimPrefix(v.Key, prefix), -1, lastModified); !ok {
+			atomic.AddInt64(&tmpSkip, 1)
+			progress.Action(v.Key, "skip", why, 0, nil)
+			continue
 		}
-	}
-	var bodyNum = len(bodyList)
-	if bodyNum < threadNum {
-		threadNum = bodyNum
-	}
-	var queueMaxSize = make(chan bool, threadNum)
-	defer close(queueMaxSize)
-	var partErr error
-	var partExit bool
-	for partNum := 0; partNum < bodyNum; partNum++ {
-		if partExit {
-			break
+		if dryRun {
+			atomic.AddInt64(&tmpFinish, 1)
+			progress.Action(v.Key, "abort", "expired", 0, nil)
+			continue
 		}
 		wg.Add(1)
-		queueMaxSize <- true
-		go func(partNum int, body map[string]string) {
+		queueMaxSize.Acquire()
+		go func(key, uploadID string) {
 			defer func() {
-				if partErr != nil {
-					partExit = true
-				}
 				wg.Done()
-				<-queueMaxSize
+				queueMaxSize.Release()
 			}()
-			for i := 0; i < c.maxRetryNum; i++ {
-				_, partErr = c.CancelPart(body["Bucket"], body["Key"], body["UploadID"])
-				if partErr != nil {
-					continue
-				}
-				partErr = nil
-				break
+			err := bulk.Do(key, func() error {
+				_, cErr := c.CancelPart(bucket, key, uploadID)
+				return cErr
+			})
+			if err == nil {
+				atomic.AddInt64(&tmpFinish, 1)
 			}
-			if partErr != nil {
-				return
-			}
-			atomic.AddInt64(&tmpFinish, 1)
-			percentChan <- total
-		}(partNum, bodyList[partNum])
+			progress.Action(key, "abort", "expired", 0, err)
+		}(v.Key, v.UploadID)
 	}
-	wg.Wait()
-	if partErr != nil {
-		return nil, partErr
+	if list.IsTruncated == "true" && !bulk.Exit() {
+		marker = list.NextKeyMarker
+		uploadIDMarker = list.NextUploadIDMarker
+		goto LIST
 	}
+	wg.Wait()
 	finish := int(atomic.LoadInt64(&tmpFinish))
 	skip := int(atomic.LoadInt64(&tmpSkip))
-	return map[string]int{"Total": total, "Finish": finish, "Skip": skip}, nil
+	return bulk.Result(map[string]int{"Total": total, "Finish": finish, "Skip": skip})
 }
 
 // GetACL 获取bucket acl
@@ -255,7 +258,7 @@ func (c *Client) GetACL(bucket string) (*AclResult, error) {
 		"x-amz-content-sha256": c.emptyStringSHA256,
 	}
 	headers["Authorization"] = c.sign(method, headers, "/", "acl=")
-	resp, err := storageutil.CURL(addr, method, headers, bytes.NewBufferString(""))
+	resp, err := c.curl(addr, method, headers, bytes.NewBufferString(""))
 	if err != nil {
 		return nil, fmt.Errorf(" GetACL Bucket: %s Error: %v", bucket, err)
 	}
@@ -289,7 +292,7 @@ func (c *Client) SetACL(bucket string, options map[string]string) (map[string]in
 		headers["x-amz-acl"] = options["acl"]
 	}
 	headers["Authorization"] = c.sign(method, headers, "/", "acl=")
-	resp, err := storageutil.CURL(addr, method, headers, bytes.NewBufferString(""))
+	resp, err := c.curl(addr, method, headers, bytes.NewBufferString(""))
 	if err != nil {
 		return nil, fmt.Errorf(" SetACL Bucket: %s Error: %v", bucket, err)
 	}
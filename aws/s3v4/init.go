@@ -1,23 +1,29 @@
 package s3v4
 
+import (
+	"github.com/shideqin/storage/storagebase"
+	"github.com/shideqin/storage/storageutil"
+)
+
 // Client 客户端结构
 type Client struct {
 	host            string
 	accessKeyID     string
 	accessKeySecret string
 
-	dateTimeGMT           string
 	iso8601FormatDateTime string
 	iso8601FormatDate     string
 	authHeaderPrefix      string
 	awsV4Request          string
 	emptyStringSHA256     string
 
-	partMaxSize  int
-	partMinSize  int
-	maxRetryNum  int
-	threadMaxNum int
-	threadMinNum int
+	partMaxSize        int
+	partMinSize        int
+	multipartThreshold int
+	threadMaxNum       int
+	threadMinNum       int
+
+	control *storageutil.RequestControl
 }
 
 // New 实例化
@@ -33,10 +39,37 @@ func New(host, accessKeyID, accessKeySecret string) *Client {
 		awsV4Request:          "aws4_request",
 		emptyStringSHA256:     "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
 
-		partMaxSize:  100 * 1024 * 1024,
-		partMinSize:  1 * 1024 * 1024,
-		maxRetryNum:  5,
-		threadMaxNum: 500,
-		threadMinNum: 1,
+		partMaxSize:        100 * 1024 * 1024,
+		partMinSize:        1 * 1024 * 1024,
+		multipartThreshold: 100 * 1024 * 1024,
+		threadMaxNum:       500,
+		threadMinNum:       1,
+
+		control: &storageutil.RequestControl{
+			RetryPolicy: storagebase.DefaultRetryPolicy(),
+			Bandwidth:   storageutil.NewBandwidth(),
+			Limiter:     storageutil.NewRequestLimiter(),
+			Throttle:    &storageutil.Throttle{},
+		},
 	}
 }
+
+// SetRetryPolicy 设置请求重试策略,nil为不重试
+func (c *Client) SetRetryPolicy(policy *storagebase.RetryPolicy) {
+	c.control.RetryPolicy = policy
+}
+
+// SetBandwidthLimit 设置上传和下载限速,单位字节/秒,0为不限速,可在传输过程中调整
+func (c *Client) SetBandwidthLimit(upload, download int64) {
+	c.control.Bandwidth.SetLimit(upload, download)
+}
+
+// SetRequestLimit 设置client每秒请求数,0为不限制
+func (c *Client) SetRequestLimit(rps int64) {
+	c.control.Limiter.SetLimit(rps)
+}
+
+// SetBucketRequestLimit 设置bucket每秒请求数,0为不限制
+func (c *Client) SetBucketRequestLimit(bucket string, rps int64) {
+	c.control.Limiter.SetBucketLimit(bucket, rps)
+}
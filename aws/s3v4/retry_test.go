@@ -0,0 +1,81 @@
+package s3v4
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shideqin/storage/storagebase"
+	"github.com/shideqin/storage/storagetest"
+)
+
+func newRetryClient() (*storagetest.Server, *Client) {
+	server := storagetest.NewServer()
+	client := New(storagetest.Host, "ak", "sk")
+	client.SetRetryPolicy(&storagebase.RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond})
+	return server, client
+}
+
+func TestUploadPartRetriesMd5Mismatch(t *testing.T) {
+	server, client := newRetryClient()
+	defer server.Close()
+	var attempts int
+	//第一次上传分块的ETag不是内容的md5
+	server.SetRewrite(func(r *http.Request, header http.Header) {
+		if r.Method == http.MethodPut && r.URL.Query().Get("partNumber") != "" {
+			attempts++
+			if attempts == 1 {
+				header.Set("Etag", `"00000000000000000000000000000000"`)
+			}
+		}
+	})
+	initUpload, err := client.InitUpload("bucket", "a.bin", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.UploadPart(bytes.NewReader([]byte("part")), 4, "bucket", "a.bin", 1, initUpload.UploadID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Errorf("UploadPart attempts = %d, want 2", attempts)
+	}
+}
+
+func TestGetRestartsWhenETagChanges(t *testing.T) {
+	server, client := newRetryClient()
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "s3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	body := bytes.Repeat([]byte("0123456789"), 1024)
+	server.PutObject("bucket", "a.bin", body, nil)
+	var heads, ranges int
+	//第一次分块下载时object已被修改
+	server.SetRewrite(func(r *http.Request, header http.Header) {
+		switch {
+		case r.Method == http.MethodHead:
+			heads++
+		case r.Header.Get("Range") != "":
+			ranges++
+			if ranges == 1 {
+				header.Set("Etag", `"changed"`)
+			}
+		}
+	})
+	localFile := filepath.Join(dir, "a.bin")
+	if _, err := client.Get("bucket", "a.bin", localFile, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if heads != 2 {
+		t.Errorf("Head requests = %d, want 2", heads)
+	}
+	if got, _ := ioutil.ReadFile(localFile); !bytes.Equal(got, body) {
+		t.Error("downloaded body differs")
+	}
+}
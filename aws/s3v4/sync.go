@@ -8,27 +8,20 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
-	"time"
 
 	"github.com/shideqin/storage/storagebase"
+	"github.com/shideqin/storage/storageutil"
 )
 
 // SyncLargeFile 分块同步文件
-func (c *Client) SyncLargeFile(toClient storagebase.IClient, bucket, object, source string, options map[string]string, percentChan chan int) (map[string]interface{}, error) {
+func (c *Client) SyncLargeFile(toClient storagebase.IClient, bucket, object, source string, options map[string]string, listener storagebase.ProgressListener) (map[string]interface{}, error) {
 	tmpSourceInfo := strings.Split(source, "/")
 	sourceBucket := tmpSourceInfo[1]
 	sourceObject := strings.Join(tmpSourceInfo[2:], "/")
-	sourceHead, headErr := c.Head(sourceBucket, sourceObject)
+	sourceHead, headErr := c.Head(sourceBucket, sourceObject, storageutil.SourceSSEOptions(options))
 	if headErr != nil {
 		return nil, headErr
 	}
-	var partSize = c.partMaxSize
-	if options["part_size"] != "" {
-		n, err := strconv.Atoi(options["part_size"])
-		if err == nil && n <= c.partMaxSize && n >= c.partMinSize {
-			partSize = n
-		}
-	}
 	var threadNum = c.threadMaxNum
 	if options["thread_num"] != "" {
 		n, err := strconv.Atoi(options["thread_num"])
@@ -47,90 +40,118 @@ func (c *Client) SyncLargeFile(toClient storagebase.IClient, bucket, object, sou
 	if l, ok := sourceHead["Content-Length"]; ok {
 		objectSize, _ = strconv.Atoi(l.(string))
 	}
-	if !(objectSize > 0) {
-		return nil, fmt.Errorf(" SyncLargeFile Object: %s Content-Length cant not zero", object)
+	var sourceETag string
+	if e, ok := sourceHead["Etag"]; ok {
+		sourceETag = e.(string)
+	}
+	partSize, total, layoutErr := storageutil.PartLayout(objectSize, options, c.partMaxSize)
+	if layoutErr != nil {
+		return nil, fmt.Errorf(" SyncLargeFile Object: %s Error: %v", object, layoutErr)
+	}
+	initOptions := storageutil.MetaOptions(storageutil.SSEOptions(storageutil.ContentOptions(map[string]string{"acl": options["acl"]}, options), options), options)
+	initOptions = storageutil.SourceHeaderOptions(initOptions, sourceHead, options)
+	progress := storageutil.NewProgress(listener, "SyncLargeFile", object, int64(objectSize), total)
+	//空文件不能分块上传
+	if total == 0 {
+		put, putErr := toClient.Put(bytes.NewReader(nil), 0, bucket, object, initOptions)
+		if putErr != nil {
+			return nil, putErr
+		}
+		put["PartSize"] = partSize
+		put["PartNum"] = total
+		return put, nil
 	}
-	var total = (objectSize + partSize - 1) / partSize
 	if total < threadNum {
 		threadNum = total
 	}
 
-	//初化化上传
-	initUpload, initErr := toClient.InitUpload(bucket, object, map[string]string{"disposition": options["disposition"], "acl": options["acl"]})
-	if initErr != nil {
-		return nil, initErr
+	//断点续传
+	checkpoint := &storageutil.Checkpoint{Bucket: bucket, Object: object, Source: source, SourceETag: sourceETag, Size: int64(objectSize), PartSize: partSize}
+	resumed := checkpoint.Load(storageutil.CheckpointFile(options, storageutil.TempCheckpointFile(source, bucket, object)))
+	if resumed {
+		var resumeErr error
+		if resumed, resumeErr = checkpoint.Resume(toClient); resumeErr != nil {
+			return nil, fmt.Errorf(" SyncLargeFile Object: %s%v", object, resumeErr)
+		}
 	}
+	if !resumed {
+		//初化化上传
+		initUpload, initErr := toClient.InitUpload(bucket, object, initOptions)
+		if initErr != nil {
+			return nil, initErr
+		}
+		checkpoint.UploadID = initUpload.UploadID
+		checkpoint.Parts = nil
+		if saveErr := checkpoint.Save(); saveErr != nil {
+			return nil, fmt.Errorf(" SyncLargeFile Save checkpoint Error: %v", saveErr)
+		}
+	}
+	uploadID := checkpoint.UploadID
 	var syncPartList = make([]string, total)
-	var queueMaxSize = make(chan bool, threadNum)
-	defer close(queueMaxSize)
-	var partErr error
-	var partExit bool
+	var queueMaxSize = storageutil.NewConcurrency(threadNum, c.control.Throttle)
+	var partErr storageutil.PartError
 	//sync分片
 	var wg sync.WaitGroup
 	for partNum := 0; partNum < total; partNum++ {
-		if partExit {
+		if partErr.Err() != nil {
 			break
 		}
+		//跳过已同步的分块
+		if part, ok := checkpoint.Part(partNum + 1); ok {
+			syncPartList[partNum] = part.ETag
+			progress.Transferred(object, int64(storageutil.PartLength(objectSize, partSize, partNum)))
+			progress.Done(object, nil)
+			continue
+		}
 		wg.Add(1)
-		queueMaxSize <- true
+		queueMaxSize.Acquire()
 		go func(partNum int) {
 			defer func() {
-				if partErr != nil {
-					partExit = true
-				}
 				wg.Done()
-				<-queueMaxSize
+				queueMaxSize.Release()
 			}()
 			//part范围,如：0-1023
 			tmpStart := partNum * partSize
 			tmpEnd := (partNum+1)*partSize - 1
-			if tmpEnd > objectSize {
-				tmpEnd = tmpStart + objectSize%partSize - 1
+			if tmpEnd > objectSize-1 {
+				tmpEnd = objectSize - 1
 			}
 			partRange := fmt.Sprintf("bytes=%d-%d", tmpStart, tmpEnd)
-			partBody := map[string]interface{}{}
-			for i := 0; i < c.maxRetryNum; i++ {
-				cat, syncErr := c.Cat(sourceBucket, sourceObject, partRange)
-				if syncErr != nil {
-					partErr = syncErr
-					continue
-				}
-				partErr = nil
-				partBody = cat
-				break
-			}
-			if partErr != nil {
+			partBody, syncErr := c.Cat(sourceBucket, sourceObject, storageutil.SourceSSEOptions(options), partRange)
+			if syncErr != nil {
+				progress.Done(object, syncErr)
+				partErr.Set(syncErr)
 				return
 			}
 			if _, ok := partBody["Body"]; !ok {
+				syncErr = fmt.Errorf(" SyncLargeFile Object: %s Error: missing Body", object)
+				progress.Done(object, syncErr)
+				partErr.Set(syncErr)
 				return
 			}
 			body := partBody["Body"].(*bytes.Buffer).Bytes()
-			for i := 0; i < c.maxRetryNum; i++ {
-				partReader := bytes.NewReader(body)
-				partReaderSize := int(partReader.Size())
-				uploadPart, syncErr := toClient.UploadPart(partReader, partReaderSize, bucket, object, partNum+1, initUpload.UploadID)
-				if syncErr != nil {
-					partErr = syncErr
-					continue
-				}
-				if _, ok := uploadPart["Etag"]; !ok {
-					continue
-				}
-				partErr = nil
-				syncPartList[partNum] = uploadPart["Etag"].(string)
-				break
+			partReader := bytes.NewReader(body)
+			partReaderSize := int(partReader.Size())
+			uploadPart, syncErr := toClient.UploadPart(progress.Reader(object, partReader), partReaderSize, bucket, object, partNum+1, uploadID, storageutil.SSEOptions(nil, options))
+			if syncErr != nil {
+				progress.Done(object, syncErr)
+				partErr.Set(syncErr)
+				return
 			}
-			if partErr != nil {
+			if _, ok := uploadPart["Etag"]; !ok {
+				syncErr = fmt.Errorf(" SyncLargeFile Object: %s Error: missing Etag", object)
+				progress.Done(object, syncErr)
+				partErr.Set(syncErr)
 				return
 			}
-			percentChan <- total
+			syncPartList[partNum] = uploadPart["Etag"].(string)
+			_ = checkpoint.SetPart(partNum+1, syncPartList[partNum], "")
+			progress.Done(object, nil)
 		}(partNum)
-		partNum++
 	}
 	wg.Wait()
-	if partErr != nil {
-		return nil, partErr
+	if err := partErr.Err(); err != nil {
+		return nil, err
 	}
 	//sync完成
 	completeSyncInfo := "<CompleteMultipartUpload>"
@@ -138,11 +159,18 @@ func (c *Client) SyncLargeFile(toClient storagebase.IClient, bucket, object, sou
 		completeSyncInfo += fmt.Sprintf("<Part><PartNumber>%d</PartNumber><ETag>%s</ETag></Part>", partNum+1, Etag)
 	}
 	completeSyncInfo += "</CompleteMultipartUpload>"
-	return toClient.CompleteUpload([]byte(completeSyncInfo), bucket, object, initUpload.UploadID, objectSize)
+	completeSync, completeErr := toClient.CompleteUpload([]byte(completeSyncInfo), bucket, object, uploadID, objectSize)
+	if completeErr != nil {
+		return nil, completeErr
+	}
+	checkpoint.Remove()
+	completeSync["PartSize"] = partSize
+	completeSync["PartNum"] = total
+	return completeSync, nil
 }
 
 // SyncAllObject 同步目录
-func (c *Client) SyncAllObject(toClient storagebase.IClient, bucket, prefix, source string, options map[string]string, percentChan chan int) (map[string]int, error) {
+func (c *Client) SyncAllObject(toClient storagebase.IClient, bucket, prefix, source string, options map[string]string, listener storagebase.ProgressListener) (map[string]int, error) {
 	if prefix != "" {
 		prefix = strings.TrimSuffix(prefix, "/") + "/"
 	}
@@ -158,14 +186,22 @@ func (c *Client) SyncAllObject(toClient storagebase.IClient, bucket, prefix, sou
 			threadNum = n
 		}
 	}
-	var queueMaxSize = make(chan bool, threadNum)
-	defer close(queueMaxSize)
+	var queueMaxSize = storageutil.NewConcurrency(threadNum, c.control.Throttle)
 	var tmpSize int64
 	var tmpSkip int64
 	var tmpFinish int64
-	var fileErr error
-	var fileExit bool
 	var wg sync.WaitGroup
+	bulk := storageutil.NewBulk("SyncAllObject", options)
+	dryRun := storageutil.DryRun(options)
+	filter, filterErr := storageutil.NewFilter(options)
+	if filterErr != nil {
+		return nil, fmt.Errorf(" SyncAllObject Filter Error: %v", filterErr)
+	}
+	comparer, compareErr := storageutil.NewComparer(options)
+	if compareErr != nil {
+		return nil, fmt.Errorf(" SyncAllObject Compare Error: %v", compareErr)
+	}
+	progress := storageutil.NewProgress(listener, "SyncAllObject", prefix, 0, 0)
 LIST:
 	sourceList, listErr := c.ListObject(sourceBucket, map[string]string{"prefix": sourcePrefix, "marker": marker, "max-keys": "1000"})
 	if listErr != nil {
@@ -173,19 +209,17 @@ LIST:
 	}
 	sourceObjectNum := len(sourceList.Contents)
 	total += sourceObjectNum
+	progress.AddTotal(0, sourceObjectNum)
 	for fileNum := 0; fileNum < sourceObjectNum; fileNum++ {
-		if fileExit {
+		if bulk.Exit() {
 			break
 		}
 		wg.Add(1)
-		queueMaxSize <- true
+		queueMaxSize.Acquire()
 		go func(objectInfo ListObjectContents) {
 			defer func() {
-				if fileErr != nil {
-					fileExit = true
-				}
 				wg.Done()
-				<-queueMaxSize
+				queueMaxSize.Release()
 			}()
 			//支持自定义前缀
 			object := prefix
@@ -194,86 +228,81 @@ LIST:
 			} else {
 				object += path.Base(objectInfo.Key)
 			}
-			isSkipped := false
-			var sourceHead, _ = c.Head(sourceBucket, objectInfo.Key)
-			var disposition string
-			if d, ok := sourceHead["Content-Disposition"]; ok {
-				disposition = d.(string)
-			}
-			var sourceHeadSize int64
-			if l, ok := sourceHead["Content-Length"]; ok {
-				sourceHeadSize, _ = strconv.ParseInt(l.(string), 10, 64)
-			}
-			if options["replace"] != "true" {
-				var objectHead, _ = c.Head(bucket, object)
-				var objectHeadSize int64
-				if l, ok := objectHead["Content-Length"]; ok {
-					objectHeadSize, _ = strconv.ParseInt(l.(string), 10, 64)
+			var action, reason string
+			var itemSize int64
+			err := bulk.Do(objectInfo.Key, func() error {
+				action, reason = "sync", "replace"
+				if ok, why := filter.MatchObject(sourcePrefix, objectInfo); !ok {
+					action, reason = "skip", why
+					atomic.AddInt64(&tmpSkip, 1)
+					return nil
 				}
-				if sourceHeadSize == objectHeadSize {
-					var objectTime, sourceTime time.Time
-					if m, ok := objectHead["Last-Modified"]; ok {
-						objectTime, _ = time.Parse(c.dateTimeGMT, m.(string))
-					}
-					if m, ok := sourceHead["Last-Modified"]; ok {
-						sourceTime, _ = time.Parse(c.dateTimeGMT, m.(string))
-					}
-					if objectTime.Unix() >= sourceTime.Unix() {
-						isSkipped = true
-						atomic.AddInt64(&tmpSkip, 1)
-					}
+				isSkipped := false
+				var sourceHead, _ = c.Head(sourceBucket, objectInfo.Key, storageutil.SourceSSEOptions(options))
+				var sourceHeadSize int64
+				if l, ok := sourceHead["Content-Length"]; ok {
+					sourceHeadSize, _ = strconv.ParseInt(l.(string), 10, 64)
+				}
+				if !comparer.Always() {
+					var objectHead, _ = toClient.Head(bucket, object, options)
+					isSkipped, reason = comparer.Skip(storageutil.HeadState(sourceHead, false), storageutil.HeadState(objectHead, false))
+				}
+				if isSkipped {
+					action = "skip"
+					atomic.AddInt64(&tmpSkip, 1)
 				}
-			}
 
-			if !isSkipped {
-				sourceBody := map[string]interface{}{}
-				for i := 0; i < c.maxRetryNum; i++ {
-					cat, syncErr := c.Cat(sourceBucket, objectInfo.Key)
+				itemSize = sourceHeadSize
+				if !isSkipped && dryRun {
+					atomic.AddInt64(&tmpSize, sourceHeadSize)
+					atomic.AddInt64(&tmpFinish, 1)
+				} else if !isSkipped {
+					//同步原始内容,Content-Encoding等header从源文件复制
+					catOptions := storageutil.SourceSSEOptions(options)
+					catOptions["decompress"] = "false"
+					sourceBody, syncErr := c.Cat(sourceBucket, objectInfo.Key, catOptions)
 					if syncErr != nil {
-						fileErr = syncErr
-						continue
+						return syncErr
 					}
-					fileErr = nil
-					sourceBody = cat
-					break
-				}
-				if fileErr != nil {
-					return
-				}
-				if _, ok := sourceBody["Body"]; !ok {
-					return
-				}
-				body := sourceBody["Body"].(*bytes.Buffer).Bytes()
-				for i := 0; i < c.maxRetryNum; i++ {
+					if _, ok := sourceBody["Body"]; !ok {
+						return nil
+					}
+					body := sourceBody["Body"].(*bytes.Buffer).Bytes()
 					partReader := bytes.NewReader(body)
 					partReaderSize := int(partReader.Size())
-					_, syncErr := toClient.Put(partReader, partReaderSize, bucket, object, map[string]string{"disposition": disposition, "acl": options["acl"]})
-					if syncErr != nil {
-						fileErr = syncErr
-						continue
+					progress.AddTotal(sourceHeadSize, 0)
+					putOptions := storageutil.MetaOptions(storageutil.SSEOptions(storageutil.ContentOptions(map[string]string{"acl": options["acl"]}, options), options), options)
+					putOptions = storageutil.SourceHeaderOptions(putOptions, sourceHead, options)
+					if _, err := toClient.Put(progress.Reader(object, partReader), partReaderSize, bucket, object, putOptions); err != nil {
+						return err
 					}
-					fileErr = nil
-					break
-				}
-				if fileErr != nil {
-					return
+					atomic.AddInt64(&tmpSize, sourceHeadSize)
+					atomic.AddInt64(&tmpFinish, 1)
 				}
-				atomic.AddInt64(&tmpSize, sourceHeadSize)
-				atomic.AddInt64(&tmpFinish, 1)
-			}
-			percentChan <- total
+				return nil
+			})
+			progress.Action(object, action, reason, itemSize, err)
 		}(sourceList.Contents[fileNum])
 	}
 	wg.Wait()
-	if fileErr == nil && sourceList.IsTruncated == "true" {
+	if !bulk.Exit() && sourceList.IsTruncated == "true" {
 		marker = sourceList.Contents[sourceObjectNum-1].Key
 		goto LIST
 	}
-	if fileErr != nil {
-		return nil, fileErr
-	}
 	skip := int(atomic.LoadInt64(&tmpSkip))
 	finish := int(atomic.LoadInt64(&tmpFinish))
 	size := int(atomic.LoadInt64(&tmpSize))
-	return map[string]int{"Total": total, "Skip": skip, "Finish": finish, "Size": size}, nil
+	return bulk.Result(map[string]int{"Total": total, "Skip": skip, "Finish": finish, "Size": size})
+}
+
+// SyncDir 本地目录和bucket/prefix镜像同步,参数见storageutil.SyncDir
+func (c *Client) SyncDir(localDir, bucket, prefix string, options map[string]string, listener storagebase.ProgressListener) (map[string]int, error) {
+	var threadNum = c.threadMaxNum
+	if options["thread_num"] != "" {
+		n, err := strconv.Atoi(options["thread_num"])
+		if err == nil && n <= c.threadMaxNum && n >= c.threadMinNum {
+			threadNum = n
+		}
+	}
+	return storageutil.SyncDir(c, localDir, bucket, prefix, options, listener, threadNum, c.control.Throttle, nil)
 }
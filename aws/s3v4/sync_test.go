@@ -0,0 +1,36 @@
+package s3v4
+
+import (
+	"io"
+	"testing"
+
+	"github.com/shideqin/storage/storagebase"
+	"github.com/shideqin/storage/storagetest"
+)
+
+// noETagClient 分块上传的响应没有ETag
+type noETagClient struct {
+	storagebase.IClient
+}
+
+func (c *noETagClient) UploadPart(body io.Reader, bodySize int, bucket, object string, partNumber int, uploadID string, options map[string]string) (map[string]interface{}, error) {
+	resp, err := c.IClient.UploadPart(body, bodySize, bucket, object, partNumber, uploadID, options)
+	delete(resp, "Etag")
+	return resp, err
+}
+
+func TestSyncLargeFileMissingETag(t *testing.T) {
+	server := storagetest.NewServer()
+	defer server.Close()
+	client := New(storagetest.Host, "ak", "sk")
+	client.SetRetryPolicy(nil)
+	server.PutObject("src", "a.bin", []byte("0123456789"), nil)
+
+	_, err := client.SyncLargeFile(&noETagClient{IClient: client}, "dst", "a.bin", "/src/a.bin", nil, nil)
+	if err == nil {
+		t.Fatal("expected missing Etag error")
+	}
+	if server.Object("dst", "a.bin") != nil {
+		t.Error("upload completed without part ETags")
+	}
+}
@@ -1,3 +1,5 @@
 module mss.git.kkyoo.com/shideqin/storage
 
-go 1.14
+go 1.22
+
+require github.com/klauspost/compress v1.18.0
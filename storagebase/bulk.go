@@ -0,0 +1,28 @@
+package storagebase
+
+import "fmt"
+
+// FailedItem 批量操作中失败的文件
+type FailedItem struct {
+	//失败的object或本地文件
+	Key string
+	//最后一次失败的错误
+	Err error
+	//尝试次数
+	Attempts int
+}
+
+// BulkError 批量操作的失败报告,continue_on_error为true时与统计结果一起返回
+type BulkError struct {
+	Operation string
+	Failures  []FailedItem
+}
+
+// Error 实现error
+func (e *BulkError) Error() string {
+	if len(e.Failures) == 0 {
+		return fmt.Sprintf(" %s Failed: 0", e.Operation)
+	}
+	first := e.Failures[0]
+	return fmt.Sprintf(" %s Failed: %d First: %s Error: %v", e.Operation, len(e.Failures), first.Key, first.Err)
+}
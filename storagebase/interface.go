@@ -6,36 +6,49 @@ import (
 
 // IClient Client 客户端结构
 type IClient interface {
+	SetRetryPolicy(policy *RetryPolicy)
+	SetBandwidthLimit(upload, download int64)
+	SetRequestLimit(rps int64)
+	SetBucketRequestLimit(bucket string, rps int64)
+
 	GetService() (*ServiceResult, error)
 	CreateBucket(bucket string, options map[string]string) (map[string]interface{}, error)
 	DeleteBucket(bucket string) (map[string]interface{}, error)
 	ListPart(bucket string, options map[string]string) (*ListPartsResult, error)
-	DeleteAllPart(bucket, prefix string, options map[string]string, percentChan chan int) (map[string]int, error)
+	DeleteAllPart(bucket, prefix string, options map[string]string, listener ProgressListener) (map[string]int, error)
 	GetACL(bucket string) (*AclResult, error)
 	SetACL(bucket string, options map[string]string) (map[string]interface{}, error)
 
-	UploadLargeFile(filePath, bucket, object string, options map[string]string, percentChan chan int) (map[string]interface{}, error)
-	CopyLargeFile(bucket, object, source string, options map[string]string, percentChan chan int, exitChan <-chan bool) (map[string]interface{}, error)
+	UploadLargeFile(filePath, bucket, object string, options map[string]string, listener ProgressListener) (map[string]interface{}, error)
+	CopyLargeFile(bucket, object, source string, options map[string]string, listener ProgressListener, exitChan <-chan bool) (map[string]interface{}, error)
 	InitUpload(bucket, object string, options map[string]string) (*InitUploadResult, error)
-	UploadPart(body io.Reader, bodySize int, bucket, object string, partNumber int, uploadID string) (map[string]interface{}, error)
+	UploadPart(body io.Reader, bodySize int, bucket, object string, partNumber int, uploadID string, options map[string]string) (map[string]interface{}, error)
 	CancelPart(bucket, object string, uploadID string) (map[string]interface{}, error)
-	CopyPart(partRange, bucket, object, source string, partNumber int, uploadID string, exitChan <-chan bool) (map[string]string, error)
+	ListUploadedParts(bucket, object, uploadID string, options map[string]string) (*ListUploadedPartsResult, error)
+	CopyPart(partRange, bucket, object, source string, partNumber int, uploadID string, options map[string]string, exitChan <-chan bool) (map[string]string, error)
 	CompleteUpload(body []byte, bucket, object, uploadID string, objectSize int) (map[string]interface{}, error)
 
-	SyncLargeFile(toClient IClient, bucket, object, source string, options map[string]string, percentChan chan int) (map[string]interface{}, error)
-	SyncAllObject(toClient IClient, bucket, prefix, source string, options map[string]string, percentChan chan int) (map[string]int, error)
+	SyncLargeFile(toClient IClient, bucket, object, source string, options map[string]string, listener ProgressListener) (map[string]interface{}, error)
+	SyncAllObject(toClient IClient, bucket, prefix, source string, options map[string]string, listener ProgressListener) (map[string]int, error)
+	SyncDir(localDir, bucket, prefix string, options map[string]string, listener ProgressListener) (map[string]int, error)
 
+	Upload(filePath, bucket, object string, options map[string]string, listener ProgressListener) (map[string]interface{}, error)
+	CopyObject(bucket, object, source string, options map[string]string, listener ProgressListener) (map[string]interface{}, error)
 	UploadFile(filePath, bucket, object string, options map[string]string) (map[string]interface{}, error)
 	Put(body io.Reader, bodySize int, bucket, object string, options map[string]string) (map[string]interface{}, error)
 	Copy(bucket, object, source string, options map[string]string) (map[string]interface{}, error)
 	Delete(bucket, object string) (map[string]interface{}, error)
-	Head(bucket, object string) (map[string]interface{}, error)
-	Get(bucket, object, localFile string, options map[string]string, percentChan chan int) (map[string]string, error)
-	Cat(bucket, object string, param ...string) (map[string]interface{}, error)
-	UploadFromDir(localDir, bucket, prefix string, options map[string]string, percentChan chan int) (map[string]int, error)
+	PutObjectTagging(bucket, object string, tags map[string]string) (map[string]interface{}, error)
+	RestoreObject(bucket, object string, days int, options map[string]string) (map[string]interface{}, error)
+	Head(bucket, object string, options map[string]string) (map[string]interface{}, error)
+	Get(bucket, object, localFile string, options map[string]string, listener ProgressListener) (map[string]string, error)
+	Cat(bucket, object string, options map[string]string, param ...string) (map[string]interface{}, error)
+	UploadFromDir(localDir, bucket, prefix string, options map[string]string, listener ProgressListener) (map[string]int, error)
 	ListObject(bucket string, options map[string]string) (*ListObjectResult, error)
-	CopyAllObject(bucket, prefix, source string, options map[string]string, percentChan chan int) (map[string]int, error)
-	DeleteAllObject(bucket, prefix string, options map[string]string, percentChan chan int) (map[string]int, error)
-	MoveAllObject(bucket, prefix, source string, options map[string]string, percentChan chan int) (map[string]int, error)
-	DownloadAllObject(bucket, prefix, localDir string, options map[string]string, percentChan chan int) (map[string]int, error)
+	CopyAllObject(bucket, prefix, source string, options map[string]string, listener ProgressListener) (map[string]int, error)
+	DeleteAllObject(bucket, prefix string, options map[string]string, listener ProgressListener) (map[string]int, error)
+	DeleteObjects(bucket string, objects []ObjectIdentifier, options map[string]string, listener ProgressListener) ([]DeleteObjectResult, error)
+	RunManifest(manifestFile string, options map[string]string, listener ProgressListener) (map[string]int, error)
+	MoveAllObject(bucket, prefix, source string, options map[string]string, listener ProgressListener) (map[string]int, error)
+	DownloadAllObject(bucket, prefix, localDir string, options map[string]string, listener ProgressListener) (map[string]int, error)
 }
@@ -0,0 +1,130 @@
+package storagebase
+
+import (
+	"io"
+	"sync"
+)
+
+// LegacyClient 旧版IClient的方法签名,Head和Cat没有options,UploadPart和CopyPart没有options,进度使用percentChan
+// Deprecated: 使用IClient,旧代码可以通过NewLegacyClient过渡
+type LegacyClient interface {
+	GetService() (*ServiceResult, error)
+	CreateBucket(bucket string, options map[string]string) (map[string]interface{}, error)
+	DeleteBucket(bucket string) (map[string]interface{}, error)
+	ListPart(bucket string, options map[string]string) (*ListPartsResult, error)
+	DeleteAllPart(bucket, prefix string, options map[string]string, percentChan chan int) (map[string]int, error)
+	GetACL(bucket string) (*AclResult, error)
+	SetACL(bucket string, options map[string]string) (map[string]interface{}, error)
+
+	UploadLargeFile(filePath, bucket, object string, options map[string]string, percentChan chan int) (map[string]interface{}, error)
+	CopyLargeFile(bucket, object, source string, options map[string]string, percentChan chan int, exitChan <-chan bool) (map[string]interface{}, error)
+	InitUpload(bucket, object string, options map[string]string) (*InitUploadResult, error)
+	UploadPart(body io.Reader, bodySize int, bucket, object string, partNumber int, uploadID string) (map[string]interface{}, error)
+	CancelPart(bucket, object string, uploadID string) (map[string]interface{}, error)
+	CopyPart(partRange, bucket, object, source string, partNumber int, uploadID string, exitChan <-chan bool) (map[string]string, error)
+	CompleteUpload(body []byte, bucket, object, uploadID string, objectSize int) (map[string]interface{}, error)
+
+	SyncLargeFile(toClient IClient, bucket, object, source string, options map[string]string, percentChan chan int) (map[string]interface{}, error)
+	SyncAllObject(toClient IClient, bucket, prefix, source string, options map[string]string, percentChan chan int) (map[string]int, error)
+
+	UploadFile(filePath, bucket, object string, options map[string]string) (map[string]interface{}, error)
+	Put(body io.Reader, bodySize int, bucket, object string, options map[string]string) (map[string]interface{}, error)
+	Copy(bucket, object, source string, options map[string]string) (map[string]interface{}, error)
+	Delete(bucket, object string) (map[string]interface{}, error)
+	Head(bucket, object string) (map[string]interface{}, error)
+	Get(bucket, object, localFile string, options map[string]string, percentChan chan int) (map[string]string, error)
+	Cat(bucket, object string, param ...string) (map[string]interface{}, error)
+	UploadFromDir(localDir, bucket, prefix string, options map[string]string, percentChan chan int) (map[string]int, error)
+	ListObject(bucket string, options map[string]string) (*ListObjectResult, error)
+	CopyAllObject(bucket, prefix, source string, options map[string]string, percentChan chan int) (map[string]int, error)
+	DeleteAllObject(bucket, prefix string, options map[string]string, percentChan chan int) (map[string]int, error)
+	MoveAllObject(bucket, prefix, source string, options map[string]string, percentChan chan int) (map[string]int, error)
+	DownloadAllObject(bucket, prefix, localDir string, options map[string]string, percentChan chan int) (map[string]int, error)
+}
+
+// NewLegacyClient 将IClient包装为旧版接口,SyncLargeFile和SyncAllObject的toClient使用IClient
+// Deprecated: 直接使用IClient
+func NewLegacyClient(client IClient) LegacyClient {
+	return &legacyClient{IClient: client}
+}
+
+type legacyClient struct {
+	IClient
+}
+
+func (c *legacyClient) DeleteAllPart(bucket, prefix string, options map[string]string, percentChan chan int) (map[string]int, error) {
+	return c.IClient.DeleteAllPart(bucket, prefix, options, PercentChan(percentChan))
+}
+
+func (c *legacyClient) UploadLargeFile(filePath, bucket, object string, options map[string]string, percentChan chan int) (map[string]interface{}, error) {
+	return c.IClient.UploadLargeFile(filePath, bucket, object, options, PercentChan(percentChan))
+}
+
+func (c *legacyClient) CopyLargeFile(bucket, object, source string, options map[string]string, percentChan chan int, exitChan <-chan bool) (map[string]interface{}, error) {
+	return c.IClient.CopyLargeFile(bucket, object, source, options, PercentChan(percentChan), exitChan)
+}
+
+func (c *legacyClient) UploadPart(body io.Reader, bodySize int, bucket, object string, partNumber int, uploadID string) (map[string]interface{}, error) {
+	return c.IClient.UploadPart(body, bodySize, bucket, object, partNumber, uploadID, nil)
+}
+
+func (c *legacyClient) CopyPart(partRange, bucket, object, source string, partNumber int, uploadID string, exitChan <-chan bool) (map[string]string, error) {
+	return c.IClient.CopyPart(partRange, bucket, object, source, partNumber, uploadID, nil, exitChan)
+}
+
+func (c *legacyClient) SyncLargeFile(toClient IClient, bucket, object, source string, options map[string]string, percentChan chan int) (map[string]interface{}, error) {
+	return c.IClient.SyncLargeFile(toClient, bucket, object, source, options, PercentChan(percentChan))
+}
+
+func (c *legacyClient) SyncAllObject(toClient IClient, bucket, prefix, source string, options map[string]string, percentChan chan int) (map[string]int, error) {
+	return c.IClient.SyncAllObject(toClient, bucket, prefix, source, options, PercentChan(percentChan))
+}
+
+func (c *legacyClient) Head(bucket, object string) (map[string]interface{}, error) {
+	return c.IClient.Head(bucket, object, nil)
+}
+
+func (c *legacyClient) Get(bucket, object, localFile string, options map[string]string, percentChan chan int) (map[string]string, error) {
+	return c.IClient.Get(bucket, object, localFile, options, PercentChan(percentChan))
+}
+
+func (c *legacyClient) Cat(bucket, object string, param ...string) (map[string]interface{}, error) {
+	return c.IClient.Cat(bucket, object, nil, param...)
+}
+
+func (c *legacyClient) UploadFromDir(localDir, bucket, prefix string, options map[string]string, percentChan chan int) (map[string]int, error) {
+	return c.IClient.UploadFromDir(localDir, bucket, prefix, options, PercentChan(percentChan))
+}
+
+func (c *legacyClient) CopyAllObject(bucket, prefix, source string, options map[string]string, percentChan chan int) (map[string]int, error) {
+	return c.IClient.CopyAllObject(bucket, prefix, source, options, PercentChan(percentChan))
+}
+
+func (c *legacyClient) DeleteAllObject(bucket, prefix string, options map[string]string, percentChan chan int) (map[string]int, error) {
+	return c.IClient.DeleteAllObject(bucket, prefix, options, PercentChan(percentChan))
+}
+
+func (c *legacyClient) MoveAllObject(bucket, prefix, source string, options map[string]string, percentChan chan int) (map[string]int, error) {
+	return c.IClient.MoveAllObject(bucket, prefix, source, options, PercentChan(percentChan))
+}
+
+func (c *legacyClient) DownloadAllObject(bucket, prefix, localDir string, options map[string]string, percentChan chan int) (map[string]int, error) {
+	return c.IClient.DownloadAllObject(bucket, prefix, localDir, options, PercentChan(percentChan))
+}
+
+// PercentChan 将旧版的percentChan转换为ProgressListener,与旧版一样每完成一个分块或文件向percentChan发送一次总数
+// percentChan为nil时返回nil
+func PercentChan(percentChan chan int) ProgressListener {
+	if percentChan == nil {
+		return nil
+	}
+	var lock sync.Mutex
+	var done int
+	return ProgressFunc(func(event *ProgressEvent) {
+		lock.Lock()
+		defer lock.Unlock()
+		for ; done < event.DoneItems; done++ {
+			percentChan <- event.TotalItems
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package storagebase_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/shideqin/storage/aws/s3v4"
+	"github.com/shideqin/storage/storagebase"
+	"github.com/shideqin/storage/storagetest"
+)
+
+func TestPercentChan(t *testing.T) {
+	if storagebase.PercentChan(nil) != nil {
+		t.Error("PercentChan(nil) != nil")
+	}
+	percentChan := make(chan int, 10)
+	listener := storagebase.PercentChan(percentChan)
+	//只传输字节不发送,完成2个时补发
+	for _, done := range []int{0, 0, 2, 2, 3} {
+		listener.ProgressChanged(&storagebase.ProgressEvent{DoneItems: done, TotalItems: 3})
+	}
+	close(percentChan)
+	var got []int
+	for total := range percentChan {
+		got = append(got, total)
+	}
+	if len(got) != 3 || got[0] != 3 || got[2] != 3 {
+		t.Errorf("percentChan received %v, want [3 3 3]", got)
+	}
+}
+
+func TestLegacyClient(t *testing.T) {
+	server := storagetest.NewServer()
+	defer server.Close()
+	client := s3v4.New(storagetest.Host, "ak", "sk")
+	client.SetRetryPolicy(nil)
+	legacy := storagebase.NewLegacyClient(client)
+	dir, err := ioutil.TempDir("", "storagebase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data := bytes.Repeat([]byte("0123456789"), 300*1024)
+	server.PutObject("bucket", "a.bin", data, nil)
+
+	if head, err := legacy.Head("bucket", "a.bin"); err != nil || head["Content-Length"] != strconv.Itoa(len(data)) {
+		t.Errorf("Head = %v, %v", head, err)
+	}
+	if cat, err := legacy.Cat("bucket", "a.bin", "bytes=0-9"); err != nil || cat["Body"].(*bytes.Buffer).String() != "0123456789" {
+		t.Errorf("Cat range: %v", err)
+	}
+	//每个分片完成时发送一次分片总数
+	percentChan := make(chan int, 10)
+	localFile := filepath.Join(dir, "a.bin")
+	if _, err := legacy.Get("bucket", "a.bin", localFile, map[string]string{"part_size": strconv.Itoa(1024 * 1024)}, percentChan); err != nil {
+		t.Fatal(err)
+	}
+	close(percentChan)
+	count := 0
+	for total := range percentChan {
+		if total != 3 {
+			t.Errorf("percentChan received %d, want 3", total)
+		}
+		count++
+	}
+	if count != 3 {
+		t.Errorf("percentChan received %d times, want 3", count)
+	}
+	if got, err := ioutil.ReadFile(localFile); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("downloaded file differs: %v", err)
+	}
+}
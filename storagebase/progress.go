@@ -0,0 +1,40 @@
+package storagebase
+
+// ProgressEvent 进度事件
+type ProgressEvent struct {
+	//操作名称,如UploadLargeFile,DownloadAllObject
+	Operation string
+	//当前分块或文件对应的object
+	Key string
+	//已传输字节数和总字节数,总字节数为0时未知
+	TransferredBytes int64
+	TotalBytes       int64
+	//已完成的分块或文件数和总数
+	DoneItems  int
+	TotalItems int
+	//平均速度,字节/秒
+	Throughput float64
+	//分块或文件失败时的错误
+	Err error
+	//批量操作中文件的处理方式,如upload,copy,delete,skip,dry_run时为计划的处理方式
+	Action string
+	//处理方式的原因,如not_found,changed,up_to_date
+	Reason string
+	//文件大小
+	Size int64
+	//总数是否仍在统计,如目录边遍历边上传时
+	Estimating bool
+}
+
+// ProgressListener 进度监听
+type ProgressListener interface {
+	ProgressChanged(event *ProgressEvent)
+}
+
+// ProgressFunc 函数形式的进度监听
+type ProgressFunc func(event *ProgressEvent)
+
+// ProgressChanged 实现ProgressListener
+func (f ProgressFunc) ProgressChanged(event *ProgressEvent) {
+	f(event)
+}
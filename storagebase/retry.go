@@ -0,0 +1,86 @@
+package storagebase
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy 请求重试策略
+type RetryPolicy struct {
+	//最大尝试次数,包含第一次请求
+	MaxAttempts int
+	//第一次重试的等待时间,之后按指数增长
+	BaseBackoff time.Duration
+	//最大等待时间
+	MaxBackoff time.Duration
+	//随机抖动比例,0-1
+	Jitter float64
+	//需要重试的http状态码
+	RetryableStatusCodes []int
+	//需要重试的错误码,如SlowDown
+	RetryableErrorCodes []string
+}
+
+// DefaultRetryPolicy 默认重试策略
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:          5,
+		BaseBackoff:          200 * time.Millisecond,
+		MaxBackoff:           20 * time.Second,
+		Jitter:               0.5,
+		RetryableStatusCodes: []int{429, 500, 502, 503, 504},
+		RetryableErrorCodes:  []string{"SlowDown", "RequestTimeout", "InternalError", "ServiceUnavailable", "Throttling", "ThrottlingException", "RequestLimitExceeded"},
+	}
+}
+
+// ShouldRetry 判断第attempt次请求失败后是否需要重试,err不为nil时为网络错误
+func (p *RetryPolicy) ShouldRetry(attempt, statusCode int, errorCode string, err error) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	for _, code := range p.RetryableErrorCodes {
+		if errorCode != "" && code == errorCode {
+			return true
+		}
+	}
+	for _, code := range p.RetryableStatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff 第attempt次请求失败后的等待时间,retryAfter为响应的Retry-After header
+func (p *RetryPolicy) Backoff(attempt int, retryAfter string) time.Duration {
+	if retryAfter != "" {
+		var wait time.Duration
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			wait = time.Duration(seconds) * time.Second
+		} else if t, err := http.ParseTime(retryAfter); err == nil {
+			wait = time.Until(t)
+		}
+		if wait > 0 {
+			if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+				wait = p.MaxBackoff
+			}
+			return wait
+		}
+	}
+	wait := time.Duration(float64(p.BaseBackoff) * math.Pow(2, float64(attempt-1)))
+	if p.MaxBackoff > 0 && (wait > p.MaxBackoff || wait < 0) {
+		wait = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		wait -= time.Duration(rand.Float64() * p.Jitter * float64(wait))
+	}
+	return wait
+}
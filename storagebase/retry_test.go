@@ -0,0 +1,71 @@
+package storagebase
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := &RetryPolicy{BaseBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	tests := []struct {
+		attempt    int
+		retryAfter string
+		want       time.Duration
+	}{
+		{1, "", 100 * time.Millisecond},
+		{2, "", 200 * time.Millisecond},
+		{4, "", 800 * time.Millisecond},
+		{5, "", time.Second},
+		{100, "", time.Second},
+		{1, "0", 100 * time.Millisecond},
+		{1, "abc", 100 * time.Millisecond},
+		{1, "5", time.Second},
+		{1, time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := p.Backoff(tt.attempt, tt.retryAfter); got != tt.want {
+			t.Errorf("Backoff(%d, %q) = %v, want %v", tt.attempt, tt.retryAfter, got, tt.want)
+		}
+	}
+
+	//Retry-After未超过MaxBackoff时按Retry-After等待
+	p.MaxBackoff = time.Minute
+	if got := p.Backoff(1, "3"); got != 3*time.Second {
+		t.Errorf("Backoff(1, \"3\") = %v, want 3s", got)
+	}
+	//抖动只减少等待时间
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.Backoff(3, ""); got > 400*time.Millisecond || got < 200*time.Millisecond {
+			t.Fatalf("Backoff with jitter = %v, want 200ms-400ms", got)
+		}
+	}
+}
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	p := DefaultRetryPolicy()
+	tests := []struct {
+		name       string
+		attempt    int
+		statusCode int
+		errorCode  string
+		err        error
+		want       bool
+	}{
+		{"ok", 1, 200, "", nil, false},
+		{"not found", 1, 404, "NoSuchKey", nil, false},
+		{"server error", 1, 500, "", nil, true},
+		{"slow down", 1, 400, "SlowDown", nil, true},
+		{"network", 1, 0, "", errors.New("connection reset"), true},
+		{"canceled", 1, 0, "", context.Canceled, false},
+		{"last attempt", p.MaxAttempts, 503, "", nil, false},
+	}
+	for _, tt := range tests {
+		if got := p.ShouldRetry(tt.attempt, tt.statusCode, tt.errorCode, tt.err); got != tt.want {
+			t.Errorf("%s: ShouldRetry = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -29,14 +29,57 @@ type AclResult struct {
 
 // ListPartsResult 获取分块列表结果
 type ListPartsResult struct {
+	Bucket             string `xml:"Bucket"`
+	Prefix             string `xml:"Prefix"`
+	Delimiter          string `xml:"Delimiter"`
+	KeyMarker          string `xml:"KeyMarker"`
+	UploadIDMarker     string `xml:"UploadIdMarker"`
 	NextKeyMarker      string `xml:"NextKeyMarker"`
 	NextUploadIDMarker string `xml:"NextUploadIdMarker"`
+	MaxUploads         string `xml:"MaxUploads"`
 	IsTruncated        string `xml:"IsTruncated"`
 	Upload             []struct {
-		Key       string `xml:"Key"`
-		UploadID  string `xml:"UploadId"`
-		Initiated string `xml:"Initiated"`
+		Key          string    `xml:"Key"`
+		UploadID     string    `xml:"UploadId"`
+		Initiated    string    `xml:"Initiated"`
+		StorageClass string    `xml:"StorageClass"`
+		Initiator    Initiator `xml:"Initiator"`
+		Owner        Initiator `xml:"Owner"`
 	} `xml:"Upload"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+}
+
+// Initiator 分块上传的发起者和所有者
+type Initiator struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+// ListUploadedPartsResult 获取已上传分块列表结果
+type ListUploadedPartsResult struct {
+	Bucket               string             `xml:"Bucket"`
+	Key                  string             `xml:"Key"`
+	UploadID             string             `xml:"UploadId"`
+	PartNumberMarker     string             `xml:"PartNumberMarker"`
+	NextPartNumberMarker string             `xml:"NextPartNumberMarker"`
+	MaxParts             string             `xml:"MaxParts"`
+	IsTruncated          string             `xml:"IsTruncated"`
+	StorageClass         string             `xml:"StorageClass"`
+	Initiator            Initiator          `xml:"Initiator"`
+	Owner                Initiator          `xml:"Owner"`
+	Part                 []UploadedPartInfo `xml:"Part"`
+}
+
+// UploadedPartInfo 已上传分块信息
+type UploadedPartInfo struct {
+	PartNumber     int    `xml:"PartNumber"`
+	LastModified   string `xml:"LastModified"`
+	ETag           string `xml:"ETag"`
+	Size           int    `xml:"Size"`
+	ChecksumCRC32C string `xml:"ChecksumCRC32C"`
+	ChecksumSHA256 string `xml:"ChecksumSHA256"`
 }
 
 // InitUploadResult 初始化上传结果
@@ -91,3 +134,36 @@ type ListObjectContents struct {
 	Size         int    `xml:"Size"`
 	StorageClass string `xml:"StorageClass"`
 }
+
+// ObjectIdentifier 批量删除的object,VersionID为空时删除当前版本
+type ObjectIdentifier struct {
+	Key       string
+	VersionID string
+}
+
+// DeleteObjectResult 批量删除中每个object的结果,Err为nil时删除成功
+type DeleteObjectResult struct {
+	Key       string
+	VersionID string
+	Err       error
+}
+
+// DeleteResult 批量删除结果,Quiet模式下只返回失败的object
+type DeleteResult struct {
+	Deleted []DeletedObject `xml:"Deleted"`
+	Error   []DeleteError   `xml:"Error"`
+}
+
+// DeletedObject 删除成功的object
+type DeletedObject struct {
+	Key       string `xml:"Key"`
+	VersionID string `xml:"VersionId"`
+}
+
+// DeleteError 删除失败的object
+type DeleteError struct {
+	Key       string `xml:"Key"`
+	VersionID string `xml:"VersionId"`
+	Code      string `xml:"Code"`
+	Message   string `xml:"Message"`
+}
@@ -0,0 +1,75 @@
+package storagecrypto
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/shideqin/storage/storageutil"
+)
+
+// encryptCheckpoint 断点续传时加密临时文件对应的源文件信息和加密信封
+type encryptCheckpoint struct {
+	Size    int64             `json:"size"`
+	ModTime int64             `json:"mod_time"`
+	Meta    map[string]string `json:"meta"`
+}
+
+// encryptTempFile 断点续传时固定的加密临时文件路径
+func encryptTempFile(filePath, bucket, object string) string {
+	if abs, err := filepath.Abs(filePath); err == nil {
+		filePath = abs
+	}
+	name := hex.EncodeToString(storageutil.Md5Byte([]byte(filePath + "|" + bucket + "/" + object)))
+	return filepath.Join(os.TempDir(), "storagecrypto-"+name+".enc")
+}
+
+// createTempFile 创建加密临时文件,file为空时使用随机文件名
+func createTempFile(file string) (*os.File, error) {
+	if file == "" {
+		return ioutil.TempFile("", "storagecrypto")
+	}
+	return os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+}
+
+// loadEncryptCheckpoint 源文件未修改且临时文件完整时返回保存的加密信封,否则返回nil
+func (c *Client) loadEncryptCheckpoint(tmpFile string, fi os.FileInfo) *envelope {
+	data, err := ioutil.ReadFile(tmpFile + ".env")
+	if err != nil {
+		return nil
+	}
+	var cp encryptCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil || cp.Size != fi.Size() || cp.ModTime != fi.ModTime().UnixNano() {
+		return nil
+	}
+	head := make(map[string]interface{}, len(cp.Meta))
+	for k, v := range cp.Meta {
+		head[k] = v
+	}
+	env, err := c.openEnvelope(head)
+	if err != nil || env == nil || env.contentLength != fi.Size() {
+		return nil
+	}
+	tmpStat, err := os.Stat(tmpFile)
+	if err != nil || tmpStat.Size() != env.cipherSize() {
+		return nil
+	}
+	return env
+}
+
+// saveEncryptCheckpoint 保存加密信封,续传时使用同一个数据密钥
+func saveEncryptCheckpoint(tmpFile string, fi os.FileInfo, env *envelope) error {
+	data, err := json.Marshal(encryptCheckpoint{Size: fi.Size(), ModTime: fi.ModTime().UnixNano(), Meta: env.options(nil)})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(tmpFile+".env", data, 0600)
+}
+
+// removeEncryptCheckpoint 删除加密临时文件和保存的加密信封
+func removeEncryptCheckpoint(tmpFile string) {
+	_ = os.Remove(tmpFile)
+	_ = os.Remove(tmpFile + ".env")
+}
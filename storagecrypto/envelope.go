@@ -0,0 +1,262 @@
+package storagecrypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	dataKeySize = 32
+	nonceSize   = 12
+	tagSize     = 16
+
+	envelopeAlgorithm = "AES/GCM/Chunked"
+
+	metaKey           = "x-amz-meta-envelope-key"
+	metaIV            = "x-amz-meta-envelope-iv"
+	metaAlgorithm     = "x-amz-meta-envelope-alg"
+	metaMatDesc       = "x-amz-meta-envelope-matdesc"
+	metaChunkSize     = "x-amz-meta-envelope-chunk-size"
+	metaContentLength = "x-amz-meta-envelope-content-length"
+)
+
+// envelope 加密信封,保存在object元数据中
+type envelope struct {
+	wrappedKey    []byte
+	iv            []byte
+	matDesc       string
+	chunkSize     int
+	contentLength int64
+	aead          cipher.AEAD
+}
+
+// newEnvelope 生成新的数据密钥并用主密钥包装
+func (c *Client) newEnvelope() (*envelope, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, fmt.Errorf(" Envelope Error: %v", err)
+	}
+	iv := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, fmt.Errorf(" Envelope Error: %v", err)
+	}
+	wrappedKey, matDesc, err := c.masterKey.WrapKey(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &envelope{
+		wrappedKey: wrappedKey,
+		iv:         iv,
+		matDesc:    matDesc,
+		chunkSize:  c.chunkSize,
+		aead:       aead,
+	}, nil
+}
+
+// openEnvelope 从Head结果中读取信封并解包数据密钥,未加密的object返回nil
+func (c *Client) openEnvelope(head map[string]interface{}) (*envelope, error) {
+	meta := make(map[string]string)
+	for k, v := range head {
+		if s, ok := v.(string); ok {
+			meta[strings.ToLower(k)] = s
+		}
+	}
+	if meta[metaKey] == "" {
+		return nil, nil
+	}
+	if meta[metaAlgorithm] != envelopeAlgorithm {
+		return nil, fmt.Errorf(" Envelope Algorithm: %s Error: not supported", meta[metaAlgorithm])
+	}
+	wrappedKey, err := base64.StdEncoding.DecodeString(meta[metaKey])
+	if err != nil {
+		return nil, fmt.Errorf(" Envelope Key Error: %v", err)
+	}
+	iv, err := base64.StdEncoding.DecodeString(meta[metaIV])
+	if err != nil || len(iv) != nonceSize {
+		return nil, fmt.Errorf(" Envelope IV Error: invalid iv")
+	}
+	chunkSize, err := strconv.Atoi(meta[metaChunkSize])
+	if err != nil || chunkSize <= 0 {
+		return nil, fmt.Errorf(" Envelope ChunkSize Error: invalid chunk size")
+	}
+	contentLength, err := strconv.ParseInt(meta[metaContentLength], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf(" Envelope ContentLength Error: %v", err)
+	}
+	dataKey, err := c.masterKey.UnwrapKey(wrappedKey, meta[metaMatDesc])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &envelope{
+		wrappedKey:    wrappedKey,
+		iv:            iv,
+		matDesc:       meta[metaMatDesc],
+		chunkSize:     chunkSize,
+		contentLength: contentLength,
+		aead:          aead,
+	}, nil
+}
+
+// options 将信封写入上传参数的元数据
+func (e *envelope) options(options map[string]string) map[string]string {
+	opts := make(map[string]string, len(options)+6)
+	for k, v := range options {
+		opts[k] = v
+	}
+	opts[metaKey] = base64.StdEncoding.EncodeToString(e.wrappedKey)
+	opts[metaIV] = base64.StdEncoding.EncodeToString(e.iv)
+	opts[metaAlgorithm] = envelopeAlgorithm
+	opts[metaMatDesc] = e.matDesc
+	opts[metaChunkSize] = strconv.Itoa(e.chunkSize)
+	opts[metaContentLength] = strconv.FormatInt(e.contentLength, 10)
+	return opts
+}
+
+// chunks 密文分块数,空文件也有一个空的分块,用于认证明文长度
+func (e *envelope) chunks() int64 {
+	chunkSize := int64(e.chunkSize)
+	if e.contentLength == 0 {
+		return 1
+	}
+	return (e.contentLength + chunkSize - 1) / chunkSize
+}
+
+// cipherSize 密文长度
+func (e *envelope) cipherSize() int64 {
+	return e.contentLength + e.chunks()*tagSize
+}
+
+// nonce 每个分块的nonce为iv与分块序号异或
+func (e *envelope) nonce(index int64) []byte {
+	nonce := make([]byte, nonceSize)
+	copy(nonce, e.iv)
+	tail := binary.BigEndian.Uint64(nonce[nonceSize-8:]) ^ uint64(index)
+	binary.BigEndian.PutUint64(nonce[nonceSize-8:], tail)
+	return nonce
+}
+
+// aad 分块的附加认证数据,绑定分块大小,明文长度,分块序号和是否为最后一块
+// 元数据被修改,分块被替换、重排或在分块边界截断时解密失败
+func (e *envelope) aad(index int64) []byte {
+	aad := make([]byte, 25)
+	binary.BigEndian.PutUint64(aad[0:], uint64(e.chunkSize))
+	binary.BigEndian.PutUint64(aad[8:], uint64(e.contentLength))
+	binary.BigEndian.PutUint64(aad[16:], uint64(index))
+	if index == e.chunks()-1 {
+		aad[24] = 1
+	}
+	return aad
+}
+
+// chunkLength 第index个分块的明文长度
+func (e *envelope) chunkLength(index int64) int {
+	length := e.contentLength - index*int64(e.chunkSize)
+	if length > int64(e.chunkSize) {
+		length = int64(e.chunkSize)
+	}
+	return int(length)
+}
+
+// encrypt 分块加密r中size字节的明文写入w,r的长度与size不一致时返回错误
+func (e *envelope) encrypt(w io.Writer, r io.Reader, size int64) (int64, error) {
+	e.contentLength = size
+	buf := make([]byte, e.chunkSize)
+	for index := int64(0); index < e.chunks(); index++ {
+		plain := buf[:e.chunkLength(index)]
+		if _, err := io.ReadFull(r, plain); err != nil {
+			return index * int64(e.chunkSize), fmt.Errorf(" Encrypt Chunk: %d Error: %v", index, err)
+		}
+		if _, err := w.Write(e.aead.Seal(nil, e.nonce(index), plain, e.aad(index))); err != nil {
+			return index * int64(e.chunkSize), err
+		}
+	}
+	if n, _ := io.ReadFull(r, buf[:1]); n > 0 {
+		return size, fmt.Errorf(" Encrypt Error: body longer than %d", size)
+	}
+	return size, nil
+}
+
+// decrypt 解密r中从第first到第last个分块写入w,返回明文长度,缺少分块或有多余的数据时返回错误
+func (e *envelope) decrypt(w io.Writer, r io.Reader, first, last int64) (int64, error) {
+	var size int64
+	buf := make([]byte, e.chunkSize+tagSize)
+	for index := first; index <= last; index++ {
+		cipherChunk := buf[:e.chunkLength(index)+tagSize]
+		if _, err := io.ReadFull(r, cipherChunk); err != nil {
+			return size, fmt.Errorf(" Decrypt Chunk: %d Error: truncated chunk", index)
+		}
+		plain, oErr := e.aead.Open(nil, e.nonce(index), cipherChunk, e.aad(index))
+		if oErr != nil {
+			return size, fmt.Errorf(" Decrypt Chunk: %d Error: %v", index, oErr)
+		}
+		if _, wErr := w.Write(plain); wErr != nil {
+			return size, wErr
+		}
+		size += int64(len(plain))
+	}
+	if n, _ := io.ReadFull(r, buf[:1]); n > 0 {
+		return size, fmt.Errorf(" Decrypt Chunk: %d Error: unexpected data after chunk", last)
+	}
+	return size, nil
+}
+
+func newAEAD(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf(" Envelope Error: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// parseRange 解析Range,如:bytes=0-1023、bytes=1024-、bytes=-1024
+func parseRange(partRange string, size int64) (int64, int64, error) {
+	spec := strings.TrimPrefix(strings.TrimSpace(partRange), "bytes=")
+	pos := strings.Index(spec, "-")
+	if pos < 0 || strings.Contains(spec, ",") {
+		return 0, 0, fmt.Errorf(" Range: %s Error: invalid range", partRange)
+	}
+	var start, end int64
+	var err error
+	switch {
+	case spec[:pos] == "":
+		var n int64
+		n, err = strconv.ParseInt(spec[pos+1:], 10, 64)
+		start, end = size-n, size-1
+		if start < 0 {
+			start = 0
+		}
+	case spec[pos+1:] == "":
+		start, err = strconv.ParseInt(spec[:pos], 10, 64)
+		end = size - 1
+	default:
+		start, err = strconv.ParseInt(spec[:pos], 10, 64)
+		if err == nil {
+			end, err = strconv.ParseInt(spec[pos+1:], 10, 64)
+		}
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf(" Range: %s Error: %v", partRange, err)
+	}
+	if end > size-1 {
+		end = size - 1
+	}
+	if start < 0 || start > end {
+		return 0, 0, fmt.Errorf(" Range: %s Error: range not satisfiable", partRange)
+	}
+	return start, end, nil
+}
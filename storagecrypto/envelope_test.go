@@ -0,0 +1,156 @@
+package storagecrypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newTestEnvelope(t *testing.T, chunkSize int) *envelope {
+	aead, err := newAEAD(bytes.Repeat([]byte{1}, dataKeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}
+	return &envelope{iv: iv, chunkSize: chunkSize, aead: aead}
+}
+
+func TestEnvelopeNonce(t *testing.T) {
+	e := newTestEnvelope(t, 16)
+	if !bytes.Equal(e.nonce(0), e.iv) {
+		t.Errorf("nonce(0) = %x, want iv %x", e.nonce(0), e.iv)
+	}
+	//iv前4字节不变,后8字节与分块序号异或
+	tests := []struct {
+		index int64
+		want  []byte
+	}{
+		{1, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 10}},
+		{0xff, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 0xf4}},
+		{1 << 32, []byte{0, 1, 2, 3, 4, 5, 6, 6, 8, 9, 10, 11}},
+	}
+	for _, tt := range tests {
+		if got := e.nonce(tt.index); !bytes.Equal(got, tt.want) {
+			t.Errorf("nonce(%d) = %x, want %x", tt.index, got, tt.want)
+		}
+	}
+	seen := make(map[string]bool)
+	for i := int64(0); i < 1000; i++ {
+		n := string(e.nonce(i))
+		if seen[n] {
+			t.Fatalf("nonce(%d) repeated", i)
+		}
+		seen[n] = true
+	}
+	if !bytes.Equal(e.iv, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}) {
+		t.Error("nonce modified iv")
+	}
+}
+
+func TestEnvelopeChunkRoundTrip(t *testing.T) {
+	const chunkSize = 16
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 5*chunkSize + 3} {
+		e := newTestEnvelope(t, chunkSize)
+		plain := randomBody(size)
+		var cipherText bytes.Buffer
+		n, err := e.encrypt(&cipherText, bytes.NewReader(plain), int64(size))
+		if err != nil || n != int64(size) || e.contentLength != int64(size) {
+			t.Fatalf("size %d: encrypt = %d, %v", size, n, err)
+		}
+		if int64(cipherText.Len()) != e.cipherSize() {
+			t.Errorf("size %d: cipher length %d, want cipherSize %d", size, cipherText.Len(), e.cipherSize())
+		}
+		last := e.chunks() - 1
+
+		//从任意分块开始解密
+		for first := int64(0); first <= last; first++ {
+			offset := first * (chunkSize + tagSize)
+			var out bytes.Buffer
+			if _, err := e.decrypt(&out, bytes.NewReader(cipherText.Bytes()[offset:]), first, last); err != nil {
+				t.Fatalf("size %d first %d: %v", size, first, err)
+			}
+			if !bytes.Equal(out.Bytes(), plain[first*chunkSize:]) {
+				t.Errorf("size %d first %d: decrypted body differs", size, first)
+			}
+		}
+
+		//在分块边界截断,缺少最后一块时解密失败
+		for chunks := int64(0); chunks <= last; chunks++ {
+			truncated := cipherText.Bytes()[:chunks*(chunkSize+tagSize)]
+			if _, err := e.decrypt(&bytes.Buffer{}, bytes.NewReader(truncated), 0, last); err == nil {
+				t.Errorf("size %d: decrypt truncated after %d chunks: expected error", size, chunks)
+			}
+		}
+		//多余的数据
+		extra := append(append([]byte(nil), cipherText.Bytes()...), make([]byte, chunkSize+tagSize)...)
+		if _, err := e.decrypt(&bytes.Buffer{}, bytes.NewReader(extra), 0, last); err == nil {
+			t.Errorf("size %d: decrypt with trailing data: expected error", size)
+		}
+		//内容被修改
+		tampered := append([]byte(nil), cipherText.Bytes()...)
+		tampered[0] ^= 1
+		if _, err := e.decrypt(&bytes.Buffer{}, bytes.NewReader(tampered), 0, last); err == nil {
+			t.Errorf("size %d: decrypt tampered chunk: expected error", size)
+		}
+		//元数据中的明文长度或分块大小被修改
+		if size > 0 {
+			shorter := *e
+			shorter.contentLength = int64(size - 1)
+			if _, err := shorter.decrypt(&bytes.Buffer{}, bytes.NewReader(cipherText.Bytes()), 0, shorter.chunks()-1); err == nil {
+				t.Errorf("size %d: decrypt with shorter content length: expected error", size)
+			}
+		}
+		if size > chunkSize {
+			//分块序号不对
+			if _, err := e.decrypt(&bytes.Buffer{}, bytes.NewReader(cipherText.Bytes()[chunkSize+tagSize:]), 0, last-1); err == nil {
+				t.Errorf("size %d: decrypt with wrong chunk index: expected error", size)
+			}
+			//前面的分块不能冒充最后一块
+			if _, err := e.decrypt(&bytes.Buffer{}, bytes.NewReader(cipherText.Bytes()[:chunkSize+tagSize]), 0, 0); err != nil {
+				t.Errorf("size %d: decrypt first chunk only: %v", size, err)
+			}
+			lastOnly := *e
+			lastOnly.contentLength = chunkSize
+			if _, err := lastOnly.decrypt(&bytes.Buffer{}, bytes.NewReader(cipherText.Bytes()[:chunkSize+tagSize]), 0, 0); err == nil {
+				t.Errorf("size %d: first chunk accepted as final chunk", size)
+			}
+		}
+	}
+}
+
+func TestEnvelopeEncryptSizeMismatch(t *testing.T) {
+	e := newTestEnvelope(t, 16)
+	for _, size := range []int64{9, 11} {
+		if _, err := e.encrypt(&bytes.Buffer{}, bytes.NewReader(randomBody(10)), size); err == nil {
+			t.Errorf("encrypt 10 bytes as %d: expected error", size)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		partRange  string
+		start, end int64
+		wantErr    bool
+	}{
+		{"bytes=0-99", 0, 99, false},
+		{"bytes=10-", 10, 99, false},
+		{"bytes=-10", 90, 99, false},
+		{"bytes=-1000", 0, 99, false},
+		{"bytes=50-1000", 50, 99, false},
+		{"bytes=100-", 0, 0, true},
+		{"bytes=20-10", 0, 0, true},
+		{"bytes=0-1,5-6", 0, 0, true},
+		{"bytes=a-1", 0, 0, true},
+		{"0-1", 0, 1, false},
+	}
+	for _, tt := range tests {
+		start, end, err := parseRange(tt.partRange, 100)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRange(%q) error = %v, want error %v", tt.partRange, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (start != tt.start || end != tt.end) {
+			t.Errorf("parseRange(%q) = %d-%d, want %d-%d", tt.partRange, start, end, tt.start, tt.end)
+		}
+	}
+}
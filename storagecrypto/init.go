@@ -0,0 +1,31 @@
+package storagecrypto
+
+import (
+	"github.com/shideqin/storage/storagebase"
+)
+
+// Client 客户端加密结构
+// 包装storagebase.IClient, 上传前使用AES-GCM加密, 下载时自动解密,
+// 每个object使用独立的数据密钥, 数据密钥由主密钥包装后保存在object元数据中
+type Client struct {
+	storagebase.IClient
+	masterKey MasterKey
+
+	chunkSize          int
+	multipartThreshold int
+	threadMaxNum       int
+	threadMinNum       int
+}
+
+// New 实例化
+func New(client storagebase.IClient, masterKey MasterKey) *Client {
+	return &Client{
+		IClient:   client,
+		masterKey: masterKey,
+
+		chunkSize:          64 * 1024,
+		multipartThreshold: 100 * 1024 * 1024,
+		threadMaxNum:       500,
+		threadMinNum:       1,
+	}
+}
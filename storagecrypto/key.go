@@ -0,0 +1,61 @@
+package storagecrypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+)
+
+// MasterKey 主密钥,用于包装和解包每个object的数据密钥
+type MasterKey interface {
+	// WrapKey 包装数据密钥,返回包装后的密钥和主密钥描述(保存到元数据)
+	WrapKey(dataKey []byte) ([]byte, string, error)
+	// UnwrapKey 根据主密钥描述解包数据密钥
+	UnwrapKey(wrappedKey []byte, matDesc string) ([]byte, error)
+}
+
+// AESMasterKey 本地AES-GCM主密钥
+type AESMasterKey struct {
+	aead cipher.AEAD
+	desc string
+}
+
+// NewAESMasterKey 实例化,key长度为16、24或32字节,desc用于标识主密钥
+func NewAESMasterKey(key []byte, desc string) (*AESMasterKey, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf(" NewAESMasterKey Error: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf(" NewAESMasterKey Error: %v", err)
+	}
+	return &AESMasterKey{aead: aead, desc: desc}, nil
+}
+
+// WrapKey 包装数据密钥
+func (k *AESMasterKey) WrapKey(dataKey []byte) ([]byte, string, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, "", fmt.Errorf(" WrapKey Error: %v", err)
+	}
+	return k.aead.Seal(nonce, nonce, dataKey, []byte(k.desc)), k.desc, nil
+}
+
+// UnwrapKey 解包数据密钥
+func (k *AESMasterKey) UnwrapKey(wrappedKey []byte, matDesc string) ([]byte, error) {
+	if matDesc != k.desc {
+		return nil, fmt.Errorf(" UnwrapKey MatDesc: %s Error: master key mismatch", matDesc)
+	}
+	nonceSize := k.aead.NonceSize()
+	if len(wrappedKey) < nonceSize {
+		return nil, fmt.Errorf(" UnwrapKey Error: wrapped key too short")
+	}
+	dataKey, err := k.aead.Open(nil, wrappedKey[:nonceSize], wrappedKey[nonceSize:], []byte(matDesc))
+	if err != nil {
+		return nil, fmt.Errorf(" UnwrapKey Error: %v", err)
+	}
+	return dataKey, nil
+}
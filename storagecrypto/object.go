@@ -0,0 +1,465 @@
+package storagecrypto
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/shideqin/storage/storagebase"
+	"github.com/shideqin/storage/storageutil"
+)
+
+// UploadFile 加密上传文件根据路径
+func (c *Client) UploadFile(filePath, bucket, object string, options map[string]string) (map[string]interface{}, error) {
+	fd, err := os.Open(filePath)
+	if fd != nil {
+		defer fd.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf(" UploadFile Open localFile: %s Error: %v", filePath, err)
+	}
+	stat, err := fd.Stat()
+	if err != nil {
+		return nil, fmt.Errorf(" UploadFile Stat localFile: %s Error: %v", filePath, err)
+	}
+	bodySize := int(stat.Size())
+	if object == "" {
+		object = path.Base(filePath)
+	}
+	if strings.TrimSuffix(object, "/") == path.Dir(object) {
+		object = path.Dir(object) + "/" + path.Base(filePath)
+	}
+	return c.Put(fd, bodySize, bucket, object, c.attrOptions(stat, options))
+}
+
+// attrOptions 记录原文件的属性,避免使用加密临时文件的属性
+func (c *Client) attrOptions(fi os.FileInfo, options map[string]string) map[string]string {
+	opts := make(map[string]string, len(options)+4)
+	for k, v := range options {
+		opts[k] = v
+	}
+	return storageutil.FileAttrOptions(opts, fi, options)
+}
+
+// Put 加密上传文件根据内容
+func (c *Client) Put(body io.Reader, bodySize int, bucket, object string, options map[string]string) (map[string]interface{}, error) {
+	env, err := c.newEnvelope()
+	if err != nil {
+		return nil, err
+	}
+	buffer := &bytes.Buffer{}
+	if _, err := env.encrypt(buffer, body, int64(bodySize)); err != nil {
+		return nil, fmt.Errorf(" Put Object: %s Encrypt Error: %v", object, err)
+	}
+	result, err := c.IClient.Put(bytes.NewReader(buffer.Bytes()), buffer.Len(), bucket, object, env.options(options))
+	if err != nil {
+		return nil, err
+	}
+	result["Size"] = bodySize
+	return result, nil
+}
+
+// UploadLargeFile 加密后分块上传文件
+func (c *Client) UploadLargeFile(filePath, bucket, object string, options map[string]string, listener storagebase.ProgressListener) (map[string]interface{}, error) {
+	fd, openErr := os.Open(filePath)
+	if fd != nil {
+		defer fd.Close()
+	}
+	if openErr != nil {
+		return nil, fmt.Errorf(" UploadLargeFile Open localFile: %s Error: %v", filePath, openErr)
+	}
+	localStat, statErr := fd.Stat()
+	if statErr != nil {
+		return nil, fmt.Errorf(" UploadLargeFile Stat localFile: %s Error: %v", filePath, statErr)
+	}
+	if object == "" {
+		object = path.Base(filePath)
+	}
+	if strings.TrimSuffix(object, "/") == path.Dir(object) {
+		object = path.Dir(object) + "/" + path.Base(filePath)
+	}
+	//开启断点续传时使用固定的临时文件和数据密钥,续传时不重新加密
+	checkpointFile := storageutil.CheckpointFile(options, filePath+".ucp")
+	var tmpFile string
+	var env *envelope
+	if checkpointFile != "" {
+		tmpFile = encryptTempFile(filePath, bucket, object)
+		env = c.loadEncryptCheckpoint(tmpFile, localStat)
+	}
+	if env == nil {
+		var err error
+		if env, err = c.newEnvelope(); err != nil {
+			return nil, err
+		}
+		tmpFd, err := createTempFile(tmpFile)
+		if err != nil {
+			return nil, fmt.Errorf(" UploadLargeFile TempFile Error: %v", err)
+		}
+		tmpFile = tmpFd.Name()
+		_, err = env.encrypt(tmpFd, fd, localStat.Size())
+		_ = tmpFd.Close()
+		if err != nil {
+			removeEncryptCheckpoint(tmpFile)
+			return nil, fmt.Errorf(" UploadLargeFile Object: %s Encrypt Error: %v", object, err)
+		}
+		if checkpointFile != "" {
+			if err := saveEncryptCheckpoint(tmpFile, localStat, env); err != nil {
+				removeEncryptCheckpoint(tmpFile)
+				return nil, fmt.Errorf(" UploadLargeFile Save checkpoint Error: %v", err)
+			}
+		}
+	}
+	opts := env.options(c.attrOptions(localStat, options))
+	if checkpointFile != "" {
+		opts["checkpoint_file"] = checkpointFile
+	}
+	result, err := c.IClient.UploadLargeFile(tmpFile, bucket, object, opts, listener)
+	//失败时保留临时文件用于续传
+	if err == nil || checkpointFile == "" {
+		removeEncryptCheckpoint(tmpFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result["Size"] = int(env.contentLength)
+	return result, nil
+}
+
+// Upload 加密上传文件,大小超过分块阈值时自动分块上传
+func (c *Client) Upload(filePath, bucket, object string, options map[string]string, listener storagebase.ProgressListener) (map[string]interface{}, error) {
+	localStat, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf(" Upload Stat localFile: %s Error: %v", filePath, err)
+	}
+	if localStat.Size() >= storageutil.MultipartThreshold(options, c.multipartThreshold) {
+		return c.UploadLargeFile(filePath, bucket, object, options, listener)
+	}
+	progress := storageutil.NewProgress(listener, "Upload", object, localStat.Size(), 1)
+	result, err := c.UploadFile(filePath, bucket, object, options)
+	if err == nil {
+		progress.Transferred(object, localStat.Size())
+	}
+	progress.Done(object, err)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CopyObject 复制文件,大小超过分块阈值时使用分块复制并保留加密信封,metadata_directive为REPLACE时需要带上源文件的信封元数据
+func (c *Client) CopyObject(bucket, object, source string, options map[string]string, listener storagebase.ProgressListener) (map[string]interface{}, error) {
+	if err := rejectReplace("CopyObject", options); err != nil {
+		return nil, err
+	}
+	tmpSourceInfo := strings.Split(source, "/")
+	sourceBucket := tmpSourceInfo[1]
+	sourceObject := strings.Join(tmpSourceInfo[2:], "/")
+	sourceHead, err := c.IClient.Head(sourceBucket, sourceObject, storageutil.SourceSSEOptions(options))
+	if err != nil {
+		return nil, err
+	}
+	if storageutil.HeadSize(sourceHead, false) >= storageutil.MultipartThreshold(options, c.multipartThreshold) {
+		return c.CopyLargeFile(bucket, object, source, options, listener, nil)
+	}
+	return c.IClient.CopyObject(bucket, object, source, options, listener)
+}
+
+// CopyLargeFile 分块复制文件,保留源文件的加密信封,metadata_directive为REPLACE时需要带上源文件的信封元数据
+func (c *Client) CopyLargeFile(bucket, object, source string, options map[string]string, listener storagebase.ProgressListener, exitChan <-chan bool) (map[string]interface{}, error) {
+	if err := rejectReplace("CopyLargeFile", options); err != nil {
+		return nil, err
+	}
+	tmpSourceInfo := strings.Split(source, "/")
+	sourceBucket := tmpSourceInfo[1]
+	sourceObject := strings.Join(tmpSourceInfo[2:], "/")
+	sourceHead, headErr := c.IClient.Head(sourceBucket, sourceObject, storageutil.SourceSSEOptions(options))
+	if headErr != nil {
+		return nil, headErr
+	}
+	opts := make(map[string]string, len(options))
+	for k, v := range options {
+		opts[k] = v
+	}
+	for k, v := range storageutil.HeadMeta(sourceHead) {
+		if strings.HasPrefix(k, "x-amz-meta-envelope-") {
+			opts[k] = v
+		}
+	}
+	return c.IClient.CopyLargeFile(bucket, object, source, opts, listener, exitChan)
+}
+
+// Cat 读取并解密文件内容,支持Range
+func (c *Client) Cat(bucket, object string, options map[string]string, param ...string) (map[string]interface{}, error) {
+	head, err := c.IClient.Head(bucket, object, options)
+	if err != nil {
+		return nil, err
+	}
+	env, err := c.openEnvelope(head)
+	if err != nil {
+		return nil, fmt.Errorf(" Cat Object: %s%v", object, err)
+	}
+	if env == nil {
+		return c.IClient.Cat(bucket, object, options, param...)
+	}
+	//分片请求
+	partRange := ""
+	if len(param) > 0 {
+		partRange = param[0]
+	}
+	if env.contentLength == 0 {
+		if partRange != "" {
+			return nil, fmt.Errorf(" Cat Object: %s Range: %s Error: range not satisfiable", object, partRange)
+		}
+		resp, err := c.IClient.Cat(bucket, object, options)
+		if err != nil {
+			return nil, err
+		}
+		//空文件也要认证唯一的空分块,防止截断后的object被当作空文件
+		body, ok := resp["Body"].(*bytes.Buffer)
+		if !ok {
+			return nil, fmt.Errorf(" Cat Object: %s Error: respond body is nil", object)
+		}
+		if _, err := env.decrypt(ioutil.Discard, body, 0, 0); err != nil {
+			return nil, fmt.Errorf(" Cat Object: %s%v", object, err)
+		}
+		resp["Body"] = &bytes.Buffer{}
+		resp["Content-Length"] = "0"
+		return resp, nil
+	}
+	start, end := int64(0), env.contentLength-1
+	if partRange != "" {
+		start, end, err = parseRange(partRange, env.contentLength)
+		if err != nil {
+			return nil, fmt.Errorf(" Cat Object: %s%v", object, err)
+		}
+	}
+	//明文范围换算成密文分块范围
+	chunkSize := int64(env.chunkSize)
+	first := start / chunkSize
+	last := end / chunkSize
+	cipherStart := first * (chunkSize + tagSize)
+	cipherEnd := (last+1)*(chunkSize+tagSize) - 1
+	if cipherEnd > env.cipherSize()-1 {
+		cipherEnd = env.cipherSize() - 1
+	}
+	resp, err := c.IClient.Cat(bucket, object, options, fmt.Sprintf("bytes=%d-%d", cipherStart, cipherEnd))
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := resp["Body"]; !ok {
+		return nil, fmt.Errorf(" Cat Object: %s Error: respond body is nil", object)
+	}
+	plain := &bytes.Buffer{}
+	if _, err := env.decrypt(plain, resp["Body"].(*bytes.Buffer), first, last); err != nil {
+		return nil, fmt.Errorf(" Cat Object: %s%v", object, err)
+	}
+	offset := start - first*chunkSize
+	length := end - start + 1
+	if int64(plain.Len()) < offset+length {
+		return nil, fmt.Errorf(" Cat Object: %s Error: decrypted body too short", object)
+	}
+	body := plain.Bytes()[offset : offset+length]
+	resp["Body"] = bytes.NewBuffer(body)
+	resp["Content-Length"] = strconv.Itoa(len(body))
+	if partRange != "" {
+		resp["Content-Range"] = fmt.Sprintf("bytes %d-%d/%d", start, end, env.contentLength)
+	}
+	return resp, nil
+}
+
+// Get 下载并解密文件到本地
+func (c *Client) Get(bucket, object, localFile string, options map[string]string, listener storagebase.ProgressListener) (map[string]string, error) {
+	head, headErr := c.IClient.Head(bucket, object, options)
+	if headErr != nil {
+		return nil, headErr
+	}
+	env, err := c.openEnvelope(head)
+	if err != nil {
+		return nil, fmt.Errorf(" Get Object: %s%v", object, err)
+	}
+	if env == nil {
+		return c.IClient.Get(bucket, object, localFile, options, listener)
+	}
+	//当没指定文件名时，默认使用object的文件名
+	if strings.TrimSuffix(localFile, "/") == path.Dir(localFile) {
+		localFile = path.Dir(localFile) + "/" + path.Base(object)
+	}
+	//先下载密文到临时文件
+	tmpFile := localFile + ".encrypted"
+	_ = os.Remove(tmpFile)
+	defer os.Remove(tmpFile)
+	if _, err := c.IClient.Get(bucket, object, tmpFile, options, listener); err != nil {
+		return nil, err
+	}
+	src, err := os.Open(tmpFile)
+	if src != nil {
+		defer src.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf(" Get Open tmpFile: %s Error: %v", tmpFile, err)
+	}
+	//解密到临时文件,成功后再替换本地文件,失败时不破坏原有文件
+	plainFile := localFile + ".decrypted"
+	dst, err := os.OpenFile(plainFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf(" Get OpenFile localFile: %s Error: %v", plainFile, err)
+	}
+	size, err := env.decrypt(dst, src, 0, env.chunks()-1)
+	if cErr := dst.Close(); err == nil && cErr != nil {
+		err = cErr
+	}
+	if err == nil && size != env.contentLength {
+		err = fmt.Errorf(" Error: decrypted size %d not equal %d", size, env.contentLength)
+	}
+	if err != nil {
+		_ = os.Remove(plainFile)
+		return nil, fmt.Errorf(" Get Object: %s%v", object, err)
+	}
+	if rErr := os.Rename(plainFile, localFile); rErr != nil {
+		_ = os.Remove(plainFile)
+		return nil, fmt.Errorf(" Get Rename localFile: %s Error: %v", localFile, rErr)
+	}
+	if aErr := storageutil.RestoreFileAttrs(localFile, head, options); aErr != nil {
+		return nil, fmt.Errorf(" Get Restore localFile: %s Error: %v", localFile, aErr)
+	}
+	return map[string]string{"Object": object, "Localfile": localFile}, nil
+}
+
+// plainSize 获取明文大小,未加密的object返回Content-Length
+func (c *Client) plainSize(head map[string]interface{}) int64 {
+	for k, v := range head {
+		if strings.ToLower(k) == metaContentLength {
+			size, _ := strconv.ParseInt(v.(string), 10, 64)
+			return size
+		}
+	}
+	var size int64
+	if l, ok := head["Content-Length"]; ok {
+		size, _ = strconv.ParseInt(l.(string), 10, 64)
+	}
+	return size
+}
+
+// headState 比较用的object信息,使用明文大小,ETag为密文的md5不参与比较
+func (c *Client) headState(head map[string]interface{}) *storageutil.FileState {
+	state := storageutil.HeadState(head, false)
+	if head != nil {
+		state.Size = c.plainSize(head)
+	}
+	state.Md5 = ""
+	return state
+}
+
+// UploadFromDir 加密上传目录
+func (c *Client) UploadFromDir(localDir, bucket, prefix string, options map[string]string, listener storagebase.ProgressListener) (map[string]int, error) {
+	var threadNum = c.threadMaxNum
+	if options["thread_num"] != "" {
+		n, err := strconv.Atoi(options["thread_num"])
+		if err == nil && n <= c.threadMaxNum && n >= c.threadMinNum {
+			threadNum = n
+		}
+	}
+	return storageutil.UploadFromDir(c.IClient, localDir, bucket, prefix, options, listener, threadNum, nil, c.headState, func(localFile, object string, opts map[string]string, listener storagebase.ProgressListener) error {
+		opts = storageutil.MetaOptions(storageutil.SSEOptions(map[string]string{"disposition": opts["disposition"], "acl": options["acl"], "multipart_threshold": options["multipart_threshold"], "part_size": options["part_size"]}, options), options)
+		_, err := c.Upload(localFile, bucket, object, opts, listener)
+		return err
+	})
+}
+
+// DownloadAllObject 下载并解密目录
+func (c *Client) DownloadAllObject(bucket, prefix, localDir string, options map[string]string, listener storagebase.ProgressListener) (map[string]int, error) {
+	var threadNum = c.threadMaxNum
+	if options["thread_num"] != "" {
+		n, err := strconv.Atoi(options["thread_num"])
+		if err == nil && n <= c.threadMaxNum && n >= c.threadMinNum {
+			threadNum = n
+		}
+	}
+	return storageutil.DownloadAllObject(c.IClient, bucket, prefix, localDir, options, listener, threadNum, nil, c.headState, func(object, localFile string, listener storagebase.ProgressListener) error {
+		_, err := c.Get(bucket, object, localFile, storageutil.SSEOptions(map[string]string{
+			"thread_num":     options["thread_num"],
+			"part_size":      options["part_size"],
+			"preserve_attrs": options["preserve_attrs"],
+			"preserve_owner": options["preserve_owner"],
+		}, options), listener)
+		return err
+	})
+}
+
+// SyncDir 本地目录和bucket/prefix加密镜像同步,参数见storageutil.SyncDir,ETag为密文的md5,compare为checksum时按大小和修改时间比较
+func (c *Client) SyncDir(localDir, bucket, prefix string, options map[string]string, listener storagebase.ProgressListener) (map[string]int, error) {
+	var threadNum = c.threadMaxNum
+	if options["thread_num"] != "" {
+		n, err := strconv.Atoi(options["thread_num"])
+		if err == nil && n <= c.threadMaxNum && n >= c.threadMinNum {
+			threadNum = n
+		}
+	}
+	return storageutil.SyncDir(c, localDir, bucket, prefix, options, listener, threadNum, nil, c.headState)
+}
+
+// RunManifest 按清单批量执行,copy和metadata保留加密信息,参数见storageutil.RunManifest
+func (c *Client) RunManifest(manifestFile string, options map[string]string, listener storagebase.ProgressListener) (map[string]int, error) {
+	var threadNum = c.threadMaxNum
+	if options["thread_num"] != "" {
+		n, err := strconv.Atoi(options["thread_num"])
+		if err == nil && n <= c.threadMaxNum && n >= c.threadMinNum {
+			threadNum = n
+		}
+	}
+	return storageutil.RunManifest(c, manifestFile, options, listener, threadNum, nil)
+}
+
+// rejectReplace 加密信封保存在元数据中,替换元数据后无法解密
+// options中带有信封元数据时允许替换,如RunManifest的metadata操作会保留源文件已有的元数据
+func rejectReplace(operation string, options map[string]string) error {
+	if strings.EqualFold(options["metadata_directive"], "REPLACE") && options[metaKey] == "" {
+		return fmt.Errorf(" %s Error: metadata_directive REPLACE drops the encryption envelope", operation)
+	}
+	return nil
+}
+
+// rawClient 同步到加密客户端时直接写入密文和加密信封,避免重复加密
+func rawClient(client storagebase.IClient) storagebase.IClient {
+	if cc, ok := client.(*Client); ok {
+		return cc.IClient
+	}
+	return client
+}
+
+// CopyAllObject 复制目录,加密信封随元数据复制,不支持metadata_directive为REPLACE
+func (c *Client) CopyAllObject(bucket, prefix, source string, options map[string]string, listener storagebase.ProgressListener) (map[string]int, error) {
+	if err := rejectReplace("CopyAllObject", options); err != nil {
+		return nil, err
+	}
+	return c.IClient.CopyAllObject(bucket, prefix, source, options, listener)
+}
+
+// MoveAllObject 移动目录,加密信封随元数据复制,不支持metadata_directive为REPLACE
+func (c *Client) MoveAllObject(bucket, prefix, source string, options map[string]string, listener storagebase.ProgressListener) (map[string]int, error) {
+	if err := rejectReplace("MoveAllObject", options); err != nil {
+		return nil, err
+	}
+	return c.IClient.MoveAllObject(bucket, prefix, source, options, listener)
+}
+
+// SyncLargeFile 分块同步密文和加密信封,目标需要使用相同的主密钥读取
+func (c *Client) SyncLargeFile(toClient storagebase.IClient, bucket, object, source string, options map[string]string, listener storagebase.ProgressListener) (map[string]interface{}, error) {
+	if err := rejectReplace("SyncLargeFile", options); err != nil {
+		return nil, err
+	}
+	return c.IClient.SyncLargeFile(rawClient(toClient), bucket, object, source, options, listener)
+}
+
+// SyncAllObject 同步目录的密文和加密信封,目标需要使用相同的主密钥读取
+func (c *Client) SyncAllObject(toClient storagebase.IClient, bucket, prefix, source string, options map[string]string, listener storagebase.ProgressListener) (map[string]int, error) {
+	if err := rejectReplace("SyncAllObject", options); err != nil {
+		return nil, err
+	}
+	return c.IClient.SyncAllObject(rawClient(toClient), bucket, prefix, source, options, listener)
+}
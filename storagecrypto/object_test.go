@@ -0,0 +1,264 @@
+package storagecrypto
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shideqin/storage/aws/s3v2"
+	"github.com/shideqin/storage/aws/s3v4"
+	"github.com/shideqin/storage/storagetest"
+)
+
+func newTestClient(t *testing.T) (*storagetest.Server, *Client, *Client) {
+	server := storagetest.NewServer()
+	masterKey, err := NewAESMasterKey(bytes.Repeat([]byte{7}, 32), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v4 := s3v4.New(storagetest.Host, "ak", "sk")
+	v4.SetRetryPolicy(nil)
+	v2 := s3v2.New(storagetest.Host, "ak", "sk")
+	v2.SetRetryPolicy(nil)
+	return server, New(v4, masterKey), New(v2, masterKey)
+}
+
+func randomBody(n int) []byte {
+	body := make([]byte, n)
+	_, _ = rand.New(rand.NewSource(int64(n))).Read(body)
+	return body
+}
+
+func catBody(t *testing.T, c *Client, bucket, object string) []byte {
+	t.Helper()
+	resp, err := c.Cat(bucket, object, nil)
+	if err != nil {
+		t.Fatalf("Cat %s/%s: %v", bucket, object, err)
+	}
+	return resp["Body"].(*bytes.Buffer).Bytes()
+}
+
+func TestCopyMoveSyncRoundTrip(t *testing.T) {
+	server, c, toClient := newTestClient(t)
+	defer server.Close()
+	bodies := map[string][]byte{
+		"small.txt": randomBody(1000),
+		"large.bin": randomBody(11 * 1024 * 1024),
+	}
+	for name, body := range bodies {
+		if _, err := c.Put(bytes.NewReader(body), len(body), "src", "data/"+name, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//large.bin超过阈值,使用分块复制
+	options := map[string]string{"multipart_threshold": "1048576", "part_size": "5242880", "full_path": "true", "thread_num": "2"}
+
+	if _, err := c.CopyAllObject("dst", "copy", "/src/data", options, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.MoveAllObject("dst", "move", "/dst/copy", options, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SyncAllObject(toClient, "bak", "sync", "/src/data", options, nil); err != nil {
+		t.Fatal(err)
+	}
+	for name, body := range bodies {
+		if got := catBody(t, c, "dst", "move/copy/data/"+name); !bytes.Equal(got, body) {
+			t.Errorf("move %s: decrypted body differs", name)
+		}
+		if server.Object("dst", "copy/data/"+name) != nil {
+			t.Errorf("move %s: source not deleted", name)
+		}
+		if got := catBody(t, toClient, "bak", "sync/data/"+name); !bytes.Equal(got, body) {
+			t.Errorf("sync %s: decrypted body differs", name)
+		}
+		if _, err := toClient.SyncLargeFile(c, "src", "large/"+name, "/bak/sync/data/"+name, options, nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := catBody(t, c, "src", "large/"+name); !bytes.Equal(got, body) {
+			t.Errorf("sync large %s: decrypted body differs", name)
+		}
+	}
+
+	replace := map[string]string{"metadata_directive": "REPLACE"}
+	if _, err := c.CopyAllObject("dst", "replace", "/src/data", replace, nil); err == nil {
+		t.Error("CopyAllObject with REPLACE: expected error")
+	}
+	if _, err := c.MoveAllObject("dst", "replace", "/src/data", replace, nil); err == nil {
+		t.Error("MoveAllObject with REPLACE: expected error")
+	}
+	if server.Object("src", "data/small.txt") == nil {
+		t.Error("MoveAllObject with REPLACE deleted the source")
+	}
+}
+
+func TestUploadLargeFileResume(t *testing.T) {
+	server, c, _ := newTestClient(t)
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "storagecrypto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	body := randomBody(11 * 1024 * 1024)
+	localFile := filepath.Join(dir, "large.bin")
+	if err := ioutil.WriteFile(localFile, body, 0644); err != nil {
+		t.Fatal(err)
+	}
+	options := map[string]string{"checkpoint": "true", "part_size": "5242880", "thread_num": "1"}
+	tmpFile := encryptTempFile(localFile, "bucket", "large.bin")
+
+	//第3个分块失败,保留加密临时文件和断点
+	server.SetFailure(func(r *http.Request) bool {
+		return r.URL.Query().Get("partNumber") == "3"
+	})
+	if _, err := c.UploadLargeFile(localFile, "bucket", "large.bin", options, nil); err == nil {
+		t.Fatal("expected part failure")
+	}
+	for _, file := range []string{tmpFile, tmpFile + ".env", localFile + ".ucp"} {
+		if _, err := os.Stat(file); err != nil {
+			t.Fatalf("checkpoint file %s: %v", file, err)
+		}
+	}
+	envData, _ := ioutil.ReadFile(tmpFile + ".env")
+
+	//续传时使用同一个数据密钥,只上传失败的分块
+	var uploaded []string
+	server.SetFailure(func(r *http.Request) bool {
+		if n := r.URL.Query().Get("partNumber"); n != "" {
+			uploaded = append(uploaded, n)
+		}
+		return false
+	})
+	if _, err := c.UploadLargeFile(localFile, "bucket", "large.bin", options, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(uploaded) != 1 || uploaded[0] != "3" {
+		t.Errorf("resumed parts = %v, want [3]", uploaded)
+	}
+	if !bytes.Contains(envData, []byte(server.Object("bucket", "large.bin").Header.Get(metaKey))) {
+		t.Error("resumed upload used a different data key")
+	}
+	if got := catBody(t, c, "bucket", "large.bin"); !bytes.Equal(got, body) {
+		t.Error("decrypted body differs")
+	}
+	for _, file := range []string{tmpFile, tmpFile + ".env", localFile + ".ucp"} {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("checkpoint file %s not removed", file)
+		}
+	}
+}
+
+func TestCopyObjectReplace(t *testing.T) {
+	server, c, _ := newTestClient(t)
+	defer server.Close()
+	body := randomBody(1000)
+	if _, err := c.Put(bytes.NewReader(body), len(body), "src", "a.txt", nil); err != nil {
+		t.Fatal(err)
+	}
+	replace := map[string]string{"metadata_directive": "REPLACE"}
+	if _, err := c.CopyObject("dst", "a.txt", "/src/a.txt", replace, nil); err == nil {
+		t.Error("CopyObject with REPLACE: expected error")
+	}
+	if _, err := c.CopyLargeFile("dst", "a.txt", "/src/a.txt", replace, nil, nil); err == nil {
+		t.Error("CopyLargeFile with REPLACE: expected error")
+	}
+	if server.Object("dst", "a.txt") != nil {
+		t.Error("copy with REPLACE wrote the target")
+	}
+
+	//metadata操作保留已有的元数据,包括加密信封
+	dir, err := ioutil.TempDir("", "storagecrypto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	manifestFile := filepath.Join(dir, "manifest.csv")
+	if err := ioutil.WriteFile(manifestFile, []byte("src,a.txt\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.RunManifest(manifestFile, map[string]string{"operation": "metadata", "metadata": "k=v"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.Object("src", "a.txt").Header.Get("X-Amz-Meta-K"); got != "v" {
+		t.Errorf("X-Amz-Meta-K = %q, want v", got)
+	}
+	if got := catBody(t, c, "src", "a.txt"); !bytes.Equal(got, body) {
+		t.Error("decrypted body differs after metadata update")
+	}
+}
+
+func TestGetKeepsLocalFileOnDecryptError(t *testing.T) {
+	server, c, _ := newTestClient(t)
+	defer server.Close()
+	body := randomBody(1000)
+	if _, err := c.Put(bytes.NewReader(body), len(body), "src", "a.txt", nil); err != nil {
+		t.Fatal(err)
+	}
+	//截断密文
+	stored := server.Object("src", "a.txt")
+	server.PutObject("src", "a.txt", stored.Body[:len(stored.Body)-1], stored.Header)
+
+	dir, err := ioutil.TempDir("", "storagecrypto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localFile := filepath.Join(dir, "a.txt")
+	if err := ioutil.WriteFile(localFile, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get("src", "a.txt", localFile, nil, nil); err == nil {
+		t.Fatal("Get truncated object: expected error")
+	}
+	if got, _ := ioutil.ReadFile(localFile); string(got) != "old" {
+		t.Errorf("local file = %q, want old", got)
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%d files left in dir, want 1", len(entries))
+	}
+}
+
+func TestDirRoundTrip(t *testing.T) {
+	server, c, _ := newTestClient(t)
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "storagecrypto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bodies := map[string][]byte{"a.txt": randomBody(10), "sub/b.bin": randomBody(3000)}
+	for name, body := range bodies {
+		localFile := filepath.Join(dir, "src", name)
+		if err := os.MkdirAll(filepath.Dir(localFile), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(localFile, body, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	result, err := c.UploadFromDir(filepath.Join(dir, "src"), "bucket", "data", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result["Finish"] != len(bodies) {
+		t.Errorf("UploadFromDir Finish = %d, want %d", result["Finish"], len(bodies))
+	}
+	for name, body := range bodies {
+		if stored := server.Object("bucket", "data/"+name); stored == nil || bytes.Contains(stored.Body, body) {
+			t.Errorf("%s: stored body not encrypted", name)
+		}
+	}
+	if _, err := c.DownloadAllObject("bucket", "data/", filepath.Join(dir, "dst"), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	for name, body := range bodies {
+		if got, _ := ioutil.ReadFile(filepath.Join(dir, "dst", "data", name)); !bytes.Equal(got, body) {
+			t.Errorf("%s: downloaded body differs", name)
+		}
+	}
+}
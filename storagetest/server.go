@@ -0,0 +1,609 @@
+// Package storagetest 提供测试用的内存S3兼容服务
+package storagetest
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shideqin/storage/storagebase"
+	"github.com/shideqin/storage/storageutil"
+)
+
+// Host 客户端使用的host,请求按bucket.Host的虚拟主机方式路由到测试服务
+const Host = "storage.test"
+
+// Object 保存的object
+type Object struct {
+	Body    []byte
+	Header  http.Header
+	ETag    string
+	ModTime time.Time
+}
+
+type upload struct {
+	bucket    string
+	key       string
+	header    http.Header
+	parts     map[int]*uploadPart
+	initiated time.Time
+}
+
+type uploadPart struct {
+	body []byte
+	etag string
+}
+
+// Server 内存中的S3兼容服务,不校验签名,支持object的增删改查、复制、列表、分块上传和批量删除
+type Server struct {
+	server *httptest.Server
+
+	lock    sync.Mutex
+	buckets map[string]map[string]*Object
+	uploads map[string]*upload
+	//bucket默认的服务端加密,aws:kms时ETag不是内容的md5
+	defaultSSE  map[string]string
+	copySources []string
+	nextID      int
+	//返回true的请求失败,状态码500
+	failure func(r *http.Request) bool
+	//写入状态码前修改响应header
+	rewrite func(r *http.Request, header http.Header)
+}
+
+// NewServer 启动测试服务,所有请求通过storageutil.SetTransport转发到测试服务,使用完需要Close
+func NewServer() *Server {
+	s := &Server{
+		buckets:    make(map[string]map[string]*Object),
+		uploads:    make(map[string]*upload),
+		defaultSSE: make(map[string]string),
+	}
+	s.server = httptest.NewServer(s)
+	storageutil.SetTransport(&transport{addr: s.server.Listener.Addr().String(), base: &http.Transport{}})
+	return s
+}
+
+// Close 关闭测试服务并恢复默认的http.RoundTripper
+func (s *Server) Close() {
+	storageutil.SetTransport(nil)
+	s.server.Close()
+}
+
+// SetDefaultSSE 设置bucket默认的服务端加密
+func (s *Server) SetDefaultSSE(bucket, sse string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.defaultSSE[bucket] = sse
+}
+
+// SetFailure 设置失败的请求,nil时所有请求正常处理
+func (s *Server) SetFailure(failure func(r *http.Request) bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.failure = failure
+}
+
+// SetRewrite 设置写入状态码前修改响应header的函数,如模拟下载过程中ETag变化,nil时不修改
+func (s *Server) SetRewrite(rewrite func(r *http.Request, header http.Header)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.rewrite = rewrite
+}
+
+// PutObject 直接保存object,header为object的Content-Type等header和自定义元数据
+func (s *Server) PutObject(bucket, key string, body []byte, header http.Header) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.put(bucket, key, &Object{Body: body, Header: header, ETag: s.etag(bucket, body)})
+}
+
+// Object 获取保存的object,不存在时返回nil
+func (s *Server) Object(bucket, key string) *Object {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.buckets[bucket][key]
+}
+
+// Keys bucket中所有object的key,按顺序返回
+func (s *Server) Keys(bucket string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.keys(bucket)
+}
+
+// CopySources 复制请求的x-amz-copy-source
+func (s *Server) CopySources() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.copySources...)
+}
+
+// transport 将请求转发到测试服务,保留原始的Host
+type transport struct {
+	addr string
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	if r.Host == "" {
+		r.Host = req.URL.Host
+	}
+	r.URL.Host = t.addr
+	return t.base.RoundTrip(r)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.nextID++
+	w.Header().Set("X-Amz-Request-Id", strconv.Itoa(s.nextID))
+	if s.rewrite != nil {
+		w = &rewriteWriter{ResponseWriter: w, rewrite: func(header http.Header) { s.rewrite(r, header) }}
+	}
+	bucket := strings.TrimSuffix(strings.Split(r.Host, ":")[0], "."+Host)
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+	_, isUploads := query["uploads"]
+	_, isDelete := query["delete"]
+	_, isTagging := query["tagging"]
+	_, isRestore := query["restore"]
+	uploadID := query.Get("uploadId")
+	copySource := r.Header.Get("X-Amz-Copy-Source")
+	body, _ := ioutil.ReadAll(r.Body)
+	if s.failure != nil && s.failure(r) {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	switch {
+	case key == "" && r.Method == http.MethodGet && isUploads:
+		s.listUploads(w, bucket, query)
+	case key == "" && r.Method == http.MethodGet:
+		s.list(w, bucket, query)
+	case r.Method == http.MethodPost && isDelete:
+		s.deleteObjects(w, bucket, body)
+	case r.Method == http.MethodPost && isUploads:
+		s.nextID++
+		id := fmt.Sprintf("upload-%d", s.nextID)
+		header := storedHeader(r.Header)
+		if sse := s.defaultSSE[bucket]; sse != "" && header.Get("X-Amz-Server-Side-Encryption") == "" {
+			header.Set("X-Amz-Server-Side-Encryption", sse)
+		}
+		s.uploads[id] = &upload{bucket: bucket, key: key, header: header, parts: make(map[int]*uploadPart), initiated: time.Now()}
+		writeSSEHeader(w, header)
+		writeXML(w, http.StatusOK, &storagebase.InitUploadResult{Bucket: bucket, Key: key, UploadID: id})
+	case r.Method == http.MethodPost && uploadID != "":
+		s.complete(w, bucket, key, uploadID, body)
+	case r.Method == http.MethodPost && isRestore:
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodPut && uploadID != "":
+		s.uploadPart(w, r, uploadID, query.Get("partNumber"), copySource, body)
+	case r.Method == http.MethodPut && isTagging:
+		if s.buckets[bucket][key] == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPut && copySource != "":
+		s.copy(w, r, bucket, key, copySource)
+	case r.Method == http.MethodPut:
+		object := &Object{Body: body, Header: storedHeader(r.Header), ETag: s.etag(bucket, body)}
+		s.put(bucket, key, object)
+		writeSSEHeader(w, object.Header)
+		w.Header().Set("Etag", object.ETag)
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet && uploadID != "":
+		s.listParts(w, uploadID, query)
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		s.get(w, r, bucket, key)
+	case r.Method == http.MethodDelete && uploadID != "":
+		delete(s.uploads, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		delete(s.buckets[bucket], key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// rewriteWriter 写入状态码前调用rewrite
+type rewriteWriter struct {
+	http.ResponseWriter
+	rewrite     func(header http.Header)
+	wroteHeader bool
+}
+
+func (w *rewriteWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.rewrite(w.Header())
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *rewriteWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (s *Server) put(bucket, key string, object *Object) {
+	if s.buckets[bucket] == nil {
+		s.buckets[bucket] = make(map[string]*Object)
+	}
+	if object.Header == nil {
+		object.Header = make(http.Header)
+	}
+	if sse := s.defaultSSE[bucket]; sse != "" && object.Header.Get("X-Amz-Server-Side-Encryption") == "" {
+		object.Header.Set("X-Amz-Server-Side-Encryption", sse)
+	}
+	object.ModTime = time.Now()
+	s.buckets[bucket][key] = object
+}
+
+// etag 内容的md5,bucket默认使用KMS加密时为随机值
+func (s *Server) etag(bucket string, body []byte) string {
+	if s.defaultSSE[bucket] == "aws:kms" {
+		return `"` + randomHex(16) + `"`
+	}
+	m := md5.Sum(body)
+	return `"` + hex.EncodeToString(m[:]) + `"`
+}
+
+func (s *Server) keys(bucket string) []string {
+	keys := make([]string, 0, len(s.buckets[bucket]))
+	for k := range s.buckets[bucket] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	object := s.buckets[bucket][key]
+	if object == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	for k, v := range object.Header {
+		//校验值只在x-amz-checksum-mode为ENABLED时返回
+		if strings.HasPrefix(k, "X-Amz-Checksum-") && r.Header.Get("X-Amz-Checksum-Mode") != "ENABLED" {
+			continue
+		}
+		w.Header()[k] = v
+	}
+	w.Header().Set("Etag", object.ETag)
+	w.Header().Set("Last-Modified", object.ModTime.UTC().Format(http.TimeFormat))
+	body := object.Body
+	status := http.StatusOK
+	if partRange := r.Header.Get("Range"); partRange != "" && r.Method == http.MethodGet {
+		start, end, ok := parseRange(partRange, len(body))
+		if !ok {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(body)))
+		body = body[start : end+1]
+		status = http.StatusPartialContent
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		_, _ = w.Write(body)
+	}
+}
+
+func (s *Server) source(copySource string) *Object {
+	s.copySources = append(s.copySources, copySource)
+	copySource = strings.SplitN(copySource, "?", 2)[0]
+	if u, err := url.PathUnescape(copySource); err == nil {
+		copySource = u
+	}
+	info := strings.SplitN(strings.TrimPrefix(copySource, "/"), "/", 2)
+	if len(info) != 2 {
+		return nil
+	}
+	return s.buckets[info[0]][info[1]]
+}
+
+func (s *Server) copy(w http.ResponseWriter, r *http.Request, bucket, key, copySource string) {
+	src := s.source(copySource)
+	if src == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	header := src.Header.Clone()
+	if strings.EqualFold(r.Header.Get("X-Amz-Metadata-Directive"), "REPLACE") {
+		header = storedHeader(r.Header)
+	} else if sse := r.Header.Get("X-Amz-Server-Side-Encryption"); sse != "" {
+		header.Set("X-Amz-Server-Side-Encryption", sse)
+	} else {
+		header.Del("X-Amz-Server-Side-Encryption")
+	}
+	object := &Object{Body: append([]byte(nil), src.Body...), Header: header, ETag: s.etag(bucket, src.Body)}
+	s.put(bucket, key, object)
+	writeSSEHeader(w, object.Header)
+	writeXML(w, http.StatusOK, &storagebase.CopyObjectResult{LastModified: object.ModTime.UTC().Format(time.RFC3339), ETag: object.ETag})
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, uploadID, partNumber, copySource string, body []byte) {
+	up := s.uploads[uploadID]
+	number, err := strconv.Atoi(partNumber)
+	if up == nil || err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if copySource != "" {
+		src := s.source(copySource)
+		if src == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		start, end, ok := parseRange(r.Header.Get("X-Amz-Copy-Source-Range"), len(src.Body))
+		if !ok {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		body = append([]byte(nil), src.Body[start:end+1]...)
+	}
+	etag := s.etag(up.bucket, body)
+	up.parts[number] = &uploadPart{body: body, etag: etag}
+	writeSSEHeader(w, up.header)
+	if copySource != "" {
+		writeXML(w, http.StatusOK, &storagebase.CopyPartResult{ETag: etag})
+		return
+	}
+	w.Header().Set("Etag", etag)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) complete(w http.ResponseWriter, bucket, key, uploadID string, body []byte) {
+	up := s.uploads[uploadID]
+	if up == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var request struct {
+		Part []struct {
+			PartNumber int `xml:"PartNumber"`
+		} `xml:"Part"`
+	}
+	if err := xml.Unmarshal(body, &request); err != nil || len(request.Part) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var data []byte
+	m := md5.New()
+	for _, part := range request.Part {
+		uploaded, ok := up.parts[part.PartNumber]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data = append(data, uploaded.body...)
+		partMd5 := md5.Sum(uploaded.body)
+		_, _ = m.Write(partMd5[:])
+	}
+	etag := fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(m.Sum(nil)), len(request.Part))
+	if s.defaultSSE[bucket] == "aws:kms" {
+		etag = fmt.Sprintf(`"%s-%d"`, randomHex(16), len(request.Part))
+	}
+	object := &Object{Body: data, Header: up.header, ETag: etag}
+	s.put(bucket, key, object)
+	delete(s.uploads, uploadID)
+	writeSSEHeader(w, object.Header)
+	writeXML(w, http.StatusOK, &storagebase.CompleteUploadResult{Bucket: bucket, Key: key, ETag: etag})
+}
+
+// listParts 按分块号列出已上传的分块,支持max-parts和part-number-marker分页
+func (s *Server) listParts(w http.ResponseWriter, uploadID string, query url.Values) {
+	up := s.uploads[uploadID]
+	if up == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	maxParts, err := strconv.Atoi(query.Get("max-parts"))
+	if err != nil || maxParts <= 0 || maxParts > 1000 {
+		maxParts = 1000
+	}
+	marker, _ := strconv.Atoi(query.Get("part-number-marker"))
+	numbers := make([]int, 0, len(up.parts))
+	for number := range up.parts {
+		if number > marker {
+			numbers = append(numbers, number)
+		}
+	}
+	sort.Ints(numbers)
+	result := &storagebase.ListUploadedPartsResult{Bucket: up.bucket, Key: up.key, UploadID: uploadID, PartNumberMarker: query.Get("part-number-marker"), MaxParts: strconv.Itoa(maxParts), IsTruncated: "false"}
+	if len(numbers) > maxParts {
+		numbers = numbers[:maxParts]
+		result.IsTruncated = "true"
+		result.NextPartNumberMarker = strconv.Itoa(numbers[maxParts-1])
+	}
+	for _, number := range numbers {
+		result.Part = append(result.Part, storagebase.UploadedPartInfo{PartNumber: number, ETag: up.parts[number].etag, Size: len(up.parts[number].body)})
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+// listUploads 按key和uploadId排序列出未完成的分块上传,支持max-uploads,key-marker和upload-id-marker分页
+func (s *Server) listUploads(w http.ResponseWriter, bucket string, query url.Values) {
+	prefix, keyMarker, uploadIDMarker := query.Get("prefix"), query.Get("key-marker"), query.Get("upload-id-marker")
+	maxUploads, err := strconv.Atoi(query.Get("max-uploads"))
+	if err != nil || maxUploads <= 0 || maxUploads > 1000 {
+		maxUploads = 1000
+	}
+	ids := make([]string, 0, len(s.uploads))
+	for id, up := range s.uploads {
+		if up.bucket != bucket || !strings.HasPrefix(up.key, prefix) {
+			continue
+		}
+		//upload-id-marker只在key-marker相同时生效
+		if up.key < keyMarker || up.key == keyMarker && (uploadIDMarker == "" || id <= uploadIDMarker) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := s.uploads[ids[i]], s.uploads[ids[j]]
+		if a.key != b.key {
+			return a.key < b.key
+		}
+		return ids[i] < ids[j]
+	})
+	result := &storagebase.ListPartsResult{Bucket: bucket, Prefix: prefix, KeyMarker: keyMarker, UploadIDMarker: uploadIDMarker, MaxUploads: strconv.Itoa(maxUploads), IsTruncated: "false"}
+	if len(ids) > maxUploads {
+		ids = ids[:maxUploads]
+		result.IsTruncated = "true"
+		result.NextKeyMarker = s.uploads[ids[maxUploads-1]].key
+		result.NextUploadIDMarker = ids[maxUploads-1]
+	}
+	for _, id := range ids {
+		up := s.uploads[id]
+		result.Upload = append(result.Upload, struct {
+			Key          string                `xml:"Key"`
+			UploadID     string                `xml:"UploadId"`
+			Initiated    string                `xml:"Initiated"`
+			StorageClass string                `xml:"StorageClass"`
+			Initiator    storagebase.Initiator `xml:"Initiator"`
+			Owner        storagebase.Initiator `xml:"Owner"`
+		}{Key: up.key, UploadID: id, Initiated: up.initiated.UTC().Format("2006-01-02T15:04:05.000Z"), StorageClass: "STANDARD"})
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+func (s *Server) list(w http.ResponseWriter, bucket string, query url.Values) {
+	prefix, marker, delimiter := query.Get("prefix"), query.Get("marker"), query.Get("delimiter")
+	maxKeys, err := strconv.Atoi(query.Get("max-keys"))
+	if err != nil || maxKeys <= 0 || maxKeys > 1000 {
+		maxKeys = 1000
+	}
+	result := &storagebase.ListObjectResult{Name: bucket, Prefix: prefix, Marker: marker, MaxKeys: strconv.Itoa(maxKeys), Delimiter: delimiter, IsTruncated: "false"}
+	seen := make(map[string]bool)
+	for _, key := range s.keys(bucket) {
+		if !strings.HasPrefix(key, prefix) || key <= marker {
+			continue
+		}
+		if len(result.Contents)+len(result.CommonPrefixes) >= maxKeys {
+			result.IsTruncated = "true"
+			break
+		}
+		if delimiter != "" {
+			if pos := strings.Index(key[len(prefix):], delimiter); pos >= 0 {
+				commonPrefix := key[:len(prefix)+pos+len(delimiter)]
+				if !seen[commonPrefix] {
+					seen[commonPrefix] = true
+					result.CommonPrefixes = append(result.CommonPrefixes, storagebase.ListObjectPrefixes{Prefix: commonPrefix})
+				}
+				continue
+			}
+		}
+		object := s.buckets[bucket][key]
+		result.Contents = append(result.Contents, storagebase.ListObjectContents{
+			Key:          key,
+			LastModified: object.ModTime.UTC().Format("2006-01-02T15:04:05.000Z"),
+			ETag:         object.ETag,
+			Size:         len(object.Body),
+			StorageClass: "STANDARD",
+		})
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+func (s *Server) deleteObjects(w http.ResponseWriter, bucket string, body []byte) {
+	var request struct {
+		Object []struct {
+			Key string `xml:"Key"`
+		} `xml:"Object"`
+	}
+	if err := xml.Unmarshal(body, &request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	for _, object := range request.Object {
+		delete(s.buckets[bucket], object.Key)
+	}
+	writeXML(w, http.StatusOK, &storagebase.DeleteResult{})
+}
+
+// storedHeader 请求中保存到object的header
+func storedHeader(header http.Header) http.Header {
+	stored := make(http.Header)
+	for k, v := range header {
+		if len(v) == 0 || v[0] == "" {
+			continue
+		}
+		switch {
+		case k == "Content-Type", k == "Content-Encoding", k == "Cache-Control", k == "Content-Disposition",
+			k == "X-Amz-Server-Side-Encryption", k == "X-Amz-Server-Side-Encryption-Customer-Algorithm",
+			k == "X-Amz-Checksum-Crc32c", k == "X-Amz-Checksum-Sha256",
+			strings.HasPrefix(k, "X-Amz-Meta-"):
+			stored[k] = v
+		}
+	}
+	return stored
+}
+
+func writeSSEHeader(w http.ResponseWriter, header http.Header) {
+	for _, k := range []string{"X-Amz-Server-Side-Encryption", "X-Amz-Server-Side-Encryption-Customer-Algorithm"} {
+		if v := header.Get(k); v != "" {
+			w.Header().Set(k, v)
+		}
+	}
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+// parseRange 解析bytes=start-end,end超出时截断
+func parseRange(partRange string, size int) (int, int, bool) {
+	spec := strings.TrimPrefix(partRange, "bytes=")
+	pos := strings.Index(spec, "-")
+	if pos < 0 {
+		return 0, 0, false
+	}
+	start, err := strconv.Atoi(spec[:pos])
+	if err != nil {
+		return 0, 0, false
+	}
+	end := size - 1
+	if spec[pos+1:] != "" {
+		if end, err = strconv.Atoi(spec[pos+1:]); err != nil {
+			return 0, 0, false
+		}
+	}
+	if end > size-1 {
+		end = size - 1
+	}
+	if start < 0 || start > end {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,99 @@
+package storageutil
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MtimeMeta 上传时记录文件修改时间的元数据,格式为秒.纳秒
+const MtimeMeta = "x-amz-meta-mtime"
+
+// ModeMeta 上传时记录文件权限的元数据,八进制
+const ModeMeta = "x-amz-meta-mode"
+
+// UidMeta 上传时记录文件所有者的元数据
+const UidMeta = "x-amz-meta-uid"
+
+// GidMeta 上传时记录文件所属组的元数据
+const GidMeta = "x-amz-meta-gid"
+
+// FileAttrOptions 将本地文件的修改时间和权限合并到dst,dst中已有的不覆盖
+// options["preserve_attrs"]为false时不记录,options["preserve_owner"]为true时同时记录uid和gid
+func FileAttrOptions(dst map[string]string, fi os.FileInfo, options map[string]string) map[string]string {
+	if dst == nil {
+		dst = make(map[string]string)
+	}
+	if options["preserve_attrs"] == "false" {
+		return dst
+	}
+	attrs := map[string]string{
+		MtimeMeta: fmt.Sprintf("%d.%09d", fi.ModTime().Unix(), fi.ModTime().Nanosecond()),
+		ModeMeta:  strconv.FormatUint(uint64(fi.Mode().Perm()), 8),
+	}
+	if options["preserve_owner"] == "true" {
+		if uid, gid, ok := fileOwner(fi); ok {
+			attrs[UidMeta] = strconv.Itoa(uid)
+			attrs[GidMeta] = strconv.Itoa(gid)
+		}
+	}
+	for k, v := range attrs {
+		if _, ok := dst[k]; !ok {
+			dst[k] = v
+		}
+	}
+	return dst
+}
+
+// HeadMtime 获取上传时记录的文件修改时间,没有记录时返回零值
+func HeadMtime(head map[string]interface{}) time.Time {
+	m, ok := HeadMeta(head)[MtimeMeta]
+	if !ok {
+		return time.Time{}
+	}
+	fields := strings.SplitN(m, ".", 2)
+	sec, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	var nsec int64
+	if len(fields) == 2 {
+		nsec, _ = strconv.ParseInt(fields[1], 10, 64)
+	}
+	return time.Unix(sec, nsec)
+}
+
+// RestoreFileAttrs 根据object元数据恢复本地文件的权限,所有者和修改时间
+// options["preserve_attrs"]为false时不恢复,options["preserve_owner"]为true时恢复uid和gid
+func RestoreFileAttrs(localFile string, head map[string]interface{}, options map[string]string) error {
+	if options["preserve_attrs"] == "false" {
+		return nil
+	}
+	meta := HeadMeta(head)
+	if m, ok := meta[ModeMeta]; ok {
+		mode, err := strconv.ParseUint(m, 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %v", ModeMeta, m, err)
+		}
+		if err := os.Chmod(localFile, os.FileMode(mode).Perm()); err != nil {
+			return err
+		}
+	}
+	if options["preserve_owner"] == "true" {
+		uid, uErr := strconv.Atoi(meta[UidMeta])
+		gid, gErr := strconv.Atoi(meta[GidMeta])
+		if uErr == nil && gErr == nil {
+			if err := os.Chown(localFile, uid, gid); err != nil {
+				return err
+			}
+		}
+	}
+	if mtime := HeadMtime(head); !mtime.IsZero() {
+		if err := os.Chtimes(localFile, mtime, mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
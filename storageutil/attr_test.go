@@ -0,0 +1,71 @@
+package storageutil_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/shideqin/storage/storageutil"
+)
+
+func TestPreserveFileAttrs(t *testing.T) {
+	server, client := newMirrorClient()
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localFile := filepath.Join(dir, "a.txt")
+	if err := ioutil.WriteFile(localFile, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(localFile, 0640); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	if err := os.Chtimes(localFile, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		options   map[string]string
+		preserved bool
+	}{
+		{"default", nil, true},
+		{"large file", map[string]string{"multipart_threshold": "1"}, true},
+		{"disabled", map[string]string{"preserve_attrs": "false"}, false},
+	}
+	for _, tt := range tests {
+		if _, err := client.Upload(localFile, "bucket", "a.txt", tt.options, nil); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		head, err := client.Head("bucket", "a.txt", nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := storageutil.HeadMtime(head); got.Equal(mtime) != tt.preserved {
+			t.Errorf("%s: recorded mtime %v, want preserved %v", tt.name, got, tt.preserved)
+		}
+		downloadFile := filepath.Join(dir, "b.txt")
+		_ = os.Remove(downloadFile)
+		if _, err := client.Get("bucket", "a.txt", downloadFile, tt.options, nil); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		stat, err := os.Stat(downloadFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stat.ModTime().Equal(mtime) != tt.preserved {
+			t.Errorf("%s: downloaded mtime %v, want preserved %v", tt.name, stat.ModTime(), tt.preserved)
+		}
+		//windows只有只读属性
+		if runtime.GOOS != "windows" && (stat.Mode().Perm() == 0640) != tt.preserved {
+			t.Errorf("%s: downloaded mode %v, want preserved %v", tt.name, stat.Mode().Perm(), tt.preserved)
+		}
+	}
+}
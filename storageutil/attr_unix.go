@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package storageutil
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner 获取文件的uid和gid
+func fileOwner(fi os.FileInfo) (int, int, bool) {
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(stat.Uid), int(stat.Gid), true
+}
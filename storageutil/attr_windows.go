@@ -0,0 +1,8 @@
+package storageutil
+
+import "os"
+
+// fileOwner windows不支持uid和gid
+func fileOwner(fi os.FileInfo) (int, int, bool) {
+	return 0, 0, false
+}
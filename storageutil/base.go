@@ -5,12 +5,11 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/base64"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -39,12 +38,41 @@ func init() {
 			ResponseHeaderTimeout: headerTimeout,
 		},
 	}
+	defaultTransport = client.Transport
+}
+
+var defaultTransport http.RoundTripper
+
+// SetTransport 设置发送请求使用的http.RoundTripper,如代理或测试服务,nil时恢复默认,需要在发送请求前设置
+func SetTransport(transport http.RoundTripper) {
+	if transport == nil {
+		transport = defaultTransport
+	}
+	client.Transport = transport
 }
 
 func CURL2Reader(addr, method string, headers map[string]string, body io.Reader, exitChan <-chan bool) (map[string]interface{}, error) {
-	//readTimeout
+	return CURL2ReaderLimit(nil, addr, method, headers, body, exitChan)
+}
+
+// CURL2ReaderLimit 发送请求,bandwidth不为nil时对请求和响应的body限速
+func CURL2ReaderLimit(bandwidth *Bandwidth, addr, method string, headers map[string]string, body io.Reader, exitChan <-chan bool) (map[string]interface{}, error) {
+	progressBody, _ := body.(*ProgressReader)
+	if progressBody != nil {
+		body = progressBody.ReadSeeker
+	}
+	//readTimeout,限速时请求耗时取决于带宽,改为空闲超时,每读写一块body重新计时
 	var readTimeout = 300 * time.Second
-	ctx, cancel := context.WithTimeout(context.Background(), readTimeout)
+	var ctx context.Context
+	var cancel context.CancelFunc
+	var idle *idleTimer
+	if bandwidth.limited() {
+		ctx, cancel = context.WithCancel(context.Background())
+		idle = newIdleTimer(readTimeout, cancel)
+		defer idle.Stop()
+	} else {
+		ctx, cancel = context.WithTimeout(context.Background(), readTimeout)
+	}
 	go func() {
 		for {
 			exit, ok := <-exitChan
@@ -71,6 +99,12 @@ func CURL2Reader(addr, method string, headers map[string]string, body io.Reader,
 	if cl > 0 {
 		req.ContentLength = cl
 	}
+	if progressBody != nil && req.Body != nil && req.Body != http.NoBody {
+		req.Body = ioutil.NopCloser(progressBody.sendReader())
+	}
+	if bandwidth != nil && req.Body != nil && req.Body != http.NoBody {
+		req.Body = ioutil.NopCloser(idle.Reader(bandwidth.Upload.Reader(req.Body)))
+	}
 	resp, err := client.Do(req.WithContext(ctx))
 	if resp != nil {
 		defer func() {
@@ -81,8 +115,12 @@ func CURL2Reader(addr, method string, headers map[string]string, body io.Reader,
 	if err != nil {
 		return nil, err
 	}
+	var respBody io.Reader = resp.Body
+	if bandwidth != nil {
+		respBody = idle.Reader(bandwidth.Download.Reader(resp.Body))
+	}
 	buffer := &bytes.Buffer{}
-	_, err = io.Copy(buffer, resp.Body)
+	_, err = io.Copy(buffer, respBody)
 	if err != nil {
 		return nil, err
 	}
@@ -151,42 +189,62 @@ func Md5ByteReader(body io.Reader) []byte {
 	return m.Sum(nil)
 }
 
-func WalkDir(localDir, suffix string) []string {
+// WalkDir 获取目录下所有文件的相对路径,跟随符号链接,忽略特殊的文件,遍历参数见Walk
+// 有无法读取的文件或目录时返回可读取的文件和第一个错误
+func WalkDir(localDir, suffix string) ([]string, error) {
 	var list = make([]string, 0)
-	localDir = strings.TrimSuffix(localDir, "/") + "/"
-	localDir = filepath.Dir(localDir)
-	localDir = strings.Replace(localDir, "\\", "/", -1)
-	_ = filepath.Walk(localDir, func(fileName string, fi os.FileInfo, err error) error {
-		if err != nil {
-			return nil
-		}
-		if fi == nil {
-			return nil
-		}
-		if fi.IsDir() {
-			return nil
-		}
-		fileName = strings.Replace(fileName, "\\", "/", -1)
-		fileName = strings.Replace(fileName, localDir, "", 1)
-		fileName = strings.TrimLeft(fileName, "/")
-
-		allowed := true
-		if suffix != "" {
-			suffixList := strings.Split(suffix, ",")
-			for _, tmpSuffix := range suffixList {
-				if tmpSuffix != "" {
-					allowed = false
-					if strings.HasSuffix(strings.ToLower(fileName), tmpSuffix) {
-						allowed = true
-						break
-					}
-				}
+	var walkErr error
+	var failed int
+	_ = Walk(localDir, map[string]string{"suffix": suffix}, func(entry WalkEntry) error {
+		if entry.Err != nil {
+			if walkErr == nil {
+				walkErr = entry.Err
 			}
+			failed++
+			return nil
 		}
-		if allowed {
-			list = append(list, fileName)
+		if entry.Skip == "" {
+			list = append(list, entry.Name)
 		}
 		return nil
 	})
-	return list
+	if walkErr != nil {
+		return list, fmt.Errorf(" WalkDir localDir: %s Unreadable: %d Error: %v", localDir, failed, walkErr)
+	}
+	return list, nil
+}
+
+// MetaHeaders 自定义元数据header(options中x-amz-meta-开头的参数)
+func MetaHeaders(options map[string]string) map[string]string {
+	headers := make(map[string]string)
+	for k, v := range options {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, "x-amz-meta-") && v != "" {
+			headers[k] = v
+		}
+	}
+	return headers
+}
+
+// MetaOptions 将options中的自定义元数据合并到dst
+func MetaOptions(dst, options map[string]string) map[string]string {
+	if dst == nil {
+		dst = make(map[string]string)
+	}
+	for k, v := range MetaHeaders(options) {
+		dst[k] = v
+	}
+	return dst
+}
+
+// HeadMeta 从Head结果中获取自定义元数据,key统一为小写
+func HeadMeta(head map[string]interface{}) map[string]string {
+	meta := make(map[string]string)
+	for k, v := range head {
+		k = strings.ToLower(k)
+		if s, ok := v.(string); ok && strings.HasPrefix(k, "x-amz-meta-") {
+			meta[k] = s
+		}
+	}
+	return meta
 }
@@ -0,0 +1,91 @@
+package storageutil
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/shideqin/storage/storagebase"
+)
+
+// Bulk 批量操作的错误处理
+// options["continue_on_error"]为true时记录所有失败的文件并继续执行,否则遇到第一个错误后停止
+// options["item_attempts"]为每个文件的最大尝试次数,默认1次
+type Bulk struct {
+	lock            sync.Mutex
+	operation       string
+	continueOnError bool
+	attempts        int
+	err             error
+	failures        []storagebase.FailedItem
+}
+
+// NewBulk 实例化
+func NewBulk(operation string, options map[string]string) *Bulk {
+	b := &Bulk{operation: operation, continueOnError: options["continue_on_error"] == "true", attempts: 1}
+	if n, err := strconv.Atoi(options["item_attempts"]); err == nil && n > 1 {
+		b.attempts = n
+	}
+	return b
+}
+
+// Do 处理一个文件,失败时重试,最终失败时记录错误
+func (b *Bulk) Do(key string, fn func() error) error {
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		if err = fn(); err == nil || attempt >= b.attempts || b.Exit() {
+			break
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	b.record(key, err, attempt)
+	return err
+}
+
+// Fail 记录不通过Do处理的失败,如批量删除结果中失败的object
+func (b *Bulk) Fail(key string, err error) {
+	b.record(key, err, 1)
+}
+
+func (b *Bulk) record(key string, err error, attempts int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.continueOnError {
+		b.failures = append(b.failures, storagebase.FailedItem{Key: key, Err: err, Attempts: attempts})
+	} else if b.err == nil {
+		b.err = err
+	}
+}
+
+// Exit 是否停止处理后面的文件
+func (b *Bulk) Exit() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.err != nil
+}
+
+// Result 返回统计结果和错误,停止执行时只返回错误,continue_on_error时返回统计结果和*storagebase.BulkError
+func (b *Bulk) Result(result map[string]int) (map[string]int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.err != nil {
+		return nil, b.err
+	}
+	if !b.continueOnError {
+		return result, nil
+	}
+	result["Failed"] = len(b.failures)
+	if len(b.failures) == 0 {
+		return result, nil
+	}
+	failures := make([]storagebase.FailedItem, len(b.failures))
+	copy(failures, b.failures)
+	return result, &storagebase.BulkError{Operation: b.operation, Failures: failures}
+}
+
+// DryRun 是否只列出计划的操作,options["dry_run"]为true时列出和判断跳过,但不修改任何数据
+func DryRun(options map[string]string) bool {
+	return options["dry_run"] == "true"
+}
@@ -0,0 +1,175 @@
+package storageutil_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shideqin/storage/storagebase"
+	"github.com/shideqin/storage/storageutil"
+)
+
+func TestBulkAttempts(t *testing.T) {
+	bulk := storageutil.NewBulk("Test", map[string]string{"continue_on_error": "true", "item_attempts": "3"})
+	calls := 0
+	//第2次成功
+	if err := bulk.Do("a", func() error {
+		if calls++; calls < 2 {
+			return errors.New("failed")
+		}
+		return nil
+	}); err != nil || calls != 2 {
+		t.Errorf("Do = %v after %d calls, want success after 2", err, calls)
+	}
+	calls = 0
+	if err := bulk.Do("b", func() error {
+		calls++
+		return errors.New("failed")
+	}); err == nil || calls != 3 {
+		t.Errorf("Do = %v after %d calls, want error after 3", err, calls)
+	}
+	bulk.Fail("c", errors.New("delete failed"))
+	if bulk.Exit() {
+		t.Error("continue_on_error stopped after a failure")
+	}
+	result, err := bulk.Result(map[string]int{"Total": 3})
+	var bulkErr *storagebase.BulkError
+	if !errors.As(err, &bulkErr) || result["Failed"] != 2 || result["Total"] != 3 {
+		t.Fatalf("Result = %v, %v", result, err)
+	}
+	if bulkErr.Operation != "Test" || len(bulkErr.Failures) != 2 || bulkErr.Failures[0].Key != "b" || bulkErr.Failures[0].Attempts != 3 || bulkErr.Failures[1].Key != "c" {
+		t.Errorf("Failures = %+v", bulkErr.Failures)
+	}
+
+	//默认第一个失败后停止,只返回错误
+	bulk = storageutil.NewBulk("Test", nil)
+	_ = bulk.Do("a", func() error { return errors.New("failed") })
+	if !bulk.Exit() {
+		t.Error("not stopped after a failure")
+	}
+	if result, err := bulk.Result(map[string]int{"Total": 1}); err == nil || result != nil {
+		t.Errorf("Result = %v, %v, want only error", result, err)
+	}
+}
+
+func TestUploadFromDirContinueOnError(t *testing.T) {
+	server, client := newMirrorClient()
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	attempts := 0
+	server.SetFailure(func(r *http.Request) bool {
+		if r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/b.txt") {
+			attempts++
+			return true
+		}
+		return false
+	})
+	options := map[string]string{"continue_on_error": "true", "item_attempts": "2", "thread_num": "1"}
+	result, err := client.UploadFromDir(dir, "bucket", "dir", options, nil)
+	var bulkErr *storagebase.BulkError
+	if !errors.As(err, &bulkErr) {
+		t.Fatalf("UploadFromDir error = %v, want *BulkError", err)
+	}
+	if result["Total"] != 3 || result["Finish"] != 2 || result["Failed"] != 1 {
+		t.Errorf("UploadFromDir = %v", result)
+	}
+	if len(bulkErr.Failures) != 1 || bulkErr.Failures[0].Key != "b.txt" || bulkErr.Failures[0].Attempts != 2 || attempts != 2 {
+		t.Errorf("Failures = %+v after %d attempts", bulkErr.Failures, attempts)
+	}
+	for _, key := range []string{"dir/a.txt", "dir/c.txt"} {
+		if server.Object("bucket", key) == nil {
+			t.Errorf("%s not uploaded", key)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	server, client := newMirrorClient()
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localDir, downloadDir := filepath.Join(dir, "local"), filepath.Join(dir, "download")
+	for _, d := range []string{localDir, downloadDir} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(localDir, "x.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server.PutObject("bucket", "src/a.txt", []byte("a"), nil)
+	server.PutObject("bucket", "src/b.txt", []byte("b"), nil)
+	server.PutObject("bucket", "dst/old.txt", []byte("old"), nil)
+	if _, err := client.InitUpload("bucket", "part.bin", nil); err != nil {
+		t.Fatal(err)
+	}
+	keys := strings.Join(server.Keys("bucket"), ",")
+	rec := recordRequests(server)
+
+	options := map[string]string{"dry_run": "true", "delete": "true"}
+	tests := []struct {
+		name string
+		run  func() (map[string]int, error)
+		want map[string]int
+	}{
+		{"UploadFromDir", func() (map[string]int, error) { return client.UploadFromDir(localDir, "bucket", "up", options, nil) }, map[string]int{"Finish": 1}},
+		{"DownloadAllObject", func() (map[string]int, error) {
+			return client.DownloadAllObject("bucket", "src", downloadDir, options, nil)
+		}, map[string]int{"Finish": 2}},
+		{"CopyAllObject", func() (map[string]int, error) {
+			return client.CopyAllObject("bucket", "copy", "/bucket/src", options, nil)
+		}, map[string]int{"Finish": 2}},
+		{"MoveAllObject", func() (map[string]int, error) {
+			return client.MoveAllObject("bucket", "move", "/bucket/src", options, nil)
+		}, map[string]int{"Finish": 2}},
+		{"SyncAllObject", func() (map[string]int, error) {
+			return client.SyncAllObject(client, "bucket", "sync", "/bucket/src", options, nil)
+		}, map[string]int{"Finish": 2}},
+		{"DeleteAllObject", func() (map[string]int, error) { return client.DeleteAllObject("bucket", "src", options, nil) }, map[string]int{"Finish": 2}},
+		{"DeleteAllPart", func() (map[string]int, error) { return client.DeleteAllPart("bucket", "", options, nil) }, map[string]int{"Finish": 1}},
+		//上传x.txt,删除old.txt
+		{"SyncDir", func() (map[string]int, error) { return client.SyncDir(localDir, "bucket", "dst", options, nil) }, map[string]int{"Upload": 1, "Delete": 1}},
+	}
+	for _, tt := range tests {
+		result, err := tt.run()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for k, v := range tt.want {
+			if result[k] != v {
+				t.Errorf("%s: planned %v, want %s %d", tt.name, result, k, v)
+			}
+		}
+	}
+	//只有列表和Head请求
+	for _, method := range []string{http.MethodPut, http.MethodPost, http.MethodDelete} {
+		if requests := rec.find(method, nil); len(requests) != 0 {
+			t.Errorf("dry_run sent %d %s requests", len(requests), method)
+		}
+	}
+	if got := strings.Join(server.Keys("bucket"), ","); got != keys {
+		t.Errorf("objects after dry_run = %s, want %s", got, keys)
+	}
+	if list, err := client.ListPart("bucket", nil); err != nil || len(list.Upload) != 1 {
+		t.Errorf("dry_run cancelled the multipart upload: %v", err)
+	}
+	if files, _ := ioutil.ReadDir(downloadDir); len(files) != 0 {
+		t.Errorf("dry_run downloaded %d files", len(files))
+	}
+}
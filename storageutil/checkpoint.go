@@ -0,0 +1,181 @@
+package storageutil
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/shideqin/storage/storagebase"
+)
+
+// Checkpoint 分块上传/下载断点信息,下载时不使用UploadID
+type Checkpoint struct {
+	lock sync.Mutex
+	file string
+
+	Bucket     string                    `json:"bucket"`
+	Object     string                    `json:"object"`
+	Source     string                    `json:"source"`
+	SourceETag string                    `json:"source_etag"`
+	Size       int64                     `json:"size"`
+	ModTime    int64                     `json:"mod_time"`
+	PartSize   int                       `json:"part_size"`
+	UploadID   string                    `json:"upload_id"`
+	Parts      map[string]CheckpointPart `json:"parts"`
+}
+
+// CheckpointPart 已完成的分块
+type CheckpointPart struct {
+	ETag     string `json:"etag"`
+	Checksum string `json:"checksum"`
+}
+
+// CheckpointFile 断点文件路径,options["checkpoint"]为true时开启,options["checkpoint_file"]可指定路径
+func CheckpointFile(options map[string]string, defaultFile string) string {
+	if options["checkpoint"] != "true" {
+		return ""
+	}
+	if options["checkpoint_file"] != "" {
+		return options["checkpoint_file"]
+	}
+	return defaultFile
+}
+
+// TempCheckpointFile 没有本地源文件时(copy/sync)默认的断点文件路径
+func TempCheckpointFile(source, bucket, object string) string {
+	name := hex.EncodeToString(Md5Byte([]byte(source + "|" + bucket + "/" + object)))
+	return filepath.Join(os.TempDir(), "storage-"+name+".ucp")
+}
+
+// Load 加载断点文件,源文件和分块信息一致时返回true
+func (cp *Checkpoint) Load(file string) bool {
+	cp.file = file
+	if file == "" {
+		return false
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return false
+	}
+	var saved Checkpoint
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return false
+	}
+	if saved.Bucket != cp.Bucket || saved.Object != cp.Object || saved.Source != cp.Source ||
+		saved.SourceETag != cp.SourceETag || saved.Size != cp.Size || saved.ModTime != cp.ModTime || saved.PartSize != cp.PartSize {
+		return false
+	}
+	cp.UploadID = saved.UploadID
+	cp.Parts = saved.Parts
+	return true
+}
+
+// Reconcile 根据服务端已上传的分块核对断点,只保留大小一致的分块
+func (cp *Checkpoint) Reconcile(client storagebase.IClient) error {
+	parts := make(map[string]CheckpointPart)
+	marker := ""
+LIST:
+	list, err := client.ListUploadedParts(cp.Bucket, cp.Object, cp.UploadID, map[string]string{"part-number-marker": marker, "max-parts": "1000"})
+	if err != nil {
+		return err
+	}
+	for _, v := range list.Part {
+		if int64(v.Size) != cp.partLength(v.PartNumber) {
+			continue
+		}
+		partNumber := strconv.Itoa(v.PartNumber)
+		part := CheckpointPart{ETag: v.ETag}
+		if saved, ok := cp.Parts[partNumber]; ok && TrimETag(saved.ETag) == TrimETag(v.ETag) {
+			part.Checksum = saved.Checksum
+		}
+		parts[partNumber] = part
+	}
+	if list.IsTruncated == "true" && list.NextPartNumberMarker != "" {
+		marker = list.NextPartNumberMarker
+		goto LIST
+	}
+	cp.lock.Lock()
+	cp.Parts = parts
+	cp.lock.Unlock()
+	return cp.Save()
+}
+
+// Resume 校验断点中的上传,返回是否续传,没有UploadID时不续传
+// 获取已上传的分块失败时取消旧的上传并删除断点,避免残留的分块继续占用存储,返回错误,再次执行时重新上传
+func (cp *Checkpoint) Resume(client storagebase.IClient) (bool, error) {
+	if cp.UploadID == "" {
+		return false, nil
+	}
+	err := cp.Reconcile(client)
+	if err == nil {
+		return true, nil
+	}
+	if _, cErr := client.CancelPart(cp.Bucket, cp.Object, cp.UploadID); cErr != nil {
+		err = fmt.Errorf("%v, Cancel Error: %v", err, cErr)
+	}
+	cp.Remove()
+	return false, fmt.Errorf(" Resume UploadId: %s Error: %v", cp.UploadID, err)
+}
+
+// Part 获取已完成的分块,ok为false时需要上传
+func (cp *Checkpoint) Part(partNumber int) (CheckpointPart, bool) {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+	part, ok := cp.Parts[strconv.Itoa(partNumber)]
+	return part, ok && part.ETag != ""
+}
+
+// SetPart 记录完成的分块并保存断点
+func (cp *Checkpoint) SetPart(partNumber int, etag, checksum string) error {
+	cp.lock.Lock()
+	if cp.Parts == nil {
+		cp.Parts = make(map[string]CheckpointPart)
+	}
+	cp.Parts[strconv.Itoa(partNumber)] = CheckpointPart{ETag: etag, Checksum: checksum}
+	cp.lock.Unlock()
+	return cp.Save()
+}
+
+// Save 保存断点文件
+func (cp *Checkpoint) Save() error {
+	if cp.file == "" {
+		return nil
+	}
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmpFile := cp.file + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, cp.file)
+}
+
+// Remove 上传完成后删除断点文件
+func (cp *Checkpoint) Remove() {
+	if cp.file != "" {
+		_ = os.Remove(cp.file)
+	}
+}
+
+func (cp *Checkpoint) partLength(partNumber int) int64 {
+	if cp.PartSize <= 0 || partNumber < 1 {
+		return -1
+	}
+	start := int64(partNumber-1) * int64(cp.PartSize)
+	if start >= cp.Size {
+		return -1
+	}
+	if cp.Size-start < int64(cp.PartSize) {
+		return cp.Size - start
+	}
+	return int64(cp.PartSize)
+}
@@ -0,0 +1,188 @@
+package storageutil_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestUploadLargeFileResumeFailureCancelsUpload(t *testing.T) {
+	server, client := newMirrorClient()
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localFile := filepath.Join(dir, "a.txt")
+	if err := ioutil.WriteFile(localFile, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checkpointFile := localFile + ".ucp"
+	options := map[string]string{"checkpoint": "true"}
+
+	//完成上传失败,保留断点
+	server.SetFailure(func(r *http.Request) bool {
+		return r.Method == http.MethodPost && r.URL.Query().Get("uploadId") != ""
+	})
+	if _, err := client.UploadLargeFile(localFile, "bucket", "a.txt", options, nil); err == nil {
+		t.Fatal("expected complete error")
+	}
+	data, err := ioutil.ReadFile(checkpointFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var checkpoint struct {
+		UploadID string `json:"upload_id"`
+	}
+	if err := json.Unmarshal(data, &checkpoint); err != nil || checkpoint.UploadID == "" {
+		t.Fatalf("checkpoint upload_id: %q, %v", checkpoint.UploadID, err)
+	}
+
+	//获取已上传的分块失败时取消旧的上传并返回错误
+	server.SetFailure(func(r *http.Request) bool {
+		return r.Method == http.MethodGet && r.URL.Query().Get("uploadId") != ""
+	})
+	if _, err := client.UploadLargeFile(localFile, "bucket", "a.txt", options, nil); err == nil {
+		t.Fatal("expected resume error")
+	}
+	server.SetFailure(nil)
+	if _, err := client.ListUploadedParts("bucket", "a.txt", checkpoint.UploadID, nil); err == nil {
+		t.Error("stale upload not cancelled")
+	}
+	if _, err := os.Stat(checkpointFile); !os.IsNotExist(err) {
+		t.Errorf("checkpoint file not removed: %v", err)
+	}
+
+	//再次执行时重新上传
+	if _, err := client.UploadLargeFile(localFile, "bucket", "a.txt", options, nil); err != nil {
+		t.Fatal(err)
+	}
+	if object := server.Object("bucket", "a.txt"); object == nil || string(object.Body) != "0123456789" {
+		t.Error("object not uploaded")
+	}
+}
+
+func TestUploadLargeFileResumeUploadsMissingParts(t *testing.T) {
+	server, client := newMirrorClient()
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localFile := filepath.Join(dir, "a.bin")
+	data := bytes.Repeat([]byte("0123456789"), 1100*1024)
+	if err := ioutil.WriteFile(localFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	options := map[string]string{"checkpoint": "true", "part_size": strconv.Itoa(5 * 1024 * 1024)}
+
+	//第2个分块上传失败
+	server.SetFailure(func(r *http.Request) bool {
+		return r.Method == http.MethodPut && r.URL.Query().Get("partNumber") == "2"
+	})
+	if _, err := client.UploadLargeFile(localFile, "bucket", "a.bin", options, nil); err == nil {
+		t.Fatal("expected part error")
+	}
+
+	//续传不重新初始化,只上传未完成的分块
+	rec := recordRequests(server)
+	if _, err := client.UploadLargeFile(localFile, "bucket", "a.bin", options, nil); err != nil {
+		t.Fatal(err)
+	}
+	if inits := rec.find(http.MethodPost, func(r *http.Request) bool { return r.URL.Query().Get("uploadId") == "" }); len(inits) != 0 {
+		t.Errorf("resume initiated %d new uploads", len(inits))
+	}
+	var parts []string
+	for _, r := range rec.find(http.MethodPut, nil) {
+		parts = append(parts, r.URL.Query().Get("partNumber"))
+	}
+	//第3个分块可能在失败前已开始上传
+	uploaded := strings.Join(parts, ",")
+	if uploaded != "2" && uploaded != "2,3" && uploaded != "3,2" {
+		t.Errorf("resumed parts = %v, want only missing parts", parts)
+	}
+	if object := server.Object("bucket", "a.bin"); object == nil || !bytes.Equal(object.Body, data) {
+		t.Error("resumed object differs from local file")
+	}
+	if _, err := os.Stat(localFile + ".ucp"); !os.IsNotExist(err) {
+		t.Errorf("checkpoint file not removed: %v", err)
+	}
+}
+
+func TestGetResume(t *testing.T) {
+	server, client := newMirrorClient()
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	const partSize = 1024 * 1024
+	data := bytes.Repeat([]byte("0123456789"), 300*1024)
+	server.PutObject("bucket", "a.bin", data, nil)
+	localFile := filepath.Join(dir, "a.bin")
+	options := map[string]string{"part_size": strconv.Itoa(partSize), "thread_num": "1"}
+	part2 := fmt.Sprintf("bytes=%d-", partSize)
+	failPart2 := func(r *http.Request) bool {
+		return r.Method == http.MethodGet && strings.HasPrefix(r.Header.Get("Range"), part2)
+	}
+
+	//第2个分片下载失败,保留临时文件和断点,不创建本地文件
+	server.SetFailure(failPart2)
+	if _, err := client.Get("bucket", "a.bin", localFile, options, nil); err == nil {
+		t.Fatal("expected part error")
+	}
+	if _, err := os.Stat(localFile); !os.IsNotExist(err) {
+		t.Errorf("localFile created by failed download: %v", err)
+	}
+	for _, file := range []string{localFile + ".download", localFile + ".dcp"} {
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("%s not kept: %v", filepath.Base(file), err)
+		}
+	}
+
+	//续传不重新下载第1个分片
+	rec := recordRequests(server)
+	if _, err := client.Get("bucket", "a.bin", localFile, options, nil); err != nil {
+		t.Fatal(err)
+	}
+	if gets := rec.find(http.MethodGet, func(r *http.Request) bool { return strings.HasPrefix(r.Header.Get("Range"), "bytes=0-") }); len(gets) != 0 {
+		t.Error("resumed download fetched part 1 again")
+	}
+	if got, err := ioutil.ReadFile(localFile); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("resumed download differs: %v", err)
+	}
+	for _, file := range []string{localFile + ".download", localFile + ".dcp"} {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("%s not removed: %v", filepath.Base(file), err)
+		}
+	}
+
+	//object变化(ETag不同)时重新下载全部分片
+	_ = os.Remove(localFile)
+	server.SetFailure(failPart2)
+	if _, err := client.Get("bucket", "a.bin", localFile, options, nil); err == nil {
+		t.Fatal("expected part error")
+	}
+	changed := bytes.Repeat([]byte("9876543210"), 300*1024)
+	server.PutObject("bucket", "a.bin", changed, nil)
+	rec = recordRequests(server)
+	if _, err := client.Get("bucket", "a.bin", localFile, options, nil); err != nil {
+		t.Fatal(err)
+	}
+	if gets := rec.find(http.MethodGet, func(r *http.Request) bool { return strings.HasPrefix(r.Header.Get("Range"), "bytes=0-") }); len(gets) != 1 {
+		t.Errorf("download after change fetched part 1 %d times, want 1", len(gets))
+	}
+	if got, err := ioutil.ReadFile(localFile); err != nil || !bytes.Equal(got, changed) {
+		t.Errorf("download after change differs: %v", err)
+	}
+}
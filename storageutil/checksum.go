@@ -0,0 +1,185 @@
+package storageutil
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ContentMd5Meta 保存整个文件md5的元数据
+const ContentMd5Meta = "x-amz-meta-content-md5"
+
+// ChecksumAlgorithm options["checksum"]对应的算法名称,支持crc32c和sha256
+func ChecksumAlgorithm(options map[string]string) string {
+	switch strings.ToLower(options["checksum"]) {
+	case "crc32c":
+		return "CRC32C"
+	case "sha256":
+		return "SHA256"
+	}
+	return ""
+}
+
+// checksumHash 校验算法对应的hash,不支持时返回nil
+func checksumHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case "CRC32C":
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	case "SHA256":
+		return sha256.New()
+	}
+	return nil
+}
+
+// ChecksumHeaders 计算x-amz-checksum-* header,body需要实现io.ReadSeeker
+func ChecksumHeaders(options map[string]string, body io.Reader) map[string]string {
+	headers := make(map[string]string)
+	h := checksumHash(ChecksumAlgorithm(options))
+	if h == nil {
+		return headers
+	}
+	rs := body.(io.ReadSeeker)
+	_, _ = io.Copy(h, rs)
+	_, _ = rs.Seek(0, 0)
+	headers["x-amz-checksum-"+strings.ToLower(ChecksumAlgorithm(options))] = Base64Encode(h.Sum(nil))
+	return headers
+}
+
+// ChecksumAlgorithmHeaders 初始化分块上传时声明校验算法
+func ChecksumAlgorithmHeaders(options map[string]string) map[string]string {
+	headers := make(map[string]string)
+	if algorithm := ChecksumAlgorithm(options); algorithm != "" {
+		headers["x-amz-checksum-algorithm"] = algorithm
+	}
+	return headers
+}
+
+// ChecksumPartXML 完成分块上传时每个分块的校验值
+func ChecksumPartXML(options map[string]string, uploadPart map[string]interface{}) string {
+	algorithm := ChecksumAlgorithm(options)
+	if algorithm == "" {
+		return ""
+	}
+	var value string
+	for k, v := range uploadPart {
+		if strings.EqualFold(k, "x-amz-checksum-"+algorithm) {
+			value, _ = v.(string)
+		}
+	}
+	if value == "" {
+		return ""
+	}
+	return fmt.Sprintf("<Checksum%s>%s</Checksum%s>", algorithm, value, algorithm)
+}
+
+// TrimETag 去掉ETag的引号
+func TrimETag(etag string) string {
+	return strings.ToLower(strings.Trim(etag, `"`))
+}
+
+// ETagIsMD5 判断ETag是否为内容md5(非分块上传且没有使用KMS或客户密钥加密)
+func ETagIsMD5(head map[string]interface{}) bool {
+	etag, _ := head["Etag"].(string)
+	if etag == "" || strings.Contains(etag, "-") {
+		return false
+	}
+	return !EncryptedETag(head)
+}
+
+// EncryptedETag 响应中的服务端加密方式是否使ETag不是内容的md5,如SSE-KMS和SSE-C,包括bucket默认加密
+func EncryptedETag(resp map[string]interface{}) bool {
+	if sse, ok := resp["X-Amz-Server-Side-Encryption"].(string); ok && sse == "aws:kms" {
+		return true
+	}
+	_, ok := resp["X-Amz-Server-Side-Encryption-Customer-Algorithm"]
+	return ok
+}
+
+// MultipartETag 根据每个分块的ETag计算分块上传完成后的ETag
+func MultipartETag(partETagList []string) (string, error) {
+	m := md5.New()
+	for _, etag := range partETagList {
+		partMd5, err := hex.DecodeString(TrimETag(etag))
+		if err != nil {
+			return "", err
+		}
+		_, _ = m.Write(partMd5)
+	}
+	return hex.EncodeToString(m.Sum(nil)) + "-" + strconv.Itoa(len(partETagList)), nil
+}
+
+// Md5File 计算文件md5
+func Md5File(filePath string) ([]byte, error) {
+	fd, err := os.Open(filePath)
+	if fd != nil {
+		defer fd.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	m := md5.New()
+	if _, err := io.Copy(m, fd); err != nil {
+		return nil, err
+	}
+	return m.Sum(nil), nil
+}
+
+// ContentMd5 object内容的md5,优先使用content-md5元数据,其次使用ETag,无法获取时为空
+func ContentMd5(head map[string]interface{}) string {
+	expected := strings.ToLower(HeadMeta(head)[ContentMd5Meta])
+	if expected == "" && ETagIsMD5(head) {
+		expected = TrimETag(head["Etag"].(string))
+	}
+	return expected
+}
+
+// VerifyFile 下载完成后校验本地文件,优先使用content-md5元数据,其次使用ETag
+// head中有x-amz-checksum-crc32c或x-amz-checksum-sha256时同时校验
+func VerifyFile(filePath string, head map[string]interface{}) error {
+	if expected := ContentMd5(head); expected != "" {
+		fileMd5, err := Md5File(filePath)
+		if err != nil {
+			return err
+		}
+		if actual := hex.EncodeToString(fileMd5); actual != expected {
+			return fmt.Errorf("md5 %s not equal %s", actual, expected)
+		}
+	}
+	return verifyChecksum(filePath, head)
+}
+
+// verifyChecksum 校验x-amz-checksum-*,分块上传的校验值为分块校验值的组合(带-分块数),无法按整个文件校验,跳过
+func verifyChecksum(filePath string, head map[string]interface{}) error {
+	for _, algorithm := range []string{"CRC32C", "SHA256"} {
+		var expected string
+		for k, v := range head {
+			if strings.EqualFold(k, "x-amz-checksum-"+algorithm) {
+				expected, _ = v.(string)
+			}
+		}
+		if expected == "" || strings.Contains(expected, "-") {
+			continue
+		}
+		fd, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		h := checksumHash(algorithm)
+		_, err = io.Copy(h, fd)
+		_ = fd.Close()
+		if err != nil {
+			return err
+		}
+		if actual := Base64Encode(h.Sum(nil)); actual != expected {
+			return fmt.Errorf("%s %s not equal %s", strings.ToLower(algorithm), actual, expected)
+		}
+	}
+	return nil
+}
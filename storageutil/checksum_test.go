@@ -0,0 +1,115 @@
+package storageutil_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shideqin/storage/storageutil"
+)
+
+func TestVerifyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localFile := filepath.Join(dir, "a.txt")
+	if err := ioutil.WriteFile(localFile, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	//"data"的md5,crc32c和sha256
+	const (
+		md5    = "8d777f385d3dfec8815d20f7496026dc"
+		crc32c = "rth90Q=="
+		sha256 = "Om6weQ85rIfJTzhWst0sXREOaBFgImGpqSPTuyOtyLc="
+	)
+	tests := []struct {
+		name    string
+		head    map[string]interface{}
+		wantErr bool
+	}{
+		{"nothing to verify", map[string]interface{}{}, false},
+		{"etag", map[string]interface{}{"Etag": `"` + md5 + `"`}, false},
+		{"etag mismatch", map[string]interface{}{"Etag": `"00000000000000000000000000000000"`}, true},
+		{"content-md5 meta", map[string]interface{}{"X-Amz-Meta-Content-Md5": md5, "Etag": `"abc-2"`}, false},
+		{"crc32c", map[string]interface{}{"X-Amz-Checksum-Crc32c": crc32c}, false},
+		{"crc32c mismatch", map[string]interface{}{"X-Amz-Checksum-Crc32c": "AAAAAA=="}, true},
+		{"sha256", map[string]interface{}{"X-Amz-Checksum-Sha256": sha256}, false},
+		{"sha256 mismatch with md5 match", map[string]interface{}{"Etag": `"` + md5 + `"`, "X-Amz-Checksum-Sha256": crc32c}, true},
+		{"multipart checksum skipped", map[string]interface{}{"X-Amz-Checksum-Sha256": "AAAA-2"}, false},
+	}
+	for _, tt := range tests {
+		if err := storageutil.VerifyFile(localFile, tt.head); (err != nil) != tt.wantErr {
+			t.Errorf("%s: VerifyFile = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestUploadVerify(t *testing.T) {
+	server, client := newMirrorClient()
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localFile := filepath.Join(dir, "a.txt")
+	if err := ioutil.WriteFile(localFile, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		options map[string]string
+		header  string
+	}{
+		{map[string]string{"store_md5": "true"}, "X-Amz-Meta-Content-Md5"},
+		{map[string]string{"checksum": "crc32c"}, "X-Amz-Checksum-Crc32c"},
+		{map[string]string{"checksum": "sha256"}, "X-Amz-Checksum-Sha256"},
+	}
+	for _, tt := range tests {
+		if _, err := client.Upload(localFile, "bucket", "a.txt", tt.options, nil); err != nil {
+			t.Fatal(err)
+		}
+		stored := server.Object("bucket", "a.txt")
+		if stored.Header.Get(tt.header) == "" {
+			t.Fatalf("%v: %s not stored", tt.options, tt.header)
+		}
+		if _, err := client.Get("bucket", "a.txt", filepath.Join(dir, "b.txt"), nil, nil); err != nil {
+			t.Errorf("%v: Get: %v", tt.options, err)
+		}
+		//内容被替换,ETag随内容变化,只能通过保存的md5或校验值发现
+		server.PutObject("bucket", "a.txt", []byte("DATA"), stored.Header)
+		if _, err := client.Get("bucket", "a.txt", filepath.Join(dir, "c.txt"), nil, nil); err == nil {
+			t.Errorf("%v: Get modified object: expected verify error", tt.options)
+		}
+	}
+}
+
+func TestUploadLargeFileBucketKMS(t *testing.T) {
+	server, client := newMirrorClient()
+	defer server.Close()
+	//bucket默认使用KMS加密时分块和完成后的ETag都不是md5
+	server.SetDefaultSSE("bucket", "aws:kms")
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	body := bytes.Repeat([]byte("0123456789"), 1100*1024)
+	localFile := filepath.Join(dir, "large.bin")
+	if err := ioutil.WriteFile(localFile, body, 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := client.UploadLargeFile(localFile, "bucket", "large.bin", map[string]string{"part_size": "5242880", "thread_num": "2"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sse, _ := result["X-Amz-Server-Side-Encryption"].(string); sse != "aws:kms" {
+		t.Errorf("X-Amz-Server-Side-Encryption = %q, want aws:kms", sse)
+	}
+	if object := server.Object("bucket", "large.bin"); object == nil || !bytes.Equal(object.Body, body) {
+		t.Error("uploaded body differs")
+	}
+}
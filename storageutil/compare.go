@@ -0,0 +1,206 @@
+package storageutil
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// FileState 比较用的本地文件或object信息
+type FileState struct {
+	Exists  bool
+	Size    int64
+	ModTime time.Time
+	//内容md5,十六进制,为空时未知
+	Md5 string
+	//自定义元数据,key为小写
+	Meta map[string]string
+	//本地文件路径,md5和校验值按需计算
+	path string
+}
+
+// LocalState 本地文件信息,fi为nil时文件不存在
+func LocalState(filePath string, fi os.FileInfo) *FileState {
+	if fi == nil {
+		return &FileState{}
+	}
+	return &FileState{Exists: true, Size: fi.Size(), ModTime: fi.ModTime(), path: filePath}
+}
+
+// HeadState object信息,head为nil时object不存在,uncompressed为true时使用压缩前的大小
+func HeadState(head map[string]interface{}, uncompressed bool) *FileState {
+	if head == nil {
+		return &FileState{}
+	}
+	state := &FileState{Exists: true, Size: HeadSize(head, uncompressed), ModTime: HeadTime(head), Md5: ContentMd5(head), Meta: HeadMeta(head)}
+	//上传时记录了文件修改时间的按原文件时间比较
+	if mtime := HeadMtime(head); !mtime.IsZero() {
+		state.ModTime = mtime
+	}
+	//压缩上传的ETag为压缩后内容的md5
+	if _, ok := state.Meta[UncompressedSizeMeta]; ok && uncompressed {
+		state.Md5 = ""
+	}
+	return state
+}
+
+// HeadTime 获取Head结果中的Last-Modified
+func HeadTime(head map[string]interface{}) time.Time {
+	lastModified, _ := head["Last-Modified"].(string)
+	t, _ := http.ParseTime(lastModified)
+	return t
+}
+
+func (s *FileState) md5() (string, error) {
+	if s.Md5 == "" && s.path != "" {
+		var err error
+		if s.Md5, err = fileChecksum(s.path, "md5"); err != nil {
+			return "", err
+		}
+	}
+	return s.Md5, nil
+}
+
+func (s *FileState) meta(name, algorithm string) (string, error) {
+	if s.path != "" {
+		return fileChecksum(s.path, algorithm)
+	}
+	return s.Meta[name], nil
+}
+
+// fileChecksum 计算本地文件的md5或sha256,无法读取时返回错误
+func fileChecksum(filePath, algorithm string) (string, error) {
+	var h hash.Hash
+	switch algorithm {
+	case "md5":
+		h = md5.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return "", fmt.Errorf("unknown checksum algorithm %q", algorithm)
+	}
+	fd, err := os.Open(filePath)
+	if fd != nil {
+		defer fd.Close()
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(h, fd); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Comparer 判断目标文件是否未修改可以跳过
+// options["compare"]:
+//
+//	size_mtime(默认): 大小相同且目标的修改时间不早于源
+//	size: 大小相同
+//	checksum: 比较内容md5(content-md5元数据或ETag),无法获取时按size_mtime
+//	meta: 比较options["compare_meta"]指定的元数据(默认x-amz-meta-content-md5),
+//	      本地文件按options["compare_meta_algorithm"](md5或sha256,默认md5)计算,无法获取时按size_mtime
+//	always: 总是传输,同options["replace"]为true
+//	never: 目标存在时总是跳过
+type Comparer struct {
+	mode      string
+	meta      string
+	algorithm string
+}
+
+// NewComparer 根据options创建
+func NewComparer(options map[string]string) (*Comparer, error) {
+	c := &Comparer{mode: options["compare"], meta: strings.ToLower(options["compare_meta"]), algorithm: options["compare_meta_algorithm"]}
+	if c.mode == "" {
+		c.mode = "size_mtime"
+	}
+	if options["replace"] == "true" {
+		c.mode = "always"
+	}
+	if c.meta == "" {
+		c.meta = ContentMd5Meta
+	}
+	if c.algorithm == "" {
+		c.algorithm = "md5"
+	}
+	switch c.mode {
+	case "size_mtime", "size", "checksum", "meta", "always", "never":
+	default:
+		return nil, fmt.Errorf("unknown compare %q", c.mode)
+	}
+	if c.algorithm != "md5" && c.algorithm != "sha256" {
+		return nil, fmt.Errorf("unknown compare_meta_algorithm %q", c.algorithm)
+	}
+	return c, nil
+}
+
+// Always 是否总是传输,不需要获取目标信息
+func (c *Comparer) Always() bool {
+	return c.mode == "always"
+}
+
+// Skip 判断是否跳过,返回原因,如not_found,size_changed,up_to_date
+// 本地文件无法读取不能计算校验值时不跳过,原因为checksum_error,由传输时报告错误
+func (c *Comparer) Skip(src, dst *FileState) (bool, string) {
+	if c.mode == "always" {
+		return false, "replace"
+	}
+	if !dst.Exists {
+		return false, "not_found"
+	}
+	if c.mode == "never" {
+		return true, "exists"
+	}
+	if src.Size != dst.Size {
+		return false, "size_changed"
+	}
+	switch c.mode {
+	case "size":
+		return true, "up_to_date"
+	case "checksum":
+		dstMd5, dstErr := dst.md5()
+		if dstErr != nil {
+			return false, "checksum_error"
+		}
+		if dstMd5 != "" {
+			srcMd5, srcErr := src.md5()
+			if srcErr != nil {
+				return false, "checksum_error"
+			}
+			if srcMd5 != "" {
+				if srcMd5 != dstMd5 {
+					return false, "checksum_changed"
+				}
+				return true, "up_to_date"
+			}
+		}
+	case "meta":
+		dstMeta, dstErr := dst.meta(c.meta, c.algorithm)
+		if dstErr != nil {
+			return false, "checksum_error"
+		}
+		if dstMeta != "" {
+			srcMeta, srcErr := src.meta(c.meta, c.algorithm)
+			if srcErr != nil {
+				return false, "checksum_error"
+			}
+			if srcMeta != "" {
+				if !strings.EqualFold(srcMeta, dstMeta) {
+					return false, "meta_changed"
+				}
+				return true, "up_to_date"
+			}
+		}
+	}
+	if dst.ModTime.Unix() < src.ModTime.Unix() {
+		return false, "modified"
+	}
+	return true, "up_to_date"
+}
@@ -0,0 +1,119 @@
+package storageutil_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shideqin/storage/storageutil"
+)
+
+func TestHeadTime(t *testing.T) {
+	want := time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)
+	tests := []struct {
+		lastModified interface{}
+		want         time.Time
+	}{
+		{"Wed, 21 Oct 2015 07:28:00 GMT", want},
+		{"Wednesday, 21-Oct-15 07:28:00 GMT", want},
+		{"Wed Oct 21 07:28:00 2015", want},
+		{"2015-10-21T07:28:00Z", time.Time{}},
+		{"", time.Time{}},
+		{nil, time.Time{}},
+	}
+	for _, tt := range tests {
+		head := map[string]interface{}{}
+		if tt.lastModified != nil {
+			head["Last-Modified"] = tt.lastModified
+		}
+		if got := storageutil.HeadTime(head); !got.Equal(tt.want) {
+			t.Errorf("HeadTime(%v) = %v, want %v", tt.lastModified, got, tt.want)
+		}
+	}
+}
+
+func TestComparerSkip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localFile := filepath.Join(dir, "a.txt")
+	if err := ioutil.WriteFile(localFile, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(localFile, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(localFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const helloMd5 = "5d41402abc4b2a76b9719d911017c592"
+	newer := mtime.Add(time.Hour).Format(http.TimeFormat)
+	older := mtime.Add(-time.Hour).Format(http.TimeFormat)
+	head := func(size, lastModified, etag string, meta ...string) map[string]interface{} {
+		h := map[string]interface{}{"Content-Length": size, "Last-Modified": lastModified, "Etag": etag}
+		for i := 0; i+1 < len(meta); i += 2 {
+			h[meta[i]] = meta[i+1]
+		}
+		return h
+	}
+
+	tests := []struct {
+		name    string
+		options map[string]string
+		head    map[string]interface{}
+		skip    bool
+		reason  string
+	}{
+		{"not found", nil, nil, false, "not_found"},
+		{"size changed", nil, head("6", newer, `"x"`), false, "size_changed"},
+		{"remote newer", nil, head("5", newer, `"x"`), true, "up_to_date"},
+		{"remote older", nil, head("5", older, `"x"`), false, "modified"},
+		{"same second", nil, head("5", mtime.Format(http.TimeFormat), `"x"`), true, "up_to_date"},
+		{"recorded mtime", nil, head("5", newer, `"x"`, "X-Amz-Meta-Mtime", "1577930645.000000000"), false, "modified"},
+		{"size only", map[string]string{"compare": "size"}, head("5", older, `"x"`), true, "up_to_date"},
+		{"checksum equal", map[string]string{"compare": "checksum"}, head("5", older, `"`+helloMd5+`"`), true, "up_to_date"},
+		{"checksum changed", map[string]string{"compare": "checksum"}, head("5", newer, `"00000000000000000000000000000000"`), false, "checksum_changed"},
+		{"checksum multipart", map[string]string{"compare": "checksum"}, head("5", older, `"abc-2"`), false, "modified"},
+		{"checksum kms", map[string]string{"compare": "checksum"}, head("5", newer, `"abc"`, "X-Amz-Server-Side-Encryption", "aws:kms"), true, "up_to_date"},
+		{"meta equal", map[string]string{"compare": "meta"}, head("5", older, `"x-2"`, "X-Amz-Meta-Content-Md5", helloMd5), true, "up_to_date"},
+		{"meta changed", map[string]string{"compare": "meta"}, head("5", newer, `"x-2"`, "X-Amz-Meta-Content-Md5", "ff"), false, "meta_changed"},
+		{"never", map[string]string{"compare": "never"}, head("6", older, `"x"`), true, "exists"},
+		{"always", map[string]string{"compare": "always"}, head("5", newer, `"x"`), false, "replace"},
+		{"replace", map[string]string{"replace": "true"}, head("5", newer, `"x"`), false, "replace"},
+	}
+	for _, tt := range tests {
+		comparer, err := storageutil.NewComparer(tt.options)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		skip, reason := comparer.Skip(storageutil.LocalState(localFile, fi), storageutil.HeadState(tt.head, false))
+		if skip != tt.skip || reason != tt.reason {
+			t.Errorf("%s: Skip = %v, %q, want %v, %q", tt.name, skip, reason, tt.skip, tt.reason)
+		}
+	}
+
+	//本地文件无法读取时不能按大小和修改时间当作未修改
+	if err := os.Remove(localFile); err != nil {
+		t.Fatal(err)
+	}
+	for _, options := range []map[string]string{{"compare": "checksum"}, {"compare": "meta"}} {
+		comparer, _ := storageutil.NewComparer(options)
+		remote := head("5", newer, `"`+helloMd5+`"`, "X-Amz-Meta-Content-Md5", helloMd5)
+		if skip, reason := comparer.Skip(storageutil.LocalState(localFile, fi), storageutil.HeadState(remote, false)); skip || reason != "checksum_error" {
+			t.Errorf("%v unreadable: Skip = %v, %q, want false, checksum_error", options, skip, reason)
+		}
+	}
+
+	for _, options := range []map[string]string{{"compare": "mtime"}, {"compare": "meta", "compare_meta_algorithm": "sha1"}} {
+		if _, err := storageutil.NewComparer(options); err == nil {
+			t.Errorf("NewComparer(%v): expected error", options)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package storageutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// UncompressedSizeMeta 压缩上传时记录原始大小的元数据
+const UncompressedSizeMeta = "x-amz-meta-uncompressed-size"
+
+// Codec 压缩算法
+type Codec struct {
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+var codecs = map[string]Codec{
+	"gzip": {
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	},
+	"zstd": {
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w)
+		},
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			d, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		},
+	},
+}
+var codecLock sync.RWMutex
+
+// RegisterCodec 注册压缩算法,内置gzip和zstd
+func RegisterCodec(name string, codec Codec) {
+	codecLock.Lock()
+	defer codecLock.Unlock()
+	codecs[name] = codec
+}
+
+// GetCodec 获取压缩算法
+func GetCodec(name string) (Codec, bool) {
+	codecLock.RLock()
+	defer codecLock.RUnlock()
+	codec, ok := codecs[name]
+	return codec, ok
+}
+
+// CompressEncoding 根据options["compress"]和options["compress_suffix"]判断文件是否需要压缩
+func CompressEncoding(options map[string]string, fileName string) string {
+	encoding := options["compress"]
+	if encoding == "" {
+		return ""
+	}
+	if options["compress_suffix"] == "" {
+		return encoding
+	}
+	suffixList := strings.Split(options["compress_suffix"], ",")
+	for _, tmpSuffix := range suffixList {
+		if tmpSuffix != "" && strings.HasSuffix(strings.ToLower(fileName), tmpSuffix) {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// CompressFile 压缩文件到临时文件,返回临时文件路径
+func CompressFile(encoding, filePath string) (string, error) {
+	codec, ok := GetCodec(encoding)
+	if !ok {
+		return "", fmt.Errorf("compress %s not registered", encoding)
+	}
+	src, err := os.Open(filePath)
+	if src != nil {
+		defer src.Close()
+	}
+	if err != nil {
+		return "", err
+	}
+	dst, err := ioutil.TempFile("", "storage-compress")
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+	w, err := codec.NewWriter(dst)
+	if err == nil {
+		_, err = io.Copy(w, src)
+		if cErr := w.Close(); err == nil {
+			err = cErr
+		}
+	}
+	if err != nil {
+		_ = os.Remove(dst.Name())
+		return "", err
+	}
+	return dst.Name(), nil
+}
+
+// DecompressFile 原地解压文件,先解压到临时文件,成功后再替换原文件,失败时保留原文件
+func DecompressFile(encoding, filePath string) error {
+	codec, ok := GetCodec(encoding)
+	if !ok {
+		return fmt.Errorf("compress %s not registered", encoding)
+	}
+	src, err := os.Open(filePath)
+	if src != nil {
+		defer src.Close()
+	}
+	if err != nil {
+		return err
+	}
+	r, err := codec.NewReader(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	tmpFile := filePath + ".decompressed"
+	dst, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, r)
+	if cErr := dst.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil {
+		//先关闭原文件,Windows上不能替换打开的文件
+		_ = src.Close()
+		err = os.Rename(tmpFile, filePath)
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile)
+	}
+	return err
+}
+
+// Decompress 解压内容
+func Decompress(encoding string, body []byte) ([]byte, error) {
+	codec, ok := GetCodec(encoding)
+	if !ok {
+		return nil, fmt.Errorf("compress %s not registered", encoding)
+	}
+	r, err := codec.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// HeadSize 获取object大小,uncompressed为true时优先使用压缩前的原始大小
+func HeadSize(head map[string]interface{}, uncompressed bool) int64 {
+	var size int64
+	if l, ok := head["Content-Length"]; ok {
+		size, _ = strconv.ParseInt(l.(string), 10, 64)
+	}
+	if uncompressed {
+		if m, ok := HeadMeta(head)[UncompressedSizeMeta]; ok {
+			size, _ = strconv.ParseInt(m, 10, 64)
+		}
+	}
+	return size
+}
@@ -0,0 +1,120 @@
+package storageutil_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shideqin/storage/storageutil"
+)
+
+func TestCompressFileRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	body := bytes.Repeat([]byte("compress me "), 1000)
+	for _, encoding := range []string{"gzip", "zstd"} {
+		localFile := filepath.Join(dir, encoding+".txt")
+		if err := ioutil.WriteFile(localFile, body, 0644); err != nil {
+			t.Fatal(err)
+		}
+		compressed, err := storageutil.CompressFile(encoding, localFile)
+		if err != nil {
+			t.Fatalf("%s: CompressFile: %v", encoding, err)
+		}
+		defer os.Remove(compressed)
+		data, err := ioutil.ReadFile(compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) >= len(body) {
+			t.Errorf("%s: compressed %d bytes to %d", encoding, len(body), len(data))
+		}
+		if got, err := storageutil.Decompress(encoding, data); err != nil || !bytes.Equal(got, body) {
+			t.Errorf("%s: Decompress = %d bytes, %v", encoding, len(got), err)
+		}
+		if err := os.Rename(compressed, localFile); err != nil {
+			t.Fatal(err)
+		}
+		if err := storageutil.DecompressFile(encoding, localFile); err != nil {
+			t.Fatalf("%s: DecompressFile: %v", encoding, err)
+		}
+		if got, _ := ioutil.ReadFile(localFile); !bytes.Equal(got, body) {
+			t.Errorf("%s: DecompressFile body differs", encoding)
+		}
+	}
+}
+
+func TestDecompressFileCorrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, encoding := range []string{"gzip", "zstd"} {
+		localFile := filepath.Join(dir, encoding+".txt")
+		codec, _ := storageutil.GetCodec(encoding)
+		var compressed bytes.Buffer
+		w, err := codec.NewWriter(&compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write(bytes.Repeat([]byte("x"), 1000))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		//截断压缩内容
+		corrupt := compressed.Bytes()[:compressed.Len()-4]
+		if err := ioutil.WriteFile(localFile, corrupt, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := storageutil.DecompressFile(encoding, localFile); err == nil {
+			t.Errorf("%s: DecompressFile corrupt stream: expected error", encoding)
+		}
+		if got, _ := ioutil.ReadFile(localFile); !bytes.Equal(got, corrupt) {
+			t.Errorf("%s: local file changed after failed DecompressFile", encoding)
+		}
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("%d files left in dir, want 2", len(entries))
+	}
+}
+
+func TestCatDecompress(t *testing.T) {
+	server, client := newMirrorClient()
+	defer server.Close()
+	plain := bytes.Repeat([]byte("storage "), 1024)
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, _ = zw.Write(plain)
+	_ = zw.Close()
+	server.PutObject("bucket", "a.txt", compressed.Bytes(), http.Header{"Content-Encoding": {"gzip"}})
+
+	tests := []struct {
+		decompress string
+		want       []byte
+		encoding   string
+	}{
+		{"", plain, ""},
+		{"true", plain, ""},
+		{"false", compressed.Bytes(), "gzip"},
+	}
+	for _, tt := range tests {
+		resp, err := client.Cat("bucket", "a.txt", map[string]string{"decompress": tt.decompress})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resp["Body"].(*bytes.Buffer).Bytes(); !bytes.Equal(got, tt.want) {
+			t.Errorf("decompress=%q: body length %d, want %d", tt.decompress, len(got), len(tt.want))
+		}
+		if encoding, _ := resp["Content-Encoding"].(string); encoding != tt.encoding {
+			t.Errorf("decompress=%q: Content-Encoding = %q, want %q", tt.decompress, encoding, tt.encoding)
+		}
+	}
+}
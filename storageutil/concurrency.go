@@ -0,0 +1,86 @@
+package storageutil
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Throttle 记录服务端限流次数
+type Throttle struct {
+	count uint64
+}
+
+// Add 增加一次限流
+func (t *Throttle) Add() {
+	if t != nil {
+		atomic.AddUint64(&t.count, 1)
+	}
+}
+
+// Count 限流次数
+func (t *Throttle) Count() uint64 {
+	if t == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&t.count)
+}
+
+// Concurrency 自适应并发控制,出现限流时并发数减半,连续成功后逐步恢复到最大并发数
+type Concurrency struct {
+	lock     sync.Mutex
+	cond     *sync.Cond
+	max      int
+	limit    int
+	running  int
+	success  int
+	throttle *Throttle
+	seen     uint64
+}
+
+// NewConcurrency 实例化,throttle为nil时不自动调整
+func NewConcurrency(max int, throttle *Throttle) *Concurrency {
+	if max < 1 {
+		max = 1
+	}
+	c := &Concurrency{max: max, limit: max, throttle: throttle, seen: throttle.Count()}
+	c.cond = sync.NewCond(&c.lock)
+	return c
+}
+
+// Acquire 获取一个并发名额
+func (c *Concurrency) Acquire() {
+	c.lock.Lock()
+	for c.running >= c.limit {
+		c.cond.Wait()
+	}
+	c.running++
+	c.lock.Unlock()
+}
+
+// Release 释放并发名额,并根据限流次数调整并发数
+func (c *Concurrency) Release() {
+	c.lock.Lock()
+	c.running--
+	if count := c.throttle.Count(); count != c.seen {
+		c.seen = count
+		c.success = 0
+		if c.limit = c.limit / 2; c.limit < 1 {
+			c.limit = 1
+		}
+	} else if c.limit < c.max {
+		c.success++
+		if c.success >= c.limit {
+			c.success = 0
+			c.limit++
+		}
+	}
+	c.cond.Broadcast()
+	c.lock.Unlock()
+}
+
+// Limit 当前并发数
+func (c *Concurrency) Limit() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.limit
+}
@@ -0,0 +1,109 @@
+package storageutil_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shideqin/storage/storageutil"
+)
+
+func TestConcurrencyAdaptive(t *testing.T) {
+	throttle := &storageutil.Throttle{}
+	c := storageutil.NewConcurrency(4, throttle)
+	run := func(throttled bool) int {
+		c.Acquire()
+		if throttled {
+			throttle.Add()
+		}
+		c.Release()
+		return c.Limit()
+	}
+	//限流时减半,最少为1
+	for _, want := range []int{2, 1, 1} {
+		if got := run(true); got != want {
+			t.Fatalf("throttled: Limit = %d, want %d", got, want)
+		}
+	}
+	//连续成功limit次后加1,最多恢复到max
+	var limits []int
+	for i := 0; i < 12; i++ {
+		limits = append(limits, run(false))
+	}
+	want := []int{2, 2, 3, 3, 3, 4, 4, 4, 4, 4, 4, 4}
+	for i := range want {
+		if limits[i] != want[i] {
+			t.Fatalf("recovering: Limit = %v, want %v", limits, want)
+		}
+	}
+
+	//没有throttle时不调整
+	fixed := storageutil.NewConcurrency(2, nil)
+	fixed.Acquire()
+	fixed.Release()
+	if fixed.Limit() != 2 {
+		t.Errorf("without throttle: Limit = %d, want 2", fixed.Limit())
+	}
+}
+
+func TestConcurrencyAcquireBlocks(t *testing.T) {
+	c := storageutil.NewConcurrency(1, nil)
+	c.Acquire()
+	acquired := make(chan bool)
+	go func() {
+		c.Acquire()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("Acquire did not wait for Release")
+	case <-time.After(50 * time.Millisecond):
+	}
+	c.Release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Acquire still blocked after Release")
+	}
+	c.Release()
+}
+
+func TestRetryRequestLimit(t *testing.T) {
+	control := &storageutil.RequestControl{Limiter: storageutil.NewRequestLimiter(), Throttle: &storageutil.Throttle{}}
+	control.Limiter.SetBucketLimit("slow", 20)
+	request := func() (map[string]interface{}, error) {
+		return map[string]interface{}{"StatusCode": 503}, nil
+	}
+	//令牌桶初始为空,20个/秒发送10个请求至少需要0.5秒
+	tests := []struct {
+		bucket  string
+		limited bool
+	}{
+		{"fast", false},
+		{"slow", true},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		for i := 0; i < 10; i++ {
+			if _, err := storageutil.Retry(control, tt.bucket, request); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if limited := time.Since(start) >= 400*time.Millisecond; limited != tt.limited {
+			t.Errorf("%s: took %v, limited = %v, want %v", tt.bucket, time.Since(start), limited, tt.limited)
+		}
+	}
+	//503记为限流
+	if count := control.Throttle.Count(); count != 20 {
+		t.Errorf("Throttle.Count = %d, want 20", count)
+	}
+
+	//client限制对所有bucket生效
+	control.Limiter.SetLimit(20)
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		_, _ = storageutil.Retry(control, "fast", request)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("client limit: took %v, want at least 400ms", elapsed)
+	}
+}
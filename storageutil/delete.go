@@ -0,0 +1,66 @@
+package storageutil
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+
+	"github.com/shideqin/storage/storagebase"
+)
+
+// DeleteMaxKeys 一次批量删除请求最多的object数
+const DeleteMaxKeys = 1000
+
+// ObjectIdentifiers 不指定版本的object列表
+func ObjectIdentifiers(keys []string) []storagebase.ObjectIdentifier {
+	objects := make([]storagebase.ObjectIdentifier, len(keys))
+	for i, key := range keys {
+		objects[i].Key = key
+	}
+	return objects
+}
+
+// DeleteBody 批量删除请求的body,key转义为xml,Quiet模式只返回失败的object
+func DeleteBody(objects []storagebase.ObjectIdentifier) string {
+	var body bytes.Buffer
+	body.WriteString("<Delete><Quiet>true</Quiet>")
+	for _, object := range objects {
+		body.WriteString("<Object><Key>")
+		_ = xml.EscapeText(&body, []byte(object.Key))
+		body.WriteString("</Key>")
+		if object.VersionID != "" {
+			body.WriteString("<VersionId>")
+			_ = xml.EscapeText(&body, []byte(object.VersionID))
+			body.WriteString("</VersionId>")
+		}
+		body.WriteString("</Object>")
+	}
+	body.WriteString("</Delete>")
+	return body.String()
+}
+
+// DeleteErrors 批量删除结果中失败的object
+func DeleteErrors(result *storagebase.DeleteResult) map[storagebase.ObjectIdentifier]error {
+	errs := make(map[storagebase.ObjectIdentifier]error)
+	if result == nil {
+		return errs
+	}
+	for _, e := range result.Error {
+		errs[storagebase.ObjectIdentifier{Key: e.Key, VersionID: e.VersionID}] = fmt.Errorf("Code: %s Message: %s", e.Code, e.Message)
+	}
+	return errs
+}
+
+// DeleteFailures 批量删除结果中失败的object,没有失败时返回nil
+func DeleteFailures(operation string, results []storagebase.DeleteObjectResult) error {
+	var failures []storagebase.FailedItem
+	for _, r := range results {
+		if r.Err != nil {
+			failures = append(failures, storagebase.FailedItem{Key: r.Key, Err: r.Err, Attempts: 1})
+		}
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return &storagebase.BulkError{Operation: operation, Failures: failures}
+}
@@ -0,0 +1,113 @@
+package storageutil_test
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/shideqin/storage/storagebase"
+	"github.com/shideqin/storage/storageutil"
+)
+
+func TestDeleteBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects []storagebase.ObjectIdentifier
+		want    string
+	}{
+		{"empty", nil, "<Delete><Quiet>true</Quiet></Delete>"},
+		{"plain", storageutil.ObjectIdentifiers([]string{"a.txt", "dir/b.txt"}),
+			"<Delete><Quiet>true</Quiet><Object><Key>a.txt</Key></Object><Object><Key>dir/b.txt</Key></Object></Delete>"},
+		{"escape", []storagebase.ObjectIdentifier{{Key: `a&b<c>"d'.txt`, VersionID: "v<1>"}},
+			"<Delete><Quiet>true</Quiet><Object><Key>a&amp;b&lt;c&gt;&#34;d&#39;.txt</Key><VersionId>v&lt;1&gt;</VersionId></Object></Delete>"},
+		{"control", []storagebase.ObjectIdentifier{{Key: "a\tb\nc"}},
+			"<Delete><Quiet>true</Quiet><Object><Key>a&#x9;b&#xA;c</Key></Object></Delete>"},
+	}
+	for _, tt := range tests {
+		body := storageutil.DeleteBody(tt.objects)
+		if body != tt.want {
+			t.Errorf("%s: DeleteBody = %s, want %s", tt.name, body, tt.want)
+		}
+		//解析后与原key相同
+		var parsed struct {
+			Object []struct {
+				Key       string `xml:"Key"`
+				VersionID string `xml:"VersionId"`
+			} `xml:"Object"`
+		}
+		if err := xml.Unmarshal([]byte(body), &parsed); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(parsed.Object) != len(tt.objects) {
+			t.Errorf("%s: parsed %d objects, want %d", tt.name, len(parsed.Object), len(tt.objects))
+			continue
+		}
+		for i, object := range tt.objects {
+			if parsed.Object[i].Key != object.Key || parsed.Object[i].VersionID != object.VersionID {
+				t.Errorf("%s: parsed %+v, want %+v", tt.name, parsed.Object[i], object)
+			}
+		}
+	}
+}
+
+func TestDeleteErrors(t *testing.T) {
+	body := `<DeleteResult><Deleted><Key>a.txt</Key></Deleted>` +
+		`<Error><Key>b.txt</Key><Code>AccessDenied</Code><Message>Access Denied</Message></Error>` +
+		`<Error><Key>b.txt</Key><VersionId>v1</VersionId><Code>NoSuchVersion</Code><Message>Not Found</Message></Error></DeleteResult>`
+	var result storagebase.DeleteResult
+	if err := xml.Unmarshal([]byte(body), &result); err != nil {
+		t.Fatal(err)
+	}
+	errs := storageutil.DeleteErrors(&result)
+	if len(errs) != 2 || errs[storagebase.ObjectIdentifier{Key: "a.txt"}] != nil {
+		t.Fatalf("DeleteErrors = %v", errs)
+	}
+	//同一个key的不同版本分别返回
+	if err := errs[storagebase.ObjectIdentifier{Key: "b.txt", VersionID: "v1"}]; err == nil || !strings.Contains(err.Error(), "NoSuchVersion") {
+		t.Errorf("version error = %v", err)
+	}
+	if len(storageutil.DeleteErrors(nil)) != 0 {
+		t.Error("DeleteErrors(nil) not empty")
+	}
+}
+
+func TestDeleteObjectsBatches(t *testing.T) {
+	server, client := newMirrorClient()
+	defer server.Close()
+	keys := make([]string, 2500)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%04d.txt", i)
+		server.PutObject("bucket", keys[i], []byte("a"), nil)
+	}
+	//第2批删除请求失败
+	batch := 0
+	server.SetFailure(func(r *http.Request) bool {
+		if _, ok := r.URL.Query()["delete"]; ok {
+			batch++
+			return batch == 2
+		}
+		return false
+	})
+	results, err := client.DeleteObjects("bucket", storageutil.ObjectIdentifiers(keys), map[string]string{"thread_num": "1"}, nil)
+	var bulkErr *storagebase.BulkError
+	if !errors.As(err, &bulkErr) || len(bulkErr.Failures) != storageutil.DeleteMaxKeys {
+		t.Fatalf("DeleteObjects error = %v, want %d failures", err, storageutil.DeleteMaxKeys)
+	}
+	if batch != 3 || len(results) != len(keys) {
+		t.Fatalf("DeleteObjects sent %d batches with %d results, want 3 and %d", batch, len(results), len(keys))
+	}
+	//每个key按原顺序返回结果,失败的批次中的object保留
+	for i, r := range results {
+		failed := i >= 1000 && i < 2000
+		if r.Key != keys[i] || (r.Err != nil) != failed {
+			t.Fatalf("result %d = %+v, want key %s failed %v", i, r, keys[i], failed)
+		}
+		if (server.Object("bucket", keys[i]) != nil) != failed {
+			t.Fatalf("%s: exists %v, want %v", keys[i], !failed, failed)
+		}
+	}
+}
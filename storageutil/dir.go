@@ -0,0 +1,237 @@
+package storageutil
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/shideqin/storage/storagebase"
+)
+
+// UploadFromDir 上传目录,client用于比较和上传标记object,upload上传一个文件,headState为比较用的object信息,nil时使用HeadState
+// 传给upload的options为每个文件单独的副本,已设置disposition并去掉checkpoint_file
+// 同时支持dry_run,continue_on_error,item_attempts,compare和include/exclude等过滤参数
+func UploadFromDir(client storagebase.IClient, localDir, bucket, prefix string, options map[string]string, listener storagebase.ProgressListener, threadNum int, throttle *Throttle, headState func(head map[string]interface{}) *FileState, upload func(localFile, object string, options map[string]string, listener storagebase.ProgressListener) error) (map[string]int, error) {
+	if prefix != "" {
+		prefix = strings.TrimSuffix(prefix, "/") + "/"
+	}
+	localDir = strings.TrimSuffix(localDir, "/") + "/"
+	if headState == nil {
+		headState = func(head map[string]interface{}) *FileState {
+			return HeadState(head, true)
+		}
+	}
+	var total int
+	var queueMaxSize = NewConcurrency(threadNum, throttle)
+	progress := NewProgress(listener, "UploadFromDir", prefix, 0, 0)
+	var tmpSize int64
+	var tmpSkip int64
+	var tmpFinish int64
+	var wg sync.WaitGroup
+	bulk := NewBulk("UploadFromDir", options)
+	dryRun := DryRun(options)
+	filter, filterErr := NewFilter(options)
+	if filterErr != nil {
+		return nil, fmt.Errorf(" UploadFromDir Filter Error: %v", filterErr)
+	}
+	comparer, compareErr := NewComparer(options)
+	if compareErr != nil {
+		return nil, fmt.Errorf(" UploadFromDir Compare Error: %v", compareErr)
+	}
+	//边遍历边上传,总数随遍历增加
+	stop := make(chan struct{})
+	defer close(stop)
+	progress.SetEstimating(true)
+	for entry := range WalkStream(localDir, options, stop) {
+		if bulk.Exit() {
+			break
+		}
+		total++
+		progress.AddTotal(0, 1)
+		wg.Add(1)
+		queueMaxSize.Acquire()
+		go func(entry WalkEntry) {
+			defer func() {
+				wg.Done()
+				queueMaxSize.Release()
+			}()
+			fileName := entry.Name
+			object := prefix + fileName
+			var action, reason string
+			var itemSize int64
+			err := bulk.Do(fileName, func() error {
+				action, reason = "upload", "replace"
+				if entry.Err != nil {
+					return fmt.Errorf(" UploadFromDir Read localFile: %s%s Error: %v", localDir, fileName, entry.Err)
+				}
+				if entry.Skip != "" {
+					action, reason = "skip", entry.Skip
+					atomic.AddInt64(&tmpSkip, 1)
+					return nil
+				}
+				isSkipped := false
+				localFileStat := entry.Info
+				if ok, why := filter.MatchFile(fileName, localFileStat); !ok {
+					action, reason = "skip", why
+					atomic.AddInt64(&tmpSkip, 1)
+					return nil
+				}
+				//空目录和符号链接上传为标记object
+				if entry.Marker() {
+					if !comparer.Always() {
+						var objectHead, _ = client.Head(bucket, object, options)
+						if SameMarker(objectHead, entry) {
+							action, reason = "skip", "up_to_date"
+							atomic.AddInt64(&tmpSkip, 1)
+							return nil
+						}
+					}
+					if !dryRun {
+						if err := PutMarker(client, bucket, object, entry, options); err != nil {
+							return err
+						}
+					}
+					atomic.AddInt64(&tmpFinish, 1)
+					return nil
+				}
+				localFileSize := localFileStat.Size()
+				if !comparer.Always() {
+					var objectHead, _ = client.Head(bucket, object, options)
+					isSkipped, reason = comparer.Skip(LocalState(localDir+fileName, localFileStat), headState(objectHead))
+				}
+				if isSkipped {
+					action = "skip"
+					atomic.AddInt64(&tmpSkip, 1)
+				}
+				itemSize = localFileSize
+				if !isSkipped && dryRun {
+					atomic.AddInt64(&tmpSize, localFileSize)
+					atomic.AddInt64(&tmpFinish, 1)
+				} else if !isSkipped {
+					//分块上传的参数按文件区分,不共用断点文件
+					uploadOptions := make(map[string]string, len(options)+1)
+					for k, v := range options {
+						uploadOptions[k] = v
+					}
+					uploadOptions["disposition"] = fileName
+					delete(uploadOptions, "checkpoint_file")
+					progress.AddTotal(localFileSize, 0)
+					if err := upload(localDir+fileName, object, uploadOptions, progress.Child()); err != nil {
+						return err
+					}
+					atomic.AddInt64(&tmpSize, localFileSize)
+					atomic.AddInt64(&tmpFinish, 1)
+				}
+				return nil
+			})
+			progress.Action(object, action, reason, itemSize, err)
+		}(entry)
+	}
+	progress.SetEstimating(false)
+	wg.Wait()
+	skip := int(atomic.LoadInt64(&tmpSkip))
+	finish := int(atomic.LoadInt64(&tmpFinish))
+	size := int(atomic.LoadInt64(&tmpSize))
+	return bulk.Result(map[string]int{"Total": total, "Skip": skip, "Finish": finish, "Size": size})
+}
+
+// DownloadAllObject 下载目录,client用于列表和比较,get下载一个object到localFile,headState为比较用的object信息,nil时使用HeadState
+// 同时支持dry_run,continue_on_error,item_attempts,compare和include/exclude等过滤参数
+func DownloadAllObject(client storagebase.IClient, bucket, prefix, localDir string, options map[string]string, listener storagebase.ProgressListener, threadNum int, throttle *Throttle, headState func(head map[string]interface{}) *FileState, get func(object, localFile string, listener storagebase.ProgressListener) error) (map[string]int, error) {
+	if headState == nil {
+		headState = func(head map[string]interface{}) *FileState {
+			return HeadState(head, true)
+		}
+	}
+	marker := ""
+	total := 0
+	var queueMaxSize = NewConcurrency(threadNum, throttle)
+	var tmpSkip int64
+	var tmpFinish int64
+	var wg sync.WaitGroup
+	bulk := NewBulk("DownloadAllObject", options)
+	dryRun := DryRun(options)
+	filter, filterErr := NewFilter(options)
+	if filterErr != nil {
+		return nil, fmt.Errorf(" DownloadAllObject Filter Error: %v", filterErr)
+	}
+	comparer, compareErr := NewComparer(options)
+	if compareErr != nil {
+		return nil, fmt.Errorf(" DownloadAllObject Compare Error: %v", compareErr)
+	}
+	progress := NewProgress(listener, "DownloadAllObject", prefix, 0, 0)
+LIST:
+	list, err := client.ListObject(bucket, map[string]string{"prefix": prefix, "marker": marker, "max-keys": "1000"})
+	if err != nil {
+		return nil, err
+	}
+	objectNum := len(list.Contents)
+	total += objectNum
+	progress.AddTotal(0, objectNum)
+	for fileNum := 0; fileNum < objectNum; fileNum++ {
+		if bulk.Exit() {
+			break
+		}
+		wg.Add(1)
+		queueMaxSize.Acquire()
+		go func(objectInfo storagebase.ListObjectContents) {
+			defer func() {
+				wg.Done()
+				queueMaxSize.Release()
+			}()
+			var action, reason string
+			var itemSize int64
+			err := bulk.Do(objectInfo.Key, func() error {
+				action, reason = "download", "replace"
+				if ok, why := filter.MatchObject(prefix, objectInfo); !ok {
+					action, reason = "skip", why
+					atomic.AddInt64(&tmpSkip, 1)
+					return nil
+				}
+				localFile := strings.TrimSuffix(localDir, "/") + "/" + objectInfo.Key
+				//空目录标记object创建本地目录
+				if strings.HasSuffix(objectInfo.Key, "/") {
+					if !dryRun {
+						if err := os.MkdirAll(localFile, 0755); err != nil {
+							return fmt.Errorf(" DownloadAllObject MkdirAll localDir: %s Error: %v", localFile, err)
+						}
+					}
+					atomic.AddInt64(&tmpFinish, 1)
+					return nil
+				}
+				isSkipped := false
+				if !comparer.Always() {
+					var objectHead, _ = client.Head(bucket, objectInfo.Key, options)
+					fileStat, _ := os.Stat(localFile)
+					isSkipped, reason = comparer.Skip(headState(objectHead), LocalState(localFile, fileStat))
+				}
+				if isSkipped {
+					action = "skip"
+					atomic.AddInt64(&tmpSkip, 1)
+				}
+				itemSize = int64(objectInfo.Size)
+				if !isSkipped && dryRun {
+					atomic.AddInt64(&tmpFinish, 1)
+				} else if !isSkipped {
+					progress.AddTotal(int64(objectInfo.Size), 0)
+					if err := get(objectInfo.Key, localFile, progress.Child()); err != nil {
+						return err
+					}
+					atomic.AddInt64(&tmpFinish, 1)
+				}
+				return nil
+			})
+			progress.Action(objectInfo.Key, action, reason, itemSize, err)
+		}(list.Contents[fileNum])
+	}
+	wg.Wait()
+	if !bulk.Exit() && list.IsTruncated == "true" {
+		marker = list.Contents[objectNum-1].Key
+		goto LIST
+	}
+	skip := int(atomic.LoadInt64(&tmpSkip))
+	finish := int(atomic.LoadInt64(&tmpFinish))
+	return bulk.Result(map[string]int{"Total": total, "Skip": skip, "Finish": finish})
+}
@@ -0,0 +1,53 @@
+package storageutil_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUploadFromDirStreaming(t *testing.T) {
+	server, client := newMirrorClient()
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listener := &progressRecorder{}
+	//单线程时第1个文件上传完成前遍历不会结束
+	var first *bool
+	server.SetFailure(func(r *http.Request) bool {
+		if r.Method == http.MethodPut && first == nil {
+			listener.lock.Lock()
+			estimating := false
+			if n := len(listener.events); n > 0 {
+				estimating = listener.events[n-1].Estimating && listener.events[n-1].TotalItems < 3
+			}
+			listener.lock.Unlock()
+			first = &estimating
+		}
+		return false
+	})
+	result, err := client.UploadFromDir(dir, "bucket", "dir", map[string]string{"thread_num": "1"}, listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result["Total"] != 3 || result["Finish"] != 3 {
+		t.Errorf("UploadFromDir = %v", result)
+	}
+	if first == nil || !*first {
+		t.Error("first upload did not start while the walk was still estimating the total")
+	}
+	last := listener.check(t, "UploadFromDir")
+	if last.Estimating || last.TotalItems != 3 || last.DoneItems != 3 {
+		t.Errorf("last event %+v, want final total 3", last)
+	}
+}
@@ -0,0 +1,246 @@
+package storageutil
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shideqin/storage/storagebase"
+)
+
+// Filter 批量操作的文件过滤,exclude优先,设置了include时必须匹配其中一个
+// options:
+//
+//	include/exclude: 逗号分隔的glob,如*.jpg,logs/**,不含/时只匹配文件名
+//	suffix: 逗号分隔的后缀,不区分大小写,只处理匹配其中一个的文件,所有批量操作含义相同
+//	include_regex/exclude_regex: 正则,匹配相对路径
+//	min_size/max_size: 文件大小,字节
+//	modified_after/modified_before: 修改时间,RFC3339或2006-01-02
+//	filter_file: 规则文件,每行一条"名称 值",名称同上,#开头为注释
+type Filter struct {
+	include        []*regexp.Regexp
+	exclude        []*regexp.Regexp
+	suffix         []string
+	minSize        int64
+	maxSize        int64
+	modifiedAfter  time.Time
+	modifiedBefore time.Time
+}
+
+// NewFilter 根据options创建过滤器
+func NewFilter(options map[string]string) (*Filter, error) {
+	f := &Filter{minSize: -1, maxSize: -1}
+	for _, name := range []string{"include", "exclude", "include_regex", "exclude_regex", "suffix", "min_size", "max_size", "modified_after", "modified_before"} {
+		if options[name] == "" {
+			continue
+		}
+		if err := f.add(name, options[name]); err != nil {
+			return nil, err
+		}
+	}
+	if options["filter_file"] != "" {
+		if err := f.load(options["filter_file"]); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (f *Filter) load(filterFile string) error {
+	fd, err := os.Open(filterFile)
+	if err != nil {
+		return fmt.Errorf("open filter file %s: %v", filterFile, err)
+	}
+	defer fd.Close()
+	scanner := bufio.NewScanner(fd)
+	line := 0
+	for scanner.Scan() {
+		line++
+		rule := strings.TrimSpace(scanner.Text())
+		if rule == "" || strings.HasPrefix(rule, "#") {
+			continue
+		}
+		fields := strings.SplitN(rule, " ", 2)
+		if len(fields) != 2 {
+			return fmt.Errorf("filter file %s line %d: invalid rule %q", filterFile, line, rule)
+		}
+		if err := f.add(fields[0], strings.TrimSpace(fields[1])); err != nil {
+			return fmt.Errorf("filter file %s line %d: %v", filterFile, line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func (f *Filter) add(name, value string) error {
+	var err error
+	switch name {
+	case "include", "exclude":
+		for _, pattern := range strings.Split(value, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern == "" {
+				continue
+			}
+			re, gErr := globRegexp(pattern)
+			if gErr != nil {
+				return fmt.Errorf("%s %q: %v", name, pattern, gErr)
+			}
+			if name == "include" {
+				f.include = append(f.include, re)
+			} else {
+				f.exclude = append(f.exclude, re)
+			}
+		}
+	case "include_regex", "exclude_regex":
+		re, rErr := regexp.Compile(value)
+		if rErr != nil {
+			return fmt.Errorf("%s %q: %v", name, value, rErr)
+		}
+		if name == "include_regex" {
+			f.include = append(f.include, re)
+		} else {
+			f.exclude = append(f.exclude, re)
+		}
+	case "suffix":
+		for _, suffix := range strings.Split(value, ",") {
+			if suffix = strings.TrimSpace(suffix); suffix != "" {
+				f.suffix = append(f.suffix, strings.ToLower(suffix))
+			}
+		}
+	case "min_size":
+		f.minSize, err = strconv.ParseInt(value, 10, 64)
+	case "max_size":
+		f.maxSize, err = strconv.ParseInt(value, 10, 64)
+	case "modified_after":
+		f.modifiedAfter, err = parseFilterTime(value)
+	case "modified_before":
+		f.modifiedBefore, err = parseFilterTime(value)
+	default:
+		return fmt.Errorf("unknown filter %q", name)
+	}
+	if err != nil {
+		return fmt.Errorf("%s %q: %v", name, value, err)
+	}
+	return nil
+}
+
+// Match 判断文件是否需要处理,key为相对路径,size小于0或modTime为零值时不按大小或时间过滤,不处理时返回原因
+func (f *Filter) Match(key string, size int64, modTime time.Time) (bool, string) {
+	if f == nil {
+		return true, ""
+	}
+	for _, re := range f.exclude {
+		if re.MatchString(key) {
+			return false, "exclude"
+		}
+	}
+	if len(f.include) > 0 {
+		included := false
+		for _, re := range f.include {
+			if re.MatchString(key) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false, "include"
+		}
+	}
+	if len(f.suffix) > 0 {
+		matched := false
+		for _, suffix := range f.suffix {
+			if strings.HasSuffix(strings.ToLower(key), suffix) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, "suffix"
+		}
+	}
+	if size >= 0 {
+		if f.minSize >= 0 && size < f.minSize {
+			return false, "min_size"
+		}
+		if f.maxSize >= 0 && size > f.maxSize {
+			return false, "max_size"
+		}
+	}
+	if !modTime.IsZero() {
+		if !f.modifiedAfter.IsZero() && !modTime.After(f.modifiedAfter) {
+			return false, "modified_after"
+		}
+		if !f.modifiedBefore.IsZero() && !modTime.Before(f.modifiedBefore) {
+			return false, "modified_before"
+		}
+	}
+	return true, ""
+}
+
+// MatchFile 判断本地文件是否需要处理,name为相对目录的路径
+func (f *Filter) MatchFile(name string, fi os.FileInfo) (bool, string) {
+	return f.Match(name, fi.Size(), fi.ModTime())
+}
+
+// MatchObject 判断列表中的object是否需要处理,按相对prefix的路径匹配
+func (f *Filter) MatchObject(prefix string, object storagebase.ListObjectContents) (bool, string) {
+	modTime, _ := time.Parse(time.RFC3339, object.LastModified)
+	return f.Match(strings.TrimPrefix(object.Key, prefix), int64(object.Size), modTime)
+}
+
+func parseFilterTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// globRegexp glob转正则,**匹配多级目录,*和?不匹配/,不含/时只匹配文件名
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	if _, err := path.Match(strings.Replace(pattern, "**", "*", -1), ""); err != nil {
+		return nil, err
+	}
+	var expr strings.Builder
+	if strings.Contains(pattern, "/") {
+		expr.WriteString("^")
+		pattern = strings.TrimPrefix(pattern, "/")
+	} else {
+		expr.WriteString("(^|/)")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				expr.WriteString(".*")
+				i++
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				return nil, path.ErrBadPattern
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				expr.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			}
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
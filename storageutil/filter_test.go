@@ -0,0 +1,112 @@
+package storageutil_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shideqin/storage/storageutil"
+)
+
+func TestFilterMatch(t *testing.T) {
+	day := func(s string) time.Time {
+		tm, _ := time.Parse("2006-01-02", s)
+		return tm
+	}
+	tests := []struct {
+		name    string
+		options map[string]string
+		key     string
+		size    int64
+		modTime time.Time
+		ok      bool
+		reason  string
+	}{
+		{"no rules", nil, "a/b.txt", 1, time.Time{}, true, ""},
+		{"glob basename", map[string]string{"include": "*.jpg"}, "a/b/c.jpg", -1, time.Time{}, true, ""},
+		{"glob basename miss", map[string]string{"include": "*.jpg"}, "a/b/c.png", -1, time.Time{}, false, "include"},
+		{"glob star stays in dir", map[string]string{"include": "a/*.jpg"}, "a/b/c.jpg", -1, time.Time{}, false, "include"},
+		{"glob double star", map[string]string{"include": "a/**.jpg"}, "a/b/c.jpg", -1, time.Time{}, true, ""},
+		{"glob anchored", map[string]string{"include": "logs/**"}, "x/logs/a", -1, time.Time{}, false, "include"},
+		{"glob question", map[string]string{"include": "?.txt"}, "dir/a.txt", -1, time.Time{}, true, ""},
+		{"glob class", map[string]string{"include": "[!a]*.txt"}, "a1.txt", -1, time.Time{}, false, "include"},
+		{"glob escape", map[string]string{"include": `\*.txt`}, "*.txt", -1, time.Time{}, true, ""},
+		{"glob list", map[string]string{"include": "*.jpg, *.png"}, "c.png", -1, time.Time{}, true, ""},
+		{"exclude wins", map[string]string{"include": "*.jpg", "exclude": "tmp/**"}, "tmp/a.jpg", -1, time.Time{}, false, "exclude"},
+		{"regex", map[string]string{"include_regex": `^20\d\d/`}, "2021/a", -1, time.Time{}, true, ""},
+		{"exclude regex", map[string]string{"exclude_regex": `\.bak$`}, "a.bak", -1, time.Time{}, false, "exclude"},
+		{"suffix", map[string]string{"suffix": ".jpg,.PNG"}, "A.png", -1, time.Time{}, true, ""},
+		{"suffix miss", map[string]string{"suffix": ".jpg"}, "a.txt", -1, time.Time{}, false, "suffix"},
+		{"min size", map[string]string{"min_size": "10"}, "a", 9, time.Time{}, false, "min_size"},
+		{"max size", map[string]string{"max_size": "10"}, "a", 11, time.Time{}, false, "max_size"},
+		{"size bounds", map[string]string{"min_size": "10", "max_size": "10"}, "a", 10, time.Time{}, true, ""},
+		{"unknown size", map[string]string{"min_size": "10"}, "a", -1, time.Time{}, true, ""},
+		{"modified after", map[string]string{"modified_after": "2021-01-01"}, "a", -1, day("2021-01-01"), false, "modified_after"},
+		{"modified after ok", map[string]string{"modified_after": "2021-01-01"}, "a", -1, day("2021-01-02"), true, ""},
+		{"modified before", map[string]string{"modified_before": "2021-01-01T00:00:00Z"}, "a", -1, day("2021-01-01"), false, "modified_before"},
+		{"unknown time", map[string]string{"modified_before": "2021-01-01"}, "a", -1, time.Time{}, true, ""},
+	}
+	for _, tt := range tests {
+		filter, err := storageutil.NewFilter(tt.options)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		ok, reason := filter.Match(tt.key, tt.size, tt.modTime)
+		if ok != tt.ok || reason != tt.reason {
+			t.Errorf("%s: Match(%q) = %v, %q, want %v, %q", tt.name, tt.key, ok, reason, tt.ok, tt.reason)
+		}
+	}
+}
+
+func TestFilterInvalid(t *testing.T) {
+	for _, options := range []map[string]string{
+		{"include": "[a"},
+		{"include_regex": "("},
+		{"min_size": "abc"},
+		{"modified_after": "yesterday"},
+	} {
+		if _, err := storageutil.NewFilter(options); err == nil {
+			t.Errorf("NewFilter(%v): expected error", options)
+		}
+	}
+}
+
+func TestFilterFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filterFile := filepath.Join(dir, "filter")
+	rules := "# 注释\n\ninclude *.log\nexclude debug/**\nmax_size 100\n"
+	if err := ioutil.WriteFile(filterFile, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	filter, err := storageutil.NewFilter(map[string]string{"filter_file": filterFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		key  string
+		size int64
+		ok   bool
+	}{
+		{"a.log", 1, true},
+		{"a.txt", 1, false},
+		{"debug/a.log", 1, false},
+		{"a.log", 101, false},
+	}
+	for _, tt := range tests {
+		if ok, _ := filter.Match(tt.key, tt.size, time.Time{}); ok != tt.ok {
+			t.Errorf("Match(%q, %d) = %v, want %v", tt.key, tt.size, ok, tt.ok)
+		}
+	}
+	if err := ioutil.WriteFile(filterFile, []byte("include\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storageutil.NewFilter(map[string]string{"filter_file": filterFile}); err == nil {
+		t.Error("invalid filter file: expected error")
+	}
+}
@@ -0,0 +1,78 @@
+package storageutil
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// contentOptionHeaders 内容相关参数对应的header
+var contentOptionHeaders = map[string]string{
+	"content_type":        "Content-Type",
+	"content_encoding":    "Content-Encoding",
+	"cache_control":       "Cache-Control",
+	"content_disposition": "Content-Disposition",
+}
+
+// ContentOptions 将options中的内容参数(content_type,content_encoding,cache_control,content_disposition,disposition)合并到dst
+func ContentOptions(dst, options map[string]string) map[string]string {
+	if dst == nil {
+		dst = make(map[string]string)
+	}
+	for k := range contentOptionHeaders {
+		if options[k] != "" {
+			dst[k] = options[k]
+		}
+	}
+	if options["disposition"] != "" {
+		dst["disposition"] = options["disposition"]
+	}
+	return dst
+}
+
+// ContentHeaders 创建文件时的内容header(Put/InitUpload/Copy REPLACE),disposition为下载文件名,优先于content_disposition
+func ContentHeaders(options map[string]string) map[string]string {
+	headers := make(map[string]string)
+	for k, header := range contentOptionHeaders {
+		if options[k] != "" {
+			headers[header] = options[k]
+		}
+	}
+	if options["disposition"] != "" {
+		headers["Content-Disposition"] = fmt.Sprintf(`attachment; filename="%s"`, options["disposition"])
+	}
+	return headers
+}
+
+// CopySource 复制时x-amz-copy-source的值,options["source_version_id"]不为空时复制源文件的指定版本
+func CopySource(source string, options map[string]string) string {
+	if options["source_version_id"] == "" {
+		return source
+	}
+	return source + "?versionId=" + url.QueryEscape(options["source_version_id"])
+}
+
+// SourceHeaderOptions 将源文件Head结果中的内容header和自定义元数据合并到dst,dst中已有的参数不覆盖
+// 用于分块复制和跨客户端同步等服务端不复制元数据的操作,options["metadata_directive"]为REPLACE时不合并
+func SourceHeaderOptions(dst map[string]string, head map[string]interface{}, options map[string]string) map[string]string {
+	if dst == nil {
+		dst = make(map[string]string)
+	}
+	if strings.EqualFold(options["metadata_directive"], "REPLACE") {
+		return dst
+	}
+	for k, header := range contentOptionHeaders {
+		if k == "content_disposition" && dst["disposition"] != "" {
+			continue
+		}
+		if v, ok := head[header].(string); ok && v != "" && dst[k] == "" {
+			dst[k] = v
+		}
+	}
+	for k, v := range HeadMeta(head) {
+		if _, ok := dst[k]; !ok {
+			dst[k] = v
+		}
+	}
+	return dst
+}
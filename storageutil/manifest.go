@@ -0,0 +1,407 @@
+package storageutil
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/shideqin/storage/storagebase"
+)
+
+var errManifestStopped = errors.New("manifest stopped")
+
+// ManifestItem 清单中的一行
+type ManifestItem struct {
+	//行号,从1开始
+	Line      int
+	Bucket    string
+	Key       string
+	VersionID string
+	//其余的列,如dest_bucket,dest_key,tags,metadata,restore_days
+	Fields map[string]string
+}
+
+// field 获取行中的列,没有时使用options中的同名参数
+func (item ManifestItem) field(name string, options map[string]string) string {
+	if v := item.Fields[name]; v != "" {
+		return v
+	}
+	return options[name]
+}
+
+// ReadManifest 按行读取清单,fn返回错误时停止读取
+// format为csv或jsonl,为空时按扩展名判断,.jsonl和.json为jsonl,其他为csv
+// csv第一行包含bucket和key列时作为表头,否则按bucket,key,version_id的顺序;jsonl每行一个json对象,列名同csv表头
+func ReadManifest(manifestFile, format string, fn func(item ManifestItem) error) error {
+	fd, err := os.Open(manifestFile)
+	if fd != nil {
+		defer fd.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if format == "" {
+		format = "csv"
+		if ext := strings.ToLower(filepath.Ext(manifestFile)); ext == ".jsonl" || ext == ".json" {
+			format = "jsonl"
+		}
+	}
+	switch format {
+	case "csv":
+		return readManifestCSV(fd, fn)
+	case "jsonl":
+		return readManifestJSONL(fd, fn)
+	}
+	return fmt.Errorf("unknown manifest format %q", format)
+}
+
+func readManifestCSV(r io.Reader, fn func(item ManifestItem) error) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header := []string{"bucket", "key", "version_id"}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if line == 1 && hasColumns(record, "bucket", "key") {
+			header = make([]string, len(record))
+			for i, name := range record {
+				header[i] = strings.ToLower(strings.TrimSpace(name))
+			}
+			continue
+		}
+		fields := make(map[string]string, len(record))
+		for i, v := range record {
+			if i < len(header) {
+				fields[header[i]] = v
+			}
+		}
+		if err := fn(newManifestItem(line, fields)); err != nil {
+			return err
+		}
+	}
+}
+
+func readManifestJSONL(r io.Reader, fn func(item ManifestItem) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.UseNumber()
+		var values map[string]interface{}
+		if err := decoder.Decode(&values); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		fields := make(map[string]string, len(values))
+		for k, v := range values {
+			if v != nil {
+				fields[strings.ToLower(k)] = fmt.Sprint(v)
+			}
+		}
+		if err := fn(newManifestItem(line, fields)); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func hasColumns(record []string, names ...string) bool {
+	for _, name := range names {
+		found := false
+		for _, v := range record {
+			if strings.EqualFold(strings.TrimSpace(v), name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func newManifestItem(line int, fields map[string]string) ManifestItem {
+	item := ManifestItem{Line: line, Bucket: fields["bucket"], Key: fields["key"], VersionID: fields["version_id"], Fields: fields}
+	delete(fields, "bucket")
+	delete(fields, "key")
+	delete(fields, "version_id")
+	return item
+}
+
+// ManifestResult 结果清单中的一行
+type ManifestResult struct {
+	Line      int    `json:"line"`
+	Bucket    string `json:"bucket"`
+	Key       string `json:"key"`
+	VersionID string `json:"version_id,omitempty"`
+	Operation string `json:"operation"`
+	//succeeded,failed,dry_run时为planned
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// manifestCheckpoint 已处理的行,每行一个行号,追加写入
+type manifestCheckpoint struct {
+	lock sync.Mutex
+	file string
+	fd   *os.File
+	done map[int]bool
+}
+
+func openManifestCheckpoint(file string) (*manifestCheckpoint, error) {
+	cp := &manifestCheckpoint{file: file, done: make(map[int]bool)}
+	if file == "" {
+		return cp, nil
+	}
+	if fd, err := os.Open(file); err == nil {
+		scanner := bufio.NewScanner(fd)
+		for scanner.Scan() {
+			if line, err := strconv.Atoi(strings.TrimSpace(scanner.Text())); err == nil {
+				cp.done[line] = true
+			}
+		}
+		_ = fd.Close()
+	}
+	fd, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	cp.fd = fd
+	return cp, nil
+}
+
+func (cp *manifestCheckpoint) Done(line int) bool {
+	return cp.done[line]
+}
+
+func (cp *manifestCheckpoint) Add(line int) {
+	if cp.fd == nil {
+		return
+	}
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+	_, _ = fmt.Fprintf(cp.fd, "%d\n", line)
+}
+
+// Close 关闭断点文件,remove为true时全部处理完成,删除断点文件
+func (cp *manifestCheckpoint) Close(remove bool) {
+	if cp.fd == nil {
+		return
+	}
+	_ = cp.fd.Close()
+	if remove {
+		_ = os.Remove(cp.file)
+	}
+}
+
+// RunManifest 按清单对每个object执行操作,client为执行操作的客户端
+// options:
+//
+//	operation: copy,delete,tag,restore或metadata
+//	manifest_format: csv或jsonl,默认按扩展名判断,见ReadManifest
+//	dest_bucket/dest_prefix/dest_key: copy的目标bucket(默认同源bucket),key前缀和key
+//	tags: tag设置的标签,如k1=v1&k2=v2,替换已有的标签
+//	restore_days/restore_tier: restore取回后保留的天数(默认1)和取回方式
+//	metadata: metadata合并到已有自定义元数据的值,如k1=v1&k2=v2,也可以使用x-amz-meta-*参数,内容header和加密方式保持不变
+//	checkpoint: true时记录已处理的行,再次执行时跳过,checkpoint_file可指定路径,默认为清单文件.mcp
+//	result_file: 结果清单路径,默认为清单文件.result.jsonl,每行一个ManifestResult
+//
+// copy和metadata使用行中的version_id作为复制源的版本,行中的同名列优先于options,同时支持dry_run,continue_on_error和item_attempts
+func RunManifest(client storagebase.IClient, manifestFile string, options map[string]string, listener storagebase.ProgressListener, threadNum int, throttle *Throttle) (map[string]int, error) {
+	operation := options["operation"]
+	switch operation {
+	case "copy", "delete", "tag", "restore", "metadata":
+	default:
+		return nil, fmt.Errorf(" RunManifest Operation: %s Error: must be copy, delete, tag, restore or metadata", operation)
+	}
+	checkpoint, err := openManifestCheckpoint(CheckpointFile(options, manifestFile+".mcp"))
+	if err != nil {
+		return nil, fmt.Errorf(" RunManifest Open checkpoint Error: %v", err)
+	}
+	resultFile := options["result_file"]
+	if resultFile == "" {
+		resultFile = manifestFile + ".result.jsonl"
+	}
+	//从断点继续时追加结果
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if len(checkpoint.done) > 0 {
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	resultFd, err := os.OpenFile(resultFile, flag, 0644)
+	if resultFd != nil {
+		defer resultFd.Close()
+	}
+	if err != nil {
+		checkpoint.Close(false)
+		return nil, fmt.Errorf(" RunManifest Open resultFile: %s Error: %v", resultFile, err)
+	}
+	var resultLock sync.Mutex
+	resultEncoder := json.NewEncoder(resultFd)
+
+	var queueMaxSize = NewConcurrency(threadNum, throttle)
+	var total, tmpSkip, tmpFinish int64
+	var wg sync.WaitGroup
+	bulk := NewBulk("RunManifest", options)
+	dryRun := DryRun(options)
+	progress := NewProgress(listener, "RunManifest", manifestFile, 0, 0)
+	progress.SetEstimating(true)
+	readErr := ReadManifest(manifestFile, options["manifest_format"], func(item ManifestItem) error {
+		if bulk.Exit() {
+			return errManifestStopped
+		}
+		total++
+		progress.AddTotal(0, 1)
+		if checkpoint.Done(item.Line) {
+			atomic.AddInt64(&tmpSkip, 1)
+			progress.Action(item.Key, "skip", "checkpoint", 0, nil)
+			return nil
+		}
+		wg.Add(1)
+		queueMaxSize.Acquire()
+		go func(item ManifestItem) {
+			defer func() {
+				wg.Done()
+				queueMaxSize.Release()
+			}()
+			result := ManifestResult{Line: item.Line, Bucket: item.Bucket, Key: item.Key, VersionID: item.VersionID, Operation: operation, Status: "succeeded"}
+			var err error
+			if dryRun {
+				result.Status = "planned"
+			} else {
+				err = bulk.Do(item.Key, func() error {
+					return runManifestItem(client, operation, item, options)
+				})
+			}
+			if err != nil {
+				result.Status, result.Error = "failed", err.Error()
+			} else {
+				atomic.AddInt64(&tmpFinish, 1)
+				if !dryRun {
+					checkpoint.Add(item.Line)
+				}
+			}
+			resultLock.Lock()
+			_ = resultEncoder.Encode(&result)
+			resultLock.Unlock()
+			progress.Action(item.Key, operation, "manifest", 0, err)
+		}(item)
+		return nil
+	})
+	wg.Wait()
+	progress.SetEstimating(false)
+	if readErr != nil && readErr != errManifestStopped {
+		checkpoint.Close(false)
+		return nil, fmt.Errorf(" RunManifest Read manifest: %s Error: %v", manifestFile, readErr)
+	}
+	result, err := bulk.Result(map[string]int{
+		"Total":  int(total),
+		"Skip":   int(atomic.LoadInt64(&tmpSkip)),
+		"Finish": int(atomic.LoadInt64(&tmpFinish)),
+	})
+	checkpoint.Close(err == nil && readErr == nil && !dryRun)
+	return result, err
+}
+
+// runManifestItem 对清单中的一个object执行操作
+func runManifestItem(client storagebase.IClient, operation string, item ManifestItem, options map[string]string) error {
+	if item.Bucket == "" || item.Key == "" {
+		return fmt.Errorf(" RunManifest Line: %d Error: bucket and key are required", item.Line)
+	}
+	source := "/" + item.Bucket + "/" + item.Key
+	switch operation {
+	case "copy":
+		destBucket := item.field("dest_bucket", options)
+		if destBucket == "" {
+			destBucket = item.Bucket
+		}
+		destKey := item.Fields["dest_key"]
+		if destKey == "" {
+			destKey = item.field("dest_prefix", options) + item.Key
+		}
+		if destBucket == item.Bucket && destKey == item.Key {
+			return fmt.Errorf(" RunManifest Line: %d Error: copy to itself", item.Line)
+		}
+		_, err := client.CopyObject(destBucket, destKey, source, SSEOptions(map[string]string{
+			"acl":                 item.field("acl", options),
+			"multipart_threshold": options["multipart_threshold"],
+			"part_size":           options["part_size"],
+			"source_version_id":   item.VersionID,
+		}, options), nil)
+		return err
+	case "delete":
+		if item.VersionID == "" {
+			_, err := client.Delete(item.Bucket, item.Key)
+			return err
+		}
+		results, err := client.DeleteObjects(item.Bucket, []storagebase.ObjectIdentifier{{Key: item.Key, VersionID: item.VersionID}}, nil, nil)
+		if len(results) == 1 {
+			return results[0].Err
+		}
+		return err
+	case "tag":
+		tags, err := ParseTags(item.field("tags", options))
+		if err != nil {
+			return fmt.Errorf(" RunManifest Line: %d Tags Error: %v", item.Line, err)
+		}
+		_, err = client.PutObjectTagging(item.Bucket, item.Key, tags)
+		return err
+	case "restore":
+		days := 1
+		if v := item.field("restore_days", options); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return fmt.Errorf(" RunManifest Line: %d Error: invalid restore_days %q", item.Line, v)
+			}
+			days = n
+		}
+		_, err := client.RestoreObject(item.Bucket, item.Key, days, map[string]string{"restore_tier": item.field("restore_tier", options)})
+		return err
+	case "metadata":
+		//复制到自身并替换元数据,保留已有的内容header,自定义元数据和加密方式
+		opts := SSEOptions(map[string]string{
+			"acl":                 item.field("acl", options),
+			"multipart_threshold": options["multipart_threshold"],
+			"part_size":           options["part_size"],
+			"source_version_id":   item.VersionID,
+		}, options)
+		head, err := client.Head(item.Bucket, item.Key, SourceSSEOptions(opts))
+		if err != nil {
+			return err
+		}
+		for k, v := range MetaHeaders(options) {
+			opts[k] = v
+		}
+		if metadata := item.field("metadata", options); metadata != "" {
+			meta, err := ParseTags(metadata)
+			if err != nil {
+				return fmt.Errorf(" RunManifest Line: %d Metadata Error: %v", item.Line, err)
+			}
+			for k, v := range meta {
+				opts["x-amz-meta-"+strings.TrimPrefix(strings.ToLower(k), "x-amz-meta-")] = v
+			}
+		}
+		opts = HeadSSEOptions(SourceHeaderOptions(opts, head, nil), head)
+		opts["metadata_directive"] = "REPLACE"
+		_, err = client.CopyObject(item.Bucket, item.Key, source, opts, nil)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package storageutil_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shideqin/storage/aws/s3v2"
+	"github.com/shideqin/storage/storagebase"
+	"github.com/shideqin/storage/storagetest"
+)
+
+func writeManifest(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestFile := filepath.Join(dir, "manifest.csv")
+	if err := ioutil.WriteFile(manifestFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return manifestFile, func() { _ = os.RemoveAll(dir) }
+}
+
+func TestRunManifestMetadataKeepsHeaders(t *testing.T) {
+	server, v4 := newMirrorClient()
+	defer server.Close()
+	v2 := s3v2.New(storagetest.Host, "ak", "sk")
+	v2.SetRetryPolicy(nil)
+	manifestFile, cleanup := writeManifest(t, "bucket,key\nbucket,a.txt\n")
+	defer cleanup()
+
+	for name, client := range map[string]storagebase.IClient{"s3v4": v4, "s3v2": v2} {
+		server.PutObject("bucket", "a.txt", []byte("body"), http.Header{
+			"Content-Type":                 {"text/plain"},
+			"Content-Encoding":             {"gzip"},
+			"Cache-Control":                {"max-age=60"},
+			"Content-Disposition":          {`attachment; filename="a.txt"`},
+			"X-Amz-Server-Side-Encryption": {"AES256"},
+			"X-Amz-Meta-Old":               {"1"},
+		})
+		server.SetDefaultSSE("bucket", "aws:kms")
+		options := map[string]string{"operation": "metadata", "metadata": "new=2"}
+		if _, err := client.RunManifest(manifestFile, options, nil); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		server.SetDefaultSSE("bucket", "")
+		header := server.Object("bucket", "a.txt").Header
+		for k, want := range map[string]string{
+			"Content-Type":                 "text/plain",
+			"Content-Encoding":             "gzip",
+			"Cache-Control":                "max-age=60",
+			"Content-Disposition":          `attachment; filename="a.txt"`,
+			"X-Amz-Server-Side-Encryption": "AES256",
+			"X-Amz-Meta-Old":               "1",
+			"X-Amz-Meta-New":               "2",
+		} {
+			if got := header.Get(k); got != want {
+				t.Errorf("%s: %s = %q, want %q", name, k, got, want)
+			}
+		}
+	}
+}
+
+func TestRunManifestCopyVersion(t *testing.T) {
+	server, client := newMirrorClient()
+	defer server.Close()
+	server.PutObject("bucket", "a.txt", []byte("body"), nil)
+	manifestFile, cleanup := writeManifest(t, "bucket,key,version_id\nbucket,a.txt,v1\n")
+	defer cleanup()
+
+	options := map[string]string{"operation": "copy", "dest_prefix": "copy/"}
+	if _, err := client.RunManifest(manifestFile, options, nil); err != nil {
+		t.Fatal(err)
+	}
+	sources := server.CopySources()
+	if len(sources) != 1 || sources[0] != "/bucket/a.txt?versionId=v1" {
+		t.Errorf("copy sources = %v, want [/bucket/a.txt?versionId=v1]", sources)
+	}
+}
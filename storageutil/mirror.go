@@ -0,0 +1,315 @@
+package storageutil
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shideqin/storage/storagebase"
+)
+
+// SyncDir 本地目录和bucket/prefix镜像同步,client为执行上传下载的客户端,headState为比较用的object信息,nil时使用HeadState
+// options:
+//
+//	direction: upload(默认)本地同步到bucket,download bucket同步到本地,both双向同步
+//	delete: true时删除目标中源不存在的文件,direction为both时不删除,被过滤的文件不删除,本地有无法读取的文件或目录时不删除
+//	compare/compare_meta/compare_meta_algorithm: 比较方式,见Comparer
+//	conflict: direction为both且两边都存在且不同时的处理,newer(默认)修改时间新的覆盖旧的,local,remote,skip
+//
+// direction为both时两边互相比较都相同才跳过,默认按checksum比较,无法获取md5时大小和修改时间都相同才跳过
+// 本地目录不存在时返回错误,direction为download时除外,无法读取的文件和目录记录为失败并跳过
+// 同时支持dry_run,continue_on_error,item_attempts和include/exclude等过滤参数
+func SyncDir(client storagebase.IClient, localDir, bucket, prefix string, options map[string]string, listener storagebase.ProgressListener, threadNum int, throttle *Throttle, headState func(head map[string]interface{}) *FileState) (map[string]int, error) {
+	direction := options["direction"]
+	if direction == "" {
+		direction = "upload"
+	}
+	if direction != "upload" && direction != "download" && direction != "both" {
+		return nil, fmt.Errorf(" SyncDir Direction: %s Error: must be upload, download or both", direction)
+	}
+	conflict := options["conflict"]
+	if conflict == "" {
+		conflict = "newer"
+	}
+	if conflict != "newer" && conflict != "local" && conflict != "remote" && conflict != "skip" {
+		return nil, fmt.Errorf(" SyncDir Conflict: %s Error: must be newer, local, remote or skip", conflict)
+	}
+	filter, filterErr := NewFilter(options)
+	if filterErr != nil {
+		return nil, fmt.Errorf(" SyncDir Filter Error: %v", filterErr)
+	}
+	compareOptions := options
+	if direction == "both" && options["compare"] == "" {
+		compareOptions = map[string]string{"compare": "checksum", "replace": options["replace"]}
+	}
+	comparer, compareErr := NewComparer(compareOptions)
+	if compareErr != nil {
+		return nil, fmt.Errorf(" SyncDir Compare Error: %v", compareErr)
+	}
+	if prefix != "" {
+		prefix = strings.TrimSuffix(prefix, "/") + "/"
+	}
+	localDir = strings.TrimSuffix(localDir, "/") + "/"
+	isDelete := options["delete"] == "true" && direction != "both"
+	if headState == nil {
+		headState = func(head map[string]interface{}) *FileState {
+			return HeadState(head, true)
+		}
+	}
+
+	//本地目录不存在时不能当作空目录,否则会删除全部远程文件
+	bulk := NewBulk("SyncDir", options)
+	var walkEntries <-chan WalkEntry
+	stop := make(chan struct{})
+	defer close(stop)
+	if rootInfo, err := os.Stat(localDir); err != nil || !rootInfo.IsDir() {
+		if err == nil {
+			return nil, fmt.Errorf(" SyncDir localDir: %s Error: not a directory", localDir)
+		}
+		if !os.IsNotExist(err) || direction != "download" {
+			return nil, fmt.Errorf(" SyncDir localDir: %s Error: %v", localDir, err)
+		}
+		emptyDir := make(chan WalkEntry)
+		close(emptyDir)
+		walkEntries = emptyDir
+	} else {
+		//本地文件不完整时不删除,删除前先检查整个目录
+		if isDelete {
+			_ = Walk(localDir, nil, func(entry WalkEntry) error {
+				if entry.Err != nil {
+					isDelete = false
+					return errWalkStopped
+				}
+				return nil
+			})
+		}
+		walkEntries = WalkStream(localDir, nil, stop)
+	}
+	//无法读取的文件和目录,不同步也不删除
+	var unreadable []string
+	nextLocal := func() *WalkEntry {
+		for entry := range walkEntries {
+			if entry.Err != nil {
+				unreadable = append(unreadable, entry.Name)
+				bulk.Fail(entry.Name, fmt.Errorf(" SyncDir Read localFile: %s%s Error: %v", localDir, entry.Name, entry.Err))
+				continue
+			}
+			if entry.Skip == "" {
+				return &entry
+			}
+		}
+		return nil
+	}
+	isUnreadable := func(name string) bool {
+		for _, dir := range unreadable {
+			if name == dir || (dir == "" || strings.HasSuffix(dir, "/")) && strings.HasPrefix(name, dir) {
+				return true
+			}
+		}
+		return false
+	}
+	//远程文件,跳过空目录标记object
+	remoteLister := &objectLister{client: client, bucket: bucket, prefix: prefix}
+	nextRemote := func() (*storagebase.ListObjectContents, error) {
+		for {
+			object, err := remoteLister.next()
+			if object == nil || err != nil || !strings.HasSuffix(object.Key, "/") {
+				return object, err
+			}
+		}
+	}
+
+	var queueMaxSize = NewConcurrency(threadNum, throttle)
+	var total int
+	var tmpUpload, tmpDownload, tmpDelete, tmpSkip, tmpConflict, tmpSize int64
+	var wg sync.WaitGroup
+	dryRun := DryRun(options)
+	progress := NewProgress(listener, "SyncDir", prefix, 0, 0)
+	progress.SetEstimating(true)
+	//本地遍历和远程列表都按key顺序,边遍历边合并,不需要全部加载到内存
+	//列表出错时停止同步,等待已开始的文件完成后返回
+	local := nextLocal()
+	remote, listErr := nextRemote()
+	for listErr == nil && (local != nil || remote != nil) && !bulk.Exit() {
+		var name string
+		var localStat os.FileInfo
+		var remoteInfo *storagebase.ListObjectContents
+		switch {
+		case remote == nil || (local != nil && local.Name < strings.TrimPrefix(remote.Key, prefix)):
+			name, localStat = local.Name, local.Info
+			local = nextLocal()
+		case local == nil || local.Name > strings.TrimPrefix(remote.Key, prefix):
+			name, remoteInfo = strings.TrimPrefix(remote.Key, prefix), remote
+			remote, listErr = nextRemote()
+		default:
+			name, localStat, remoteInfo = local.Name, local.Info, remote
+			local = nextLocal()
+			remote, listErr = nextRemote()
+		}
+		total++
+		progress.AddTotal(0, 1)
+		wg.Add(1)
+		queueMaxSize.Acquire()
+		go func(name string, localStat os.FileInfo, remoteInfo *storagebase.ListObjectContents, unreadable bool) {
+			defer func() {
+				wg.Done()
+				queueMaxSize.Release()
+			}()
+			localFile := localDir + name
+			object := prefix + name
+			hasLocal, hasRemote := localStat != nil, remoteInfo != nil
+			var action, reason string
+			var itemSize int64
+			err := bulk.Do(name, func() error {
+				//被过滤的文件不同步也不删除
+				var matched bool
+				if hasLocal {
+					matched, reason = filter.MatchFile(name, localStat)
+				} else {
+					matched, reason = filter.MatchObject(prefix, *remoteInfo)
+				}
+				if !matched {
+					action = "skip"
+					atomic.AddInt64(&tmpSkip, 1)
+					return nil
+				}
+				action, reason = "skip", "extraneous"
+				if unreadable {
+					reason = "unreadable"
+					atomic.AddInt64(&tmpSkip, 1)
+					return nil
+				}
+				switch {
+				case hasLocal && !hasRemote:
+					itemSize = localStat.Size()
+					if direction != "download" {
+						action, reason = "upload", "not_found"
+					} else if isDelete {
+						action = "delete_local"
+					}
+				case !hasLocal && hasRemote:
+					itemSize = int64(remoteInfo.Size)
+					if direction != "upload" {
+						action, reason = "download", "not_found"
+					} else if isDelete {
+						action = "delete_remote"
+					}
+				default:
+					itemSize = localStat.Size()
+					objectHead, headErr := client.Head(bucket, object, options)
+					if headErr != nil {
+						return headErr
+					}
+					localState, remoteState := LocalState(localFile, localStat), headState(objectHead)
+					var skip bool
+					switch direction {
+					case "upload":
+						action = "upload"
+						skip, reason = comparer.Skip(localState, remoteState)
+					case "download":
+						action = "download"
+						skip, reason = comparer.Skip(remoteState, localState)
+					default:
+						if skip, reason = comparer.Skip(localState, remoteState); skip {
+							skip, reason = comparer.Skip(remoteState, localState)
+						}
+						if !skip {
+							action, reason = resolveConflict(conflict, localState.ModTime, remoteState.ModTime)
+						}
+					}
+					if skip {
+						action = "skip"
+					}
+				}
+				if action == "skip" {
+					if reason == "conflict" {
+						atomic.AddInt64(&tmpConflict, 1)
+					}
+					atomic.AddInt64(&tmpSkip, 1)
+					return nil
+				}
+				if !dryRun {
+					var actionErr error
+					switch action {
+					case "upload":
+						//分块上传的参数按文件区分,不共用断点文件
+						uploadOptions := make(map[string]string, len(options)+1)
+						for k, v := range options {
+							uploadOptions[k] = v
+						}
+						uploadOptions["disposition"] = name
+						delete(uploadOptions, "checkpoint_file")
+						progress.AddTotal(itemSize, 0)
+						_, actionErr = client.Upload(localFile, bucket, object, uploadOptions, progress.Child())
+					case "download":
+						progress.AddTotal(itemSize, 0)
+						_, actionErr = client.Get(bucket, object, localFile, SSEOptions(map[string]string{
+							"thread_num":     options["thread_num"],
+							"part_size":      options["part_size"],
+							"decompress":     options["decompress"],
+							"verify":         options["verify"],
+							"preserve_attrs": options["preserve_attrs"],
+							"preserve_owner": options["preserve_owner"],
+							"symlinks":       options["symlinks"],
+							"local_dir":      localDir,
+						}, options), progress.Child())
+					case "delete_local":
+						actionErr = os.Remove(localFile)
+					case "delete_remote":
+						_, actionErr = client.Delete(bucket, object)
+					}
+					if actionErr != nil {
+						return actionErr
+					}
+				}
+				switch action {
+				case "upload":
+					atomic.AddInt64(&tmpUpload, 1)
+					atomic.AddInt64(&tmpSize, itemSize)
+				case "download":
+					atomic.AddInt64(&tmpDownload, 1)
+					atomic.AddInt64(&tmpSize, itemSize)
+				default:
+					atomic.AddInt64(&tmpDelete, 1)
+				}
+				return nil
+			})
+			progress.Action(name, action, reason, itemSize, err)
+		}(name, localStat, remoteInfo, isUnreadable(name))
+	}
+	wg.Wait()
+	progress.SetEstimating(false)
+	if listErr != nil {
+		return nil, listErr
+	}
+	return bulk.Result(map[string]int{
+		"Total":    total,
+		"Upload":   int(atomic.LoadInt64(&tmpUpload)),
+		"Download": int(atomic.LoadInt64(&tmpDownload)),
+		"Delete":   int(atomic.LoadInt64(&tmpDelete)),
+		"Skip":     int(atomic.LoadInt64(&tmpSkip)),
+		"Conflict": int(atomic.LoadInt64(&tmpConflict)),
+		"Size":     int(atomic.LoadInt64(&tmpSize)),
+	})
+}
+
+// resolveConflict 双向同步时两边都修改过的处理方式
+func resolveConflict(conflict string, localTime, remoteTime time.Time) (string, string) {
+	switch conflict {
+	case "local":
+		return "upload", "conflict_local"
+	case "remote":
+		return "download", "conflict_remote"
+	case "newer":
+		if localTime.After(remoteTime) {
+			return "upload", "local_newer"
+		}
+		if remoteTime.After(localTime) {
+			return "download", "remote_newer"
+		}
+	}
+	return "skip", "conflict"
+}
@@ -0,0 +1,28 @@
+package storageutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveConflict(t *testing.T) {
+	now := time.Unix(1600000000, 500000000)
+	tests := []struct {
+		conflict   string
+		local      time.Time
+		remote     time.Time
+		wantAction string
+	}{
+		{"newer", now.Add(100 * time.Millisecond), now, "upload"},
+		{"newer", now, now.Add(100 * time.Millisecond), "download"},
+		{"newer", now, now, "skip"},
+		{"local", now, now.Add(time.Hour), "upload"},
+		{"remote", now.Add(time.Hour), now, "download"},
+		{"skip", now.Add(time.Hour), now, "skip"},
+	}
+	for _, tt := range tests {
+		if action, _ := resolveConflict(tt.conflict, tt.local, tt.remote); action != tt.wantAction {
+			t.Errorf("resolveConflict(%s, %v, %v) = %s, want %s", tt.conflict, tt.local, tt.remote, action, tt.wantAction)
+		}
+	}
+}
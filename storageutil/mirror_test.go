@@ -0,0 +1,148 @@
+package storageutil_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shideqin/storage/aws/s3v4"
+	"github.com/shideqin/storage/storagetest"
+)
+
+func newMirrorClient() (*storagetest.Server, *s3v4.Client) {
+	server := storagetest.NewServer()
+	client := s3v4.New(storagetest.Host, "ak", "sk")
+	client.SetRetryPolicy(nil)
+	return server, client
+}
+
+func TestSyncDirMissingLocalDir(t *testing.T) {
+	server, client := newMirrorClient()
+	defer server.Close()
+	server.PutObject("bucket", "backup/a.txt", []byte("a"), nil)
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	missing := filepath.Join(dir, "missing")
+	if _, err := client.SyncDir(missing, "bucket", "backup", map[string]string{"delete": "true"}, nil); err == nil {
+		t.Error("upload from missing localDir: expected error")
+	}
+	if server.Object("bucket", "backup/a.txt") == nil {
+		t.Fatal("upload from missing localDir deleted remote object")
+	}
+	//download时本地目录不存在为正常情况
+	if _, err := client.SyncDir(missing, "bucket", "backup", map[string]string{"direction": "download"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := ioutil.ReadFile(filepath.Join(missing, "a.txt")); string(body) != "a" {
+		t.Errorf("downloaded body = %q, want %q", body, "a")
+	}
+}
+
+func TestSyncDirBothSameSize(t *testing.T) {
+	server, client := newMirrorClient()
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localFile := filepath.Join(dir, "a.txt")
+	if err := ioutil.WriteFile(localFile, []byte("version1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	options := map[string]string{"direction": "both"}
+	if _, err := client.SyncDir(dir, "bucket", "backup", options, nil); err != nil {
+		t.Fatal(err)
+	}
+	result, err := client.SyncDir(dir, "bucket", "backup", options, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result["Skip"] != 1 {
+		t.Errorf("unchanged sync result = %v, want 1 skip", result)
+	}
+
+	//大小不变的修改也要同步
+	if err := ioutil.WriteFile(localFile, []byte("version2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(localFile, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if result, err = client.SyncDir(dir, "bucket", "backup", options, nil); err != nil {
+		t.Fatal(err)
+	}
+	if result["Upload"] != 1 {
+		t.Errorf("same size sync result = %v, want 1 upload", result)
+	}
+	if object := server.Object("bucket", "backup/a.txt"); object == nil || !bytes.Equal(object.Body, []byte("version2")) {
+		t.Error("same size change not uploaded")
+	}
+}
+
+func TestSyncDirKeyOrder(t *testing.T) {
+	server, client := newMirrorClient()
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	//本地遍历顺序和远程列表顺序不一致时a-b会被当作只在远程存在而删除
+	for _, name := range []string{"a/c", "a-b"} {
+		localFile := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(localFile), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(localFile, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server.PutObject("bucket", "backup/a.txt", []byte("extra"), nil)
+	options := map[string]string{"delete": "true"}
+	result, err := client.SyncDir(dir, "bucket", "backup", options, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result["Total"] != 3 || result["Upload"] != 2 || result["Delete"] != 1 {
+		t.Errorf("first sync result = %v, want 2 uploads and 1 delete", result)
+	}
+	if result, err = client.SyncDir(dir, "bucket", "backup", options, nil); err != nil {
+		t.Fatal(err)
+	}
+	if result["Skip"] != 2 || result["Delete"] != 0 {
+		t.Errorf("second sync result = %v, want 2 skips", result)
+	}
+	if keys := server.Keys("bucket"); strings.Join(keys, ",") != "backup/a-b,backup/a/c" {
+		t.Errorf("remote keys = %v", keys)
+	}
+}
+
+func TestCopyAllObjectSuffix(t *testing.T) {
+	server, client := newMirrorClient()
+	defer server.Close()
+	for _, key := range []string{"src/a.jpg", "src/b.PNG", "src/c.txt"} {
+		server.PutObject("bucket", key, []byte(key), nil)
+	}
+	//suffix在复制,移动和上传中都表示只处理匹配的文件
+	options := map[string]string{"suffix": ".jpg,.png"}
+	if _, err := client.CopyAllObject("bucket", "copy", "/bucket/src", options, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.MoveAllObject("bucket", "move", "/bucket/copy", options, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"move/a.jpg", "move/b.PNG", "src/a.jpg", "src/b.PNG", "src/c.txt"}
+	if got := server.Keys("bucket"); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("keys = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,88 @@
+package storageutil
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+const (
+	// MinPartSize 分块最小5MB(最后一块除外)
+	MinPartSize = 5 * 1024 * 1024
+	// MaxPartSize 分块最大5GB
+	MaxPartSize = 5 * 1024 * 1024 * 1024
+	// MaxPartNum 分块数量最多10000
+	MaxPartNum = 10000
+	// MaxObjectSize object最大5TB
+	MaxObjectSize = 5 * 1024 * 1024 * 1024 * 1024
+)
+
+// PartLayout 根据object大小计算分块大小和分块数量
+// options["part_size"]为期望的分块大小,超出5MB~5GB时使用defaultPartSize,分块数超过10000时自动增大分块
+func PartLayout(objectSize int, options map[string]string, defaultPartSize int) (int, int, error) {
+	if objectSize < 0 || int64(objectSize) > MaxObjectSize {
+		return 0, 0, fmt.Errorf("object size %d out of range 0-%d", objectSize, int64(MaxObjectSize))
+	}
+	partSize := defaultPartSize
+	if options["part_size"] != "" {
+		n, err := strconv.Atoi(options["part_size"])
+		if err == nil && int64(n) <= MaxPartSize && n >= MinPartSize {
+			partSize = n
+		}
+	}
+	if objectSize == 0 {
+		return partSize, 0, nil
+	}
+	if (objectSize+partSize-1)/partSize > MaxPartNum {
+		//按MB向上取整
+		partSize = (objectSize + MaxPartNum - 1) / MaxPartNum
+		partSize = (partSize + 1024*1024 - 1) / (1024 * 1024) * (1024 * 1024)
+	}
+	return partSize, (objectSize + partSize - 1) / partSize, nil
+}
+
+// MultipartThreshold 超过阈值时使用分块上传/复制,options["multipart_threshold"]可指定,最大5GB
+func MultipartThreshold(options map[string]string, defaultThreshold int) int64 {
+	threshold := int64(defaultThreshold)
+	if n, err := strconv.ParseInt(options["multipart_threshold"], 10, 64); err == nil && n > 0 {
+		threshold = n
+	}
+	if threshold > MaxPartSize {
+		threshold = MaxPartSize
+	}
+	return threshold
+}
+
+// PartLength 第partNum(从0开始)个分块的字节数
+func PartLength(objectSize, partSize, partNum int) int {
+	length := objectSize - partNum*partSize
+	if length > partSize {
+		length = partSize
+	}
+	if length < 0 {
+		length = 0
+	}
+	return length
+}
+
+// PartError 并发分块共用的错误,记录第一个失败分块的错误,出错后停止提交新的分块
+type PartError struct {
+	lock sync.Mutex
+	err  error
+}
+
+// Set 记录分块错误,已有错误时忽略
+func (p *PartError) Set(err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// Err 返回记录的错误
+func (p *PartError) Err() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.err
+}
@@ -0,0 +1,226 @@
+package storageutil_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/shideqin/storage/storageutil"
+)
+
+func TestPartLayout(t *testing.T) {
+	const mb = 1024 * 1024
+	tests := []struct {
+		name       string
+		objectSize int64
+		partSize   string
+		wantSize   int
+		wantNum    int
+		wantErr    bool
+	}{
+		{"empty", 0, "", 8 * mb, 0, false},
+		{"one byte", 1, "", 8 * mb, 1, false},
+		{"exact parts", 16 * mb, "", 8 * mb, 2, false},
+		{"last part smaller", 16*mb + 1, "", 8 * mb, 3, false},
+		{"part_size", 20 * mb, "5242880", 5 * mb, 4, false},
+		{"part_size too small", 20 * mb, "1048576", 8 * mb, 3, false},
+		{"part_size too large", 20 * mb, "6442450944", 8 * mb, 3, false},
+		{"part_size invalid", 20 * mb, "abc", 8 * mb, 3, false},
+		{"max parts", 10000 * 8 * mb, "", 8 * mb, 10000, false},
+		{"grow part size", 10000*8*mb + 1, "", 9 * mb, 8889, false},
+		{"max object", storageutil.MaxObjectSize, "", 525 * mb, 9987, false},
+		{"too large", storageutil.MaxObjectSize + 1, "", 0, 0, true},
+		{"negative", -1, "", 0, 0, true},
+	}
+	for _, tt := range tests {
+		//32位平台int放不下的大小跳过
+		if int64(int(tt.objectSize)) != tt.objectSize {
+			continue
+		}
+		partSize, partNum, err := storageutil.PartLayout(int(tt.objectSize), map[string]string{"part_size": tt.partSize}, 8*mb)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if partSize != tt.wantSize || partNum != tt.wantNum {
+			t.Errorf("%s: PartLayout = %d, %d, want %d, %d", tt.name, partSize, partNum, tt.wantSize, tt.wantNum)
+		}
+		if partNum > storageutil.MaxPartNum || (partNum > 0 && int64(partNum-1)*int64(partSize) >= tt.objectSize) || int64(partNum)*int64(partSize) < tt.objectSize {
+			t.Errorf("%s: %d parts of %d do not cover %d bytes", tt.name, partNum, partSize, tt.objectSize)
+		}
+	}
+}
+
+func TestPartLength(t *testing.T) {
+	tests := []struct {
+		objectSize, partSize, partNum, want int
+	}{
+		{10, 4, 0, 4},
+		{10, 4, 2, 2},
+		{10, 4, 3, 0},
+		{8, 4, 1, 4},
+	}
+	for _, tt := range tests {
+		if got := storageutil.PartLength(tt.objectSize, tt.partSize, tt.partNum); got != tt.want {
+			t.Errorf("PartLength(%d, %d, %d) = %d, want %d", tt.objectSize, tt.partSize, tt.partNum, got, tt.want)
+		}
+	}
+}
+
+func TestMultipartThreshold(t *testing.T) {
+	tests := []struct {
+		threshold string
+		want      int64
+	}{
+		{"", 100},
+		{"2048", 2048},
+		{"-1", 100},
+		{"abc", 100},
+		{"6442450944", storageutil.MaxPartSize},
+	}
+	for _, tt := range tests {
+		if got := storageutil.MultipartThreshold(map[string]string{"multipart_threshold": tt.threshold}, 100); got != tt.want {
+			t.Errorf("MultipartThreshold(%q) = %d, want %d", tt.threshold, got, tt.want)
+		}
+	}
+}
+
+func TestMultipartSelection(t *testing.T) {
+	server, client := newMirrorClient()
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localFile := filepath.Join(dir, "a.txt")
+	if err := ioutil.WriteFile(localFile, []byte("01234567"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server.PutObject("bucket", "src.txt", []byte("01234567"), nil)
+	rec := recordRequests(server)
+	isMultipart := func() bool {
+		uploads := rec.find(http.MethodPost, func(r *http.Request) bool {
+			_, ok := r.URL.Query()["uploads"]
+			return ok
+		})
+		rec.reset()
+		return len(uploads) > 0
+	}
+	//大小等于阈值时使用分块
+	tests := []struct {
+		threshold string
+		multipart bool
+	}{
+		{"", false},
+		{"9", false},
+		{"8", true},
+		{"4", true},
+	}
+	for _, tt := range tests {
+		options := map[string]string{"multipart_threshold": tt.threshold}
+		if _, err := client.Upload(localFile, "bucket", "upload.txt", options, nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := isMultipart(); got != tt.multipart {
+			t.Errorf("Upload threshold %q: multipart = %v, want %v", tt.threshold, got, tt.multipart)
+		}
+		if _, err := client.CopyObject("bucket", "copy.txt", "/bucket/src.txt", options, nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := isMultipart(); got != tt.multipart {
+			t.Errorf("CopyObject threshold %q: multipart = %v, want %v", tt.threshold, got, tt.multipart)
+		}
+		for _, key := range []string{"upload.txt", "copy.txt"} {
+			if object := server.Object("bucket", key); object == nil || string(object.Body) != "01234567" {
+				t.Errorf("threshold %q: %s not written", tt.threshold, key)
+			}
+		}
+	}
+}
+
+func TestReconcilePages(t *testing.T) {
+	server, client := newMirrorClient()
+	defer server.Close()
+	const partNum = 1001
+	initUpload, err := client.InitUpload("bucket", "a.bin", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= partNum; i++ {
+		if _, err := client.UploadPart(strings.NewReader("a"), 1, "bucket", "a.bin", i, initUpload.UploadID, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//超过1000个分块时按part-number-marker继续获取
+	rec := recordRequests(server)
+	checkpoint := &storageutil.Checkpoint{Bucket: "bucket", Object: "a.bin", Size: partNum, PartSize: 1, UploadID: initUpload.UploadID}
+	if err := checkpoint.Reconcile(client); err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpoint.Parts) != partNum {
+		t.Errorf("Reconcile kept %d parts, want %d", len(checkpoint.Parts), partNum)
+	}
+	lists := rec.find(http.MethodGet, nil)
+	if len(lists) != 2 || lists[1].URL.Query().Get("part-number-marker") != "1000" {
+		t.Errorf("Reconcile listed %d pages, want 2 with part-number-marker 1000", len(lists))
+	}
+}
+
+func TestListPartPages(t *testing.T) {
+	server, client := newMirrorClient()
+	defer server.Close()
+	//同一个key有多个上传时按upload-id-marker翻页
+	var uploadIDs []string
+	for _, key := range []string{"a.bin", "a.bin", "a.bin", "b.bin"} {
+		initUpload, err := client.InitUpload("bucket", key, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		uploadIDs = append(uploadIDs, key+"/"+initUpload.UploadID)
+	}
+	sort.Strings(uploadIDs)
+	var listed []string
+	options := map[string]string{"max-keys": "2"}
+	for page := 0; ; page++ {
+		list, err := client.ListPart("bucket", options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, upload := range list.Upload {
+			listed = append(listed, upload.Key+"/"+upload.UploadID)
+		}
+		if list.IsTruncated != "true" || page > len(uploadIDs) {
+			break
+		}
+		options["key-marker"], options["upload-id-marker"] = list.NextKeyMarker, list.NextUploadIDMarker
+	}
+	if strings.Join(listed, ",") != strings.Join(uploadIDs, ",") {
+		t.Errorf("ListPart pages = %v, want %v", listed, uploadIDs)
+	}
+
+	//DeleteAllPart按分页取消所有上传
+	for i := 0; i < 1000; i++ {
+		if _, err := client.InitUpload("bucket", fmt.Sprintf("c/%04d", i), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	result, err := client.DeleteAllPart("bucket", "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result["Total"] != 1004 || result["Finish"] != 1004 {
+		t.Errorf("DeleteAllPart = %v, want Total and Finish 1004", result)
+	}
+	if list, err := client.ListPart("bucket", nil); err != nil || len(list.Upload) != 0 {
+		t.Errorf("uploads left after DeleteAllPart: %v", err)
+	}
+}
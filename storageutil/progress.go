@@ -0,0 +1,167 @@
+package storageutil
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/shideqin/storage/storagebase"
+)
+
+// Progress 进度统计,listener为nil时所有方法都不做处理
+type Progress struct {
+	lock       sync.Mutex
+	listener   storagebase.ProgressListener
+	operation  string
+	key        string
+	start      time.Time
+	bytes      int64
+	totalBytes int64
+	items      int
+	totalItems int
+	children   map[string]int64
+	estimating bool
+}
+
+// NewProgress 实例化
+func NewProgress(listener storagebase.ProgressListener, operation, key string, totalBytes int64, totalItems int) *Progress {
+	return &Progress{
+		listener:   listener,
+		operation:  operation,
+		key:        key,
+		start:      time.Now(),
+		totalBytes: totalBytes,
+		totalItems: totalItems,
+		children:   make(map[string]int64),
+	}
+}
+
+// AddTotal 增加总字节数和总数,用于分页列表
+func (p *Progress) AddTotal(bytes int64, items int) {
+	if p == nil || p.listener == nil {
+		return
+	}
+	p.lock.Lock()
+	p.totalBytes += bytes
+	p.totalItems += items
+	p.lock.Unlock()
+}
+
+// SetEstimating 设置总数是否仍在统计,统计完成时通知最终的总数
+func (p *Progress) SetEstimating(estimating bool) {
+	if p == nil || p.listener == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.estimating = estimating
+	if !estimating {
+		p.emit(&storagebase.ProgressEvent{Key: p.key})
+	}
+}
+
+// Transferred 传输了n个字节
+func (p *Progress) Transferred(key string, n int64) {
+	if p == nil || p.listener == nil || n == 0 {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.bytes += n
+	p.emit(&storagebase.ProgressEvent{Key: key})
+}
+
+// Done 完成一个分块或文件,err不为nil时为失败
+func (p *Progress) Done(key string, err error) {
+	p.DoneItems(key, 1, err)
+}
+
+// DoneItems 完成n个分块或文件
+func (p *Progress) DoneItems(key string, n int, err error) {
+	if p == nil || p.listener == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.children, key)
+	p.items += n
+	p.emit(&storagebase.ProgressEvent{Key: key, Err: err})
+}
+
+// Action 批量操作完成一个文件,action为处理方式,reason为原因,dry_run时为计划的处理方式
+func (p *Progress) Action(key, action, reason string, size int64, err error) {
+	if p == nil || p.listener == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.children, key)
+	p.items++
+	p.emit(&storagebase.ProgressEvent{Key: key, Err: err, Action: action, Reason: reason, Size: size})
+}
+
+// Child 子操作的进度监听,子操作传输的字节数汇总到当前进度
+func (p *Progress) Child() storagebase.ProgressListener {
+	if p == nil || p.listener == nil {
+		return nil
+	}
+	return storagebase.ProgressFunc(func(event *storagebase.ProgressEvent) {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		delta := event.TransferredBytes - p.children[event.Key]
+		if delta <= 0 {
+			return
+		}
+		p.children[event.Key] = event.TransferredBytes
+		p.bytes += delta
+		p.emit(&storagebase.ProgressEvent{Key: event.Key})
+	})
+}
+
+// Reader 统计请求实际发送的字节数
+func (p *Progress) Reader(key string, r io.ReadSeeker) io.ReadSeeker {
+	if p == nil || p.listener == nil {
+		return r
+	}
+	return &ProgressReader{ReadSeeker: r, progress: p, key: key}
+}
+
+func (p *Progress) emit(event *storagebase.ProgressEvent) {
+	if elapsed := time.Since(p.start).Seconds(); elapsed > 0 {
+		event.Throughput = float64(p.bytes) / elapsed
+	}
+	event.Operation = p.operation
+	event.TransferredBytes = p.bytes
+	event.TotalBytes = p.totalBytes
+	event.DoneItems = p.items
+	event.TotalItems = p.totalItems
+	event.Estimating = p.estimating
+	p.listener.ProgressChanged(event)
+}
+
+// ProgressReader 上传的body,只统计发送请求时读取的字节,计算md5等读取不计入,重试时不重复计入
+type ProgressReader struct {
+	io.ReadSeeker
+	progress *Progress
+	key      string
+	sent     int64
+}
+
+func (pr *ProgressReader) sendReader() io.Reader {
+	return &progressSendReader{pr: pr}
+}
+
+type progressSendReader struct {
+	pr  *ProgressReader
+	pos int64
+}
+
+func (s *progressSendReader) Read(b []byte) (int, error) {
+	n, err := s.pr.ReadSeeker.Read(b)
+	s.pos += int64(n)
+	if s.pos > s.pr.sent {
+		s.pr.progress.Transferred(s.pr.key, s.pos-s.pr.sent)
+		s.pr.sent = s.pos
+	}
+	return n, err
+}
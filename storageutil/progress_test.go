@@ -0,0 +1,126 @@
+package storageutil_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shideqin/storage/storagebase"
+)
+
+// progressRecorder 记录收到的进度事件
+type progressRecorder struct {
+	lock   sync.Mutex
+	events []storagebase.ProgressEvent
+}
+
+func (r *progressRecorder) ProgressChanged(event *storagebase.ProgressEvent) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, *event)
+}
+
+// check 已传输字节数和完成数不减少,返回最后一个事件
+func (r *progressRecorder) check(t *testing.T, name string) storagebase.ProgressEvent {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.events) == 0 {
+		t.Fatalf("%s: no progress events", name)
+	}
+	for i := 1; i < len(r.events); i++ {
+		if r.events[i].TransferredBytes < r.events[i-1].TransferredBytes || r.events[i].DoneItems < r.events[i-1].DoneItems {
+			t.Errorf("%s: progress went backwards at event %d: %+v after %+v", name, i, r.events[i], r.events[i-1])
+		}
+	}
+	return r.events[len(r.events)-1]
+}
+
+func TestProgressEvents(t *testing.T) {
+	server, client := newMirrorClient()
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data := bytes.Repeat([]byte("0123456789"), 300*1024)
+	localFile := filepath.Join(dir, "a.bin")
+	if err := ioutil.WriteFile(localFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	size := int64(len(data))
+
+	//上传一个文件
+	listener := &progressRecorder{}
+	if _, err := client.Upload(localFile, "bucket", "a.bin", nil, listener); err != nil {
+		t.Fatal(err)
+	}
+	last := listener.check(t, "Upload")
+	if last.TransferredBytes != size || last.TotalBytes != size || last.DoneItems != last.TotalItems || last.Err != nil {
+		t.Errorf("Upload: last event %+v", last)
+	}
+
+	//分片下载,每个分片完成一次
+	listener = &progressRecorder{}
+	options := map[string]string{"part_size": strconv.Itoa(1024 * 1024)}
+	if _, err := client.Get("bucket", "a.bin", filepath.Join(dir, "b.bin"), options, listener); err != nil {
+		t.Fatal(err)
+	}
+	last = listener.check(t, "Get")
+	if last.Operation != "Get" || last.TransferredBytes != size || last.TotalBytes != size || last.DoneItems != 3 || last.TotalItems != 3 {
+		t.Errorf("Get: last event %+v", last)
+	}
+
+	//分片失败时事件带错误
+	listener = &progressRecorder{}
+	server.SetFailure(func(r *http.Request) bool {
+		return r.Method == http.MethodGet && strings.HasPrefix(r.Header.Get("Range"), "bytes=0-")
+	})
+	if _, err := client.Get("bucket", "a.bin", filepath.Join(dir, "c.bin"), map[string]string{"part_size": options["part_size"], "thread_num": "1"}, listener); err == nil {
+		t.Fatal("expected part error")
+	}
+	server.SetFailure(nil)
+	failed := 0
+	for _, event := range listener.events {
+		if event.Err != nil {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Errorf("Get failure: %d events with Err, want 1", failed)
+	}
+
+	//目录上传汇总每个文件的字节数,每个文件一个Action事件
+	upDir := filepath.Join(dir, "up")
+	if err := os.Mkdir(upDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, body := range map[string][]byte{"a.bin": data, "d.txt": []byte("data")} {
+		if err := ioutil.WriteFile(filepath.Join(upDir, name), body, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listener = &progressRecorder{}
+	if _, err := client.UploadFromDir(upDir, "bucket", "dir", nil, listener); err != nil {
+		t.Fatal(err)
+	}
+	last = listener.check(t, "UploadFromDir")
+	if last.Operation != "UploadFromDir" || last.TransferredBytes != size+4 || last.DoneItems != 2 || last.TotalItems != 2 || last.Estimating {
+		t.Errorf("UploadFromDir: last event %+v", last)
+	}
+	actions := make(map[string]string)
+	for _, event := range listener.events {
+		if event.Action != "" {
+			actions[event.Key] = event.Action
+		}
+	}
+	if actions["dir/a.bin"] != "upload" || actions["dir/d.txt"] != "upload" || len(actions) != 2 {
+		t.Errorf("UploadFromDir actions = %v", actions)
+	}
+}
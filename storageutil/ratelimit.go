@@ -0,0 +1,183 @@
+package storageutil
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// RateLimiter 令牌桶限速,单位字节/秒,0为不限速,可在运行时调整
+type RateLimiter struct {
+	lock   sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter 实例化限速器
+func NewRateLimiter(rate int64) *RateLimiter {
+	l := &RateLimiter{}
+	l.SetRate(rate)
+	return l
+}
+
+// SetRate 设置每秒字节数
+func (l *RateLimiter) SetRate(rate int64) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.rate = rate
+	l.tokens = 0
+	l.last = time.Now()
+}
+
+// Rate 当前每秒字节数
+func (l *RateLimiter) Rate() int64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.rate
+}
+
+// Wait 消耗n个令牌,令牌不足时等待,最多积累1秒的令牌
+func (l *RateLimiter) Wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+	l.lock.Lock()
+	if l.rate <= 0 {
+		l.lock.Unlock()
+		return
+	}
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+	if l.tokens > float64(l.rate) {
+		l.tokens = float64(l.rate)
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+	}
+	l.lock.Unlock()
+	time.Sleep(wait)
+}
+
+// Reader 限速读取
+func (l *RateLimiter) Reader(r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &limitReader{r: r, limiter: l}
+}
+
+type limitReader struct {
+	r       io.Reader
+	limiter *RateLimiter
+}
+
+func (lr *limitReader) Read(p []byte) (int, error) {
+	if len(p) > 32*1024 {
+		p = p[:32*1024]
+	}
+	n, err := lr.r.Read(p)
+	lr.limiter.Wait(n)
+	return n, err
+}
+
+// Bandwidth 上传和下载限速
+type Bandwidth struct {
+	Upload   *RateLimiter
+	Download *RateLimiter
+}
+
+// NewBandwidth 实例化,默认不限速
+func NewBandwidth() *Bandwidth {
+	return &Bandwidth{Upload: NewRateLimiter(0), Download: NewRateLimiter(0)}
+}
+
+// SetLimit 设置上传和下载每秒字节数,0为不限速
+func (b *Bandwidth) SetLimit(upload, download int64) {
+	b.Upload.SetRate(upload)
+	b.Download.SetRate(download)
+}
+
+// limited 是否设置了上传或下载限速
+func (b *Bandwidth) limited() bool {
+	return b != nil && (b.Upload.Rate() > 0 || b.Download.Rate() > 0)
+}
+
+// idleTimer 空闲超时,timeout内没有读取到数据时调用cancel
+type idleTimer struct {
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func newIdleTimer(timeout time.Duration, cancel func()) *idleTimer {
+	return &idleTimer{timer: time.AfterFunc(timeout, cancel), timeout: timeout}
+}
+
+// Reader 每次读取到数据后重新计时,idleTimer为nil时返回r
+func (t *idleTimer) Reader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &idleReader{r: r, timer: t}
+}
+
+// Stop 停止计时
+func (t *idleTimer) Stop() {
+	t.timer.Stop()
+}
+
+type idleReader struct {
+	r     io.Reader
+	timer *idleTimer
+}
+
+func (ir *idleReader) Read(p []byte) (int, error) {
+	n, err := ir.r.Read(p)
+	if n > 0 {
+		ir.timer.timer.Reset(ir.timer.timeout)
+	}
+	return n, err
+}
+
+// RequestLimiter 请求频率限制,可分别设置client和每个bucket的每秒请求数
+type RequestLimiter struct {
+	client  *RateLimiter
+	lock    sync.Mutex
+	buckets map[string]*RateLimiter
+}
+
+// NewRequestLimiter 实例化,默认不限制
+func NewRequestLimiter() *RequestLimiter {
+	return &RequestLimiter{client: NewRateLimiter(0), buckets: make(map[string]*RateLimiter)}
+}
+
+// SetLimit 设置client每秒请求数,0为不限制
+func (r *RequestLimiter) SetLimit(rps int64) {
+	r.client.SetRate(rps)
+}
+
+// SetBucketLimit 设置bucket每秒请求数,0为不限制
+func (r *RequestLimiter) SetBucketLimit(bucket string, rps int64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if l, ok := r.buckets[bucket]; ok {
+		l.SetRate(rps)
+		return
+	}
+	r.buckets[bucket] = NewRateLimiter(rps)
+}
+
+// Wait 等待发送一个请求
+func (r *RequestLimiter) Wait(bucket string) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	l := r.buckets[bucket]
+	r.lock.Unlock()
+	l.Wait(1)
+	r.client.Wait(1)
+}
@@ -0,0 +1,113 @@
+package storageutil
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// slowReader 每次读取前等待delay
+type slowReader struct {
+	r     io.Reader
+	delay time.Duration
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(s.delay)
+	if len(p) > 10 {
+		p = p[:10]
+	}
+	return s.r.Read(p)
+}
+
+func TestIdleTimer(t *testing.T) {
+	tests := []struct {
+		name     string
+		delay    time.Duration
+		canceled bool
+	}{
+		//总耗时超过超时时间,但每块数据的间隔没有超过
+		{"steady", 10 * time.Millisecond, false},
+		{"stalled", 100 * time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		canceled := make(chan bool, 1)
+		idle := newIdleTimer(50*time.Millisecond, func() { canceled <- true })
+		body := &slowReader{r: bytes.NewReader(make([]byte, 100)), delay: tt.delay}
+		if _, err := io.Copy(ioutil.Discard, idle.Reader(body)); err != nil {
+			t.Fatal(err)
+		}
+		idle.Stop()
+		select {
+		case <-canceled:
+			if !tt.canceled {
+				t.Errorf("%s: canceled while data was flowing", tt.name)
+			}
+		default:
+			if tt.canceled {
+				t.Errorf("%s: not canceled after idle timeout", tt.name)
+			}
+		}
+	}
+}
+
+func TestBandwidthLimited(t *testing.T) {
+	var unset *Bandwidth
+	b := NewBandwidth()
+	if unset.limited() || b.limited() {
+		t.Error("limited without rate")
+	}
+	b.SetLimit(0, 1024)
+	if !b.limited() {
+		t.Error("not limited with download rate")
+	}
+}
+
+func TestCURL2ReaderLimit(t *testing.T) {
+	const size = 64 * 1024
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(ioutil.Discard, r.Body)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(make([]byte, size))
+		}
+	}))
+	defer server.Close()
+	//令牌桶初始为空,64KB按128KB/s限速至少需要0.5秒
+	tests := []struct {
+		name     string
+		method   string
+		upload   int64
+		download int64
+		limited  bool
+	}{
+		{"unlimited", http.MethodGet, 0, 0, false},
+		{"upload", http.MethodPut, 2 * size, 0, true},
+		{"upload unlimited", http.MethodPut, 0, 2 * size, false},
+		{"download", http.MethodGet, 0, 2 * size, true},
+		{"download unlimited", http.MethodGet, 2 * size, 0, false},
+	}
+	for _, tt := range tests {
+		bandwidth := NewBandwidth()
+		bandwidth.SetLimit(tt.upload, tt.download)
+		var body io.Reader = bytes.NewReader(nil)
+		if tt.method == http.MethodPut {
+			body = bytes.NewReader(make([]byte, size))
+		}
+		start := time.Now()
+		resp, err := CURL2ReaderLimit(bandwidth, server.URL, tt.method, nil, body, nil)
+		elapsed := time.Since(start)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if tt.method == http.MethodGet && resp["Body"].(*bytes.Buffer).Len() != size {
+			t.Errorf("%s: read %d bytes, want %d", tt.name, resp["Body"].(*bytes.Buffer).Len(), size)
+		}
+		if limited := elapsed >= 400*time.Millisecond; limited != tt.limited {
+			t.Errorf("%s: took %v, limited = %v, want %v", tt.name, elapsed, limited, tt.limited)
+		}
+	}
+}
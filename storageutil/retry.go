@@ -0,0 +1,152 @@
+package storageutil
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/shideqin/storage/storagebase"
+)
+
+// ErrorCode 解析响应中的错误码,如SlowDown
+func ErrorCode(resp map[string]interface{}) string {
+	if status, _ := resp["StatusCode"].(int); status < 300 {
+		return ""
+	}
+	body, ok := resp["Body"].(*bytes.Buffer)
+	if !ok || body.Len() == 0 {
+		return ""
+	}
+	var result struct {
+		Code string `xml:"Code"`
+	}
+	_ = xml.Unmarshal(body.Bytes(), &result)
+	return result.Code
+}
+
+// RequestControl 请求控制,包括重试策略,带宽限速,请求频率限制和限流统计,字段为nil时不生效
+type RequestControl struct {
+	RetryPolicy *storagebase.RetryPolicy
+	Bandwidth   *Bandwidth
+	Limiter     *RequestLimiter
+	Throttle    *Throttle
+}
+
+// IsThrottled 判断响应是否为服务端限流
+func IsThrottled(statusCode int, errorCode string) bool {
+	switch errorCode {
+	case "SlowDown", "Throttling", "ThrottlingException", "RequestLimitExceeded", "TooManyRequests":
+		return true
+	}
+	return statusCode == 429 || statusCode == 503
+}
+
+// Retry 按请求控制执行请求,policy为nil时不重试
+func Retry(control *RequestControl, bucket string, request func() (map[string]interface{}, error)) (map[string]interface{}, error) {
+	if control == nil {
+		control = &RequestControl{}
+	}
+	for attempt := 1; ; attempt++ {
+		control.Limiter.Wait(bucket)
+		resp, err := request()
+		var statusCode int
+		var errorCode, retryAfter string
+		if err == nil {
+			statusCode, _ = resp["StatusCode"].(int)
+			errorCode = ErrorCode(resp)
+			retryAfter, _ = resp["Retry-After"].(string)
+			if IsThrottled(statusCode, errorCode) {
+				control.Throttle.Add()
+			}
+		}
+		if control.RetryPolicy == nil || !control.RetryPolicy.ShouldRetry(attempt, statusCode, errorCode, err) {
+			return resp, err
+		}
+		time.Sleep(control.RetryPolicy.Backoff(attempt, retryAfter))
+	}
+}
+
+// RetryableError 请求层以外可以重试的错误,如分块ETag与md5不一致,写本地文件失败
+type RetryableError struct {
+	Err error
+}
+
+func (e *RetryableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable 标记err可以由RetryOperation重试,err为nil时返回nil
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &RetryableError{Err: err}
+}
+
+// RetryOperation 按重试策略执行operation,只重试Retryable标记的错误,policy为nil时不重试
+// 请求本身的失败已在请求层重试,不再重复重试,放弃重试时返回原始错误
+func RetryOperation(policy *storagebase.RetryPolicy, operation func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := operation()
+		var retryable *RetryableError
+		if !errors.As(err, &retryable) {
+			return err
+		}
+		if policy == nil || !policy.ShouldRetry(attempt, 0, "", retryable.Err) {
+			return retryable.Err
+		}
+		time.Sleep(policy.Backoff(attempt, ""))
+	}
+}
+
+// CURLWithRetry 按请求控制发送请求,body不能重复读取时只请求一次
+func CURLWithRetry(control *RequestControl, bucket, addr, method string, headers map[string]string, body io.Reader, exitChan <-chan bool) (map[string]interface{}, error) {
+	if exitChan == nil {
+		var tmpExitChan = make(chan bool)
+		defer close(tmpExitChan)
+		exitChan = tmpExitChan
+	}
+	var rewind func() io.Reader
+	switch b := body.(type) {
+	case *bytes.Buffer:
+		data := b.Bytes()
+		rewind = func() io.Reader {
+			return bytes.NewReader(data)
+		}
+	case io.ReadSeeker:
+		offset, err := b.Seek(0, io.SeekCurrent)
+		if err == nil {
+			rewind = func() io.Reader {
+				_, _ = b.Seek(offset, io.SeekStart)
+				return b
+			}
+		}
+	}
+	if control == nil {
+		control = &RequestControl{}
+	}
+	if rewind == nil {
+		noRetry := *control
+		noRetry.RetryPolicy = nil
+		control = &noRetry
+		rewind = func() io.Reader {
+			return body
+		}
+	}
+	return Retry(control, bucket, func() (map[string]interface{}, error) {
+		return CURL2ReaderLimit(control.Bandwidth, addr, method, headers, rewind(), exitChan)
+	})
+}
+
+// HeaderWithRetry 按请求控制发送http header请求
+func HeaderWithRetry(control *RequestControl, bucket, addr, method string, headers map[string]string) (map[string]interface{}, error) {
+	return Retry(control, bucket, func() (map[string]interface{}, error) {
+		return Header(addr, method, headers)
+	})
+}
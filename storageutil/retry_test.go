@@ -0,0 +1,103 @@
+package storageutil_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shideqin/storage/storagebase"
+	"github.com/shideqin/storage/storageutil"
+)
+
+func TestCURLWithRetryBody(t *testing.T) {
+	var lock sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		lock.Lock()
+		bodies = append(bodies, string(body))
+		lock.Unlock()
+		w.Header().Set("X-Amz-Request-Id", "test")
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	control := &storageutil.RequestControl{RetryPolicy: &storagebase.RetryPolicy{
+		MaxAttempts:          3,
+		BaseBackoff:          time.Millisecond,
+		RetryableStatusCodes: []int{500},
+	}}
+
+	seeker := strings.NewReader("skip:payload")
+	_, _ = seeker.Seek(5, io.SeekStart)
+	tests := []struct {
+		name string
+		body io.Reader
+		want []string
+	}{
+		{"buffer", bytes.NewBufferString("payload"), []string{"payload", "payload", "payload"}},
+		{"seeker from offset", seeker, []string{"payload", "payload", "payload"}},
+		//不能重复读取的body只请求一次
+		{"non-rewindable", io.MultiReader(strings.NewReader("payload")), []string{"payload"}},
+	}
+	for _, tt := range tests {
+		bodies = nil
+		resp, err := storageutil.CURLWithRetry(control, "bucket", server.URL, "PUT", map[string]string{}, tt.body, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if status := resp["StatusCode"].(int); status != http.StatusInternalServerError {
+			t.Errorf("%s: StatusCode = %d, want 500", tt.name, status)
+		}
+		if strings.Join(bodies, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: request bodies = %q, want %q", tt.name, bodies, tt.want)
+		}
+	}
+	if control.RetryPolicy == nil {
+		t.Error("non-rewindable body cleared the shared retry policy")
+	}
+}
+
+func TestRetryOperation(t *testing.T) {
+	policy := &storagebase.RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond}
+	failed := errors.New("failed")
+	tests := []struct {
+		name     string
+		policy   *storagebase.RetryPolicy
+		failures int
+		err      error
+		calls    int
+		wantErr  bool
+	}{
+		{"success", policy, 0, failed, 1, false},
+		{"retryable", policy, 2, storageutil.Retryable(failed), 3, false},
+		{"retryable gives up", policy, 3, storageutil.Retryable(failed), 3, true},
+		//请求层的错误已经重试过
+		{"not retryable", policy, 1, failed, 1, true},
+		{"no policy", nil, 1, storageutil.Retryable(failed), 1, true},
+	}
+	for _, tt := range tests {
+		calls := 0
+		err := storageutil.RetryOperation(tt.policy, func() error {
+			calls++
+			if calls <= tt.failures {
+				return tt.err
+			}
+			return nil
+		})
+		if (err != nil) != tt.wantErr || calls != tt.calls {
+			t.Errorf("%s: err = %v, calls = %d, want error %v, calls %d", tt.name, err, calls, tt.wantErr, tt.calls)
+		}
+		//放弃重试时返回原始错误,外层不会再次重试
+		var retryable *storageutil.RetryableError
+		if errors.As(err, &retryable) {
+			t.Errorf("%s: returned a RetryableError", tt.name)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package storageutil
+
+import (
+	"encoding/base64"
+)
+
+// SSEOptionKeys 服务端加密相关参数
+var SSEOptionKeys = []string{
+	"sse",
+	"sse_kms_key_id",
+	"sse_kms_context",
+	"sse_c_algorithm",
+	"sse_c_key",
+	"sse_c_key_md5",
+	"copy_source_sse_c_algorithm",
+	"copy_source_sse_c_key",
+	"copy_source_sse_c_key_md5",
+}
+
+// SSEOptions 将options中的加密参数合并到dst
+func SSEOptions(dst, options map[string]string) map[string]string {
+	if dst == nil {
+		dst = make(map[string]string)
+	}
+	for _, k := range SSEOptionKeys {
+		if options[k] != "" {
+			dst[k] = options[k]
+		}
+	}
+	return dst
+}
+
+// SourceSSEOptions 读取源文件时使用的加密参数(copy_source_sse_c_*)和版本(source_version_id)
+func SourceSSEOptions(options map[string]string) map[string]string {
+	return map[string]string{
+		"sse_c_algorithm": options["copy_source_sse_c_algorithm"],
+		"sse_c_key":       options["copy_source_sse_c_key"],
+		"sse_c_key_md5":   options["copy_source_sse_c_key_md5"],
+		"version_id":      options["source_version_id"],
+	}
+}
+
+// HeadSSEOptions 将Head结果中的服务端加密方式合并到dst,dst中已指定加密方式时不合并
+// 用于复制到自身替换元数据,不指定加密方式时会使用bucket的默认加密
+func HeadSSEOptions(dst map[string]string, head map[string]interface{}) map[string]string {
+	if dst == nil {
+		dst = make(map[string]string)
+	}
+	if dst["sse"] != "" || dst["sse_c_key"] != "" {
+		return dst
+	}
+	if sse, ok := head["X-Amz-Server-Side-Encryption"].(string); ok && sse != "" {
+		dst["sse"] = sse
+		if keyID, ok := head["X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"].(string); ok && keyID != "" {
+			dst["sse_kms_key_id"] = keyID
+		}
+	}
+	return dst
+}
+
+// SSEHeaders 创建文件时的加密header(Put/Copy/InitUpload)
+// sse: AES256或aws:kms, sse_kms_key_id: kms key id, sse_kms_context: kms加密上下文(json)
+func SSEHeaders(options map[string]string) map[string]string {
+	headers := SSECHeaders(options)
+	if options["sse"] != "" && options["sse_c_key"] == "" {
+		headers["x-amz-server-side-encryption"] = options["sse"]
+		if options["sse"] == "aws:kms" {
+			if options["sse_kms_key_id"] != "" {
+				headers["x-amz-server-side-encryption-aws-kms-key-id"] = options["sse_kms_key_id"]
+			}
+			if options["sse_kms_context"] != "" {
+				headers["x-amz-server-side-encryption-context"] = Base64Encode([]byte(options["sse_kms_context"]))
+			}
+		}
+	}
+	return headers
+}
+
+// SSECHeaders 客户提供密钥的加密header(UploadPart/Head/Cat等)
+// sse_c_key: base64编码的256位密钥, sse_c_algorithm默认AES256, sse_c_key_md5为空时自动计算
+func SSECHeaders(options map[string]string) map[string]string {
+	return customerKeyHeaders("x-amz-server-side-encryption-customer-", options["sse_c_algorithm"], options["sse_c_key"], options["sse_c_key_md5"])
+}
+
+// CopySourceSSECHeaders 复制源文件的客户提供密钥header
+func CopySourceSSECHeaders(options map[string]string) map[string]string {
+	return customerKeyHeaders("x-amz-copy-source-server-side-encryption-customer-", options["copy_source_sse_c_algorithm"], options["copy_source_sse_c_key"], options["copy_source_sse_c_key_md5"])
+}
+
+func customerKeyHeaders(prefix, algorithm, key, keyMd5 string) map[string]string {
+	headers := make(map[string]string)
+	if key == "" {
+		return headers
+	}
+	if algorithm == "" {
+		algorithm = "AES256"
+	}
+	if keyMd5 == "" {
+		rawKey, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			//非base64时按原始密钥处理
+			rawKey = []byte(key)
+			key = Base64Encode(rawKey)
+		}
+		keyMd5 = Base64Encode(Md5Byte(rawKey))
+	}
+	headers[prefix+"algorithm"] = algorithm
+	headers[prefix+"key"] = key
+	headers[prefix+"key-md5"] = keyMd5
+	return headers
+}
@@ -0,0 +1,167 @@
+package storageutil_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/shideqin/storage/storagetest"
+	"github.com/shideqin/storage/storageutil"
+)
+
+// requestRecorder 记录发到测试服务器的请求
+type requestRecorder struct {
+	lock     sync.Mutex
+	requests []*http.Request
+}
+
+func recordRequests(server *storagetest.Server) *requestRecorder {
+	rec := &requestRecorder{}
+	server.SetFailure(func(r *http.Request) bool {
+		rec.lock.Lock()
+		defer rec.lock.Unlock()
+		rec.requests = append(rec.requests, r)
+		return false
+	})
+	return rec
+}
+
+// find 方法相同且match返回true的请求
+func (rec *requestRecorder) find(method string, match func(r *http.Request) bool) []*http.Request {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	var found []*http.Request
+	for _, r := range rec.requests {
+		if r.Method == method && (match == nil || match(r)) {
+			found = append(found, r)
+		}
+	}
+	return found
+}
+
+func (rec *requestRecorder) reset() {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	rec.requests = nil
+}
+
+func TestSSEHeaders(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	keyMd5 := storageutil.Base64Encode(storageutil.Md5Byte(key))
+	tests := []struct {
+		name    string
+		options map[string]string
+		want    map[string]string
+	}{
+		{"none", nil, map[string]string{}},
+		{"sse-s3", map[string]string{"sse": "AES256"}, map[string]string{"x-amz-server-side-encryption": "AES256"}},
+		{"sse-kms", map[string]string{"sse": "aws:kms", "sse_kms_key_id": "key-1", "sse_kms_context": `{"a":"b"}`}, map[string]string{
+			"x-amz-server-side-encryption":                "aws:kms",
+			"x-amz-server-side-encryption-aws-kms-key-id": "key-1",
+			"x-amz-server-side-encryption-context":        storageutil.Base64Encode([]byte(`{"a":"b"}`)),
+		}},
+		{"sse-c", map[string]string{"sse_c_key": storageutil.Base64Encode(key)}, map[string]string{
+			"x-amz-server-side-encryption-customer-algorithm": "AES256",
+			"x-amz-server-side-encryption-customer-key":       storageutil.Base64Encode(key),
+			"x-amz-server-side-encryption-customer-key-md5":   keyMd5,
+		}},
+		//客户密钥优先
+		{"sse-c with sse", map[string]string{"sse": "AES256", "sse_c_key": storageutil.Base64Encode(key)}, map[string]string{
+			"x-amz-server-side-encryption-customer-algorithm": "AES256",
+			"x-amz-server-side-encryption-customer-key":       storageutil.Base64Encode(key),
+			"x-amz-server-side-encryption-customer-key-md5":   keyMd5,
+		}},
+	}
+	for _, tt := range tests {
+		got := storageutil.SSEHeaders(tt.options)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: SSEHeaders = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for k, v := range tt.want {
+			if got[k] != v {
+				t.Errorf("%s: %s = %q, want %q", tt.name, k, got[k], v)
+			}
+		}
+	}
+	source := storageutil.CopySourceSSECHeaders(map[string]string{"copy_source_sse_c_key": storageutil.Base64Encode(key)})
+	if source["x-amz-copy-source-server-side-encryption-customer-key-md5"] != keyMd5 {
+		t.Errorf("CopySourceSSECHeaders = %v", source)
+	}
+}
+
+func TestSSERequests(t *testing.T) {
+	server, client := newMirrorClient()
+	defer server.Close()
+	rec := recordRequests(server)
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localFile := filepath.Join(dir, "a.txt")
+	if err := ioutil.WriteFile(localFile, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	customerKey := storageutil.Base64Encode(bytes.Repeat([]byte{1}, 32))
+	hasCustomerKey := func(prefix string) func(r *http.Request) bool {
+		return func(r *http.Request) bool {
+			return r.Header.Get(prefix+"Algorithm") == "AES256" && r.Header.Get(prefix+"Key") == customerKey && r.Header.Get(prefix+"Key-Md5") != ""
+		}
+	}
+	sseC := hasCustomerKey("X-Amz-Server-Side-Encryption-Customer-")
+
+	//SSE-KMS保存在object上
+	if _, err := client.Upload(localFile, "bucket", "kms.txt", map[string]string{"sse": "aws:kms", "sse_kms_key_id": "key-1"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.Object("bucket", "kms.txt").Header.Get("X-Amz-Server-Side-Encryption"); got != "aws:kms" {
+		t.Errorf("kms object encryption = %q", got)
+	}
+
+	//SSE-C在上传,分块上传,Head,Cat和下载的每个请求中发送
+	rec.reset()
+	options := map[string]string{"sse_c_key": customerKey}
+	if _, err := client.Upload(localFile, "bucket", "c.txt", options, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.UploadLargeFile(localFile, "bucket", "large.txt", options, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Cat("bucket", "c.txt", options); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get("bucket", "c.txt", filepath.Join(dir, "b.txt"), options, nil); err != nil {
+		t.Fatal(err)
+	}
+	//完成分块上传不需要密钥
+	needKey := func(r *http.Request) bool {
+		return r.Method != http.MethodPost || r.URL.Query().Get("uploadId") == ""
+	}
+	for _, method := range []string{http.MethodPut, http.MethodPost, http.MethodHead, http.MethodGet} {
+		all, withKey := rec.find(method, needKey), rec.find(method, sseC)
+		if len(all) == 0 || len(withKey) != len(all) {
+			t.Errorf("%s: %d of %d requests with customer key", method, len(withKey), len(all))
+		}
+	}
+
+	//复制源文件使用copy_source_sse_c_*
+	rec.reset()
+	copyOptions := map[string]string{"copy_source_sse_c_key": customerKey, "sse_c_key": customerKey}
+	if _, err := client.CopyObject("bucket", "copy.txt", "/bucket/c.txt", copyOptions, nil); err != nil {
+		t.Fatal(err)
+	}
+	copies := rec.find(http.MethodPut, func(r *http.Request) bool {
+		return r.Header.Get("X-Amz-Copy-Source") != ""
+	})
+	if len(copies) != 1 || !hasCustomerKey("X-Amz-Copy-Source-Server-Side-Encryption-Customer-")(copies[0]) || !sseC(copies[0]) {
+		t.Errorf("copy requests = %d, want 1 with source and target customer keys", len(copies))
+	}
+	if heads := rec.find(http.MethodHead, sseC); len(heads) == 0 {
+		t.Error("source Head without customer key")
+	}
+}
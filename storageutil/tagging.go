@@ -0,0 +1,55 @@
+package storageutil
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// ParseTags 解析标签,格式同x-amz-tagging,如k1=v1&k2=v2
+func ParseTags(value string) (map[string]string, error) {
+	query, err := url.ParseQuery(value)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(query))
+	for k, v := range query {
+		tags[k] = v[0]
+	}
+	return tags, nil
+}
+
+// TaggingBody 设置标签请求的body,按key排序
+func TaggingBody(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var body bytes.Buffer
+	body.WriteString("<Tagging><TagSet>")
+	for _, k := range keys {
+		body.WriteString("<Tag><Key>")
+		_ = xml.EscapeText(&body, []byte(k))
+		body.WriteString("</Key><Value>")
+		_ = xml.EscapeText(&body, []byte(tags[k]))
+		body.WriteString("</Value></Tag>")
+	}
+	body.WriteString("</TagSet></Tagging>")
+	return body.String()
+}
+
+// RestoreBody 取回归档object请求的body,tier为Standard,Bulk或Expedited,为空时使用默认
+func RestoreBody(days int, tier string) string {
+	var body bytes.Buffer
+	body.WriteString("<RestoreRequest><Days>" + strconv.Itoa(days) + "</Days>")
+	if tier != "" {
+		body.WriteString("<GlacierJobParameters><Tier>")
+		_ = xml.EscapeText(&body, []byte(tier))
+		body.WriteString("</Tier></GlacierJobParameters>")
+	}
+	body.WriteString("</RestoreRequest>")
+	return body.String()
+}
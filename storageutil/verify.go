@@ -0,0 +1,263 @@
+package storageutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/shideqin/storage/storagebase"
+)
+
+// CompareDiff 源和目标不一致的object
+type CompareDiff struct {
+	//相对前缀的key
+	Key string `json:"key"`
+	//missing目标不存在,extra源不存在,size_mismatch大小不同,checksum_mismatch内容md5不同,unverified无法比较内容
+	Status  string `json:"status"`
+	SrcSize int64  `json:"src_size"`
+	DstSize int64  `json:"dst_size"`
+	SrcMd5  string `json:"src_md5,omitempty"`
+	DstMd5  string `json:"dst_md5,omitempty"`
+}
+
+// CompareReport 比较结果,Diffs按key排序
+type CompareReport struct {
+	Total            int
+	Match            int
+	Missing          int
+	Extra            int
+	SizeMismatch     int
+	ChecksumMismatch int
+	//大小相同但无法获取内容md5,如两边分块大小不同的分块上传或KMS加密的object
+	Unverified int
+	//continue_on_error时Head失败的object数
+	Failed int
+	Diffs  []CompareDiff
+	//OK是否接受Unverified,options["allow_unverified"]为true时设置
+	AllowUnverified bool
+}
+
+// OK 源和目标是否一致,Unverified默认视为不一致,AllowUnverified为true时不计入
+func (r *CompareReport) OK() bool {
+	failed := r.Missing + r.Extra + r.SizeMismatch + r.ChecksumMismatch + r.Failed
+	if !r.AllowUnverified {
+		failed += r.Unverified
+	}
+	return failed == 0
+}
+
+// objectLister 按key顺序逐个返回bucket/prefix下的object
+type objectLister struct {
+	client storagebase.IClient
+	bucket string
+	prefix string
+	marker string
+	page   []storagebase.ListObjectContents
+	done   bool
+}
+
+// next 下一个object,没有时返回nil
+func (l *objectLister) next() (*storagebase.ListObjectContents, error) {
+	for len(l.page) == 0 {
+		if l.done {
+			return nil, nil
+		}
+		list, err := l.client.ListObject(l.bucket, map[string]string{"prefix": l.prefix, "marker": l.marker, "max-keys": "1000"})
+		if err != nil {
+			return nil, err
+		}
+		l.page = list.Contents
+		l.done = list.IsTruncated != "true" || len(list.Contents) == 0
+		if len(list.Contents) > 0 {
+			l.marker = list.Contents[len(list.Contents)-1].Key
+		}
+	}
+	object := l.page[0]
+	l.page = l.page[1:]
+	return &object, nil
+}
+
+// Compare 比较srcBucket/srcPrefix和dstBucket/dstPrefix下的object,按相对前缀的key对应,两边可以是不同的客户端,如s3v2和s3v4
+// 迁移前用于确认需要传输的object,迁移后用于校验目标,SyncAllObject使用full_path时dstPrefix为prefix加源前缀
+// options:
+//
+//	compare: checksum(默认)大小相同时比较内容md5,size只比较大小
+//	report_file: 不一致的object写入的结果清单,每行一个CompareDiff
+//	allow_unverified: true时无法比较内容的object不影响OK()的结果
+//
+// 列表中的ETag相同时认为内容相同,不同时Head两边,使用content-md5元数据或非分块上传的ETag比较
+// threadNum为Head的并发数,同时支持continue_on_error,item_attempts和include/exclude等过滤参数
+func Compare(srcClient storagebase.IClient, srcBucket, srcPrefix string, dstClient storagebase.IClient, dstBucket, dstPrefix string, options map[string]string, listener storagebase.ProgressListener, threadNum int) (*CompareReport, error) {
+	mode := options["compare"]
+	if mode == "" {
+		mode = "checksum"
+	}
+	if mode != "checksum" && mode != "size" {
+		return nil, fmt.Errorf(" Compare Mode: %s Error: must be checksum or size", mode)
+	}
+	filter, filterErr := NewFilter(options)
+	if filterErr != nil {
+		return nil, fmt.Errorf(" Compare Filter Error: %v", filterErr)
+	}
+	if srcPrefix != "" {
+		srcPrefix = strings.TrimSuffix(srcPrefix, "/") + "/"
+	}
+	if dstPrefix != "" {
+		dstPrefix = strings.TrimSuffix(dstPrefix, "/") + "/"
+	}
+	if threadNum < 1 {
+		threadNum = 1
+	}
+	srcLister := &objectLister{client: srcClient, bucket: srcBucket, prefix: srcPrefix}
+	dstLister := &objectLister{client: dstClient, bucket: dstBucket, prefix: dstPrefix}
+	//跳过被过滤的object
+	next := func(l *objectLister) (*storagebase.ListObjectContents, error) {
+		for {
+			object, err := l.next()
+			if object == nil || err != nil {
+				return object, err
+			}
+			if ok, _ := filter.MatchObject(l.prefix, *object); ok {
+				return object, nil
+			}
+		}
+	}
+
+	report := &CompareReport{AllowUnverified: options["allow_unverified"] == "true"}
+	var lock sync.Mutex
+	addDiff := func(diff CompareDiff) {
+		lock.Lock()
+		defer lock.Unlock()
+		switch diff.Status {
+		case "match":
+			report.Match++
+			return
+		case "missing":
+			report.Missing++
+		case "extra":
+			report.Extra++
+		case "size_mismatch":
+			report.SizeMismatch++
+		case "checksum_mismatch":
+			report.ChecksumMismatch++
+		case "unverified":
+			report.Unverified++
+		}
+		report.Diffs = append(report.Diffs, diff)
+	}
+	var queueMaxSize = NewConcurrency(threadNum, nil)
+	var wg sync.WaitGroup
+	bulk := NewBulk("Compare", options)
+	progress := NewProgress(listener, "Compare", srcPrefix, 0, 0)
+	progress.SetEstimating(true)
+
+	//列表出错时停止比较,等待已开始的Head完成后返回
+	var dst *storagebase.ListObjectContents
+	src, listErr := next(srcLister)
+	if listErr == nil {
+		dst, listErr = next(dstLister)
+	}
+	for listErr == nil && (src != nil || dst != nil) && !bulk.Exit() {
+		report.Total++
+		progress.AddTotal(0, 1)
+		var key string
+		switch {
+		case dst == nil || (src != nil && strings.TrimPrefix(src.Key, srcPrefix) < strings.TrimPrefix(dst.Key, dstPrefix)):
+			key = strings.TrimPrefix(src.Key, srcPrefix)
+			addDiff(CompareDiff{Key: key, Status: "missing", SrcSize: int64(src.Size)})
+			progress.Action(key, "missing", "not_found", int64(src.Size), nil)
+			src, listErr = next(srcLister)
+			continue
+		case src == nil || strings.TrimPrefix(src.Key, srcPrefix) > strings.TrimPrefix(dst.Key, dstPrefix):
+			key = strings.TrimPrefix(dst.Key, dstPrefix)
+			addDiff(CompareDiff{Key: key, Status: "extra", DstSize: int64(dst.Size)})
+			progress.Action(key, "extra", "not_in_source", int64(dst.Size), nil)
+			dst, listErr = next(dstLister)
+			continue
+		}
+		key = strings.TrimPrefix(src.Key, srcPrefix)
+		diff := CompareDiff{Key: key, Status: "match", SrcSize: int64(src.Size), DstSize: int64(dst.Size)}
+		if src.Size != dst.Size {
+			diff.Status = "size_mismatch"
+		} else if mode == "checksum" && TrimETag(src.ETag) != TrimETag(dst.ETag) {
+			//ETag不同时内容不一定不同,如不同的分块大小,需要比较内容md5
+			wg.Add(1)
+			queueMaxSize.Acquire()
+			go func(srcKey, dstKey string, diff CompareDiff) {
+				defer func() {
+					wg.Done()
+					queueMaxSize.Release()
+				}()
+				err := bulk.Do(diff.Key, func() error {
+					srcHead, err := srcClient.Head(srcBucket, srcKey, SourceSSEOptions(options))
+					if err != nil {
+						return err
+					}
+					dstHead, err := dstClient.Head(dstBucket, dstKey, options)
+					if err != nil {
+						return err
+					}
+					diff.SrcMd5, diff.DstMd5 = ContentMd5(srcHead), ContentMd5(dstHead)
+					switch {
+					case diff.SrcMd5 == "" || diff.DstMd5 == "":
+						diff.Status = "unverified"
+					case diff.SrcMd5 != diff.DstMd5:
+						diff.Status = "checksum_mismatch"
+					default:
+						diff.Status = "match"
+					}
+					return nil
+				})
+				if err == nil {
+					addDiff(diff)
+				}
+				progress.Action(diff.Key, diff.Status, "", diff.SrcSize, err)
+			}(src.Key, dst.Key, diff)
+			diff.Status = ""
+		}
+		if diff.Status != "" {
+			addDiff(diff)
+			progress.Action(key, diff.Status, "", diff.SrcSize, nil)
+		}
+		if src, listErr = next(srcLister); listErr == nil {
+			dst, listErr = next(dstLister)
+		}
+	}
+	wg.Wait()
+	progress.SetEstimating(false)
+	if listErr != nil {
+		return nil, listErr
+	}
+	counts, bulkErr := bulk.Result(map[string]int{})
+	if counts == nil {
+		return nil, bulkErr
+	}
+	report.Failed = counts["Failed"]
+	sort.Slice(report.Diffs, func(i, j int) bool {
+		return report.Diffs[i].Key < report.Diffs[j].Key
+	})
+	if reportFile := options["report_file"]; reportFile != "" {
+		if err := writeCompareReport(reportFile, report.Diffs); err != nil {
+			return nil, fmt.Errorf(" Compare Write reportFile: %s Error: %v", reportFile, err)
+		}
+	}
+	return report, bulkErr
+}
+
+func writeCompareReport(reportFile string, diffs []CompareDiff) error {
+	fd, err := os.OpenFile(reportFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(fd)
+	for _, diff := range diffs {
+		if err := encoder.Encode(diff); err != nil {
+			_ = fd.Close()
+			return err
+		}
+	}
+	return fd.Close()
+}
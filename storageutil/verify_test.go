@@ -0,0 +1,99 @@
+package storageutil_test
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shideqin/storage/storagebase"
+	"github.com/shideqin/storage/storageutil"
+)
+
+// listClient 内存中按key排序的object列表,Head较慢,failPage时第二页列表失败
+type listClient struct {
+	storagebase.IClient
+	objects  []storagebase.ListObjectContents
+	heads    map[string]map[string]interface{}
+	failPage bool
+	active   int32
+}
+
+func (c *listClient) ListObject(bucket string, options map[string]string) (*storagebase.ListObjectResult, error) {
+	if c.failPage && options["marker"] != "" {
+		return nil, errors.New("list failed")
+	}
+	maxKeys, _ := strconv.Atoi(options["max-keys"])
+	result := &storagebase.ListObjectResult{IsTruncated: "false"}
+	for _, object := range c.objects {
+		if object.Key <= options["marker"] || !strings.HasPrefix(object.Key, options["prefix"]) {
+			continue
+		}
+		if len(result.Contents) == maxKeys {
+			result.IsTruncated = "true"
+			break
+		}
+		result.Contents = append(result.Contents, object)
+	}
+	return result, nil
+}
+
+func (c *listClient) Head(bucket, object string, options map[string]string) (map[string]interface{}, error) {
+	atomic.AddInt32(&c.active, 1)
+	defer atomic.AddInt32(&c.active, -1)
+	time.Sleep(5 * time.Millisecond)
+	return c.heads[object], nil
+}
+
+func TestCompareListErrorWaitsForHeads(t *testing.T) {
+	//大小相同ETag不同,需要Head比较
+	src, dst := &listClient{}, &listClient{failPage: true}
+	for i := 0; i < 1001; i++ {
+		key := fmt.Sprintf("data/%04d", i)
+		src.objects = append(src.objects, storagebase.ListObjectContents{Key: key, Size: 4, ETag: `"a"`})
+		dst.objects = append(dst.objects, storagebase.ListObjectContents{Key: key, Size: 4, ETag: `"b"`})
+	}
+	_, err := storageutil.Compare(src, "src", "data", dst, "dst", "data", nil, nil, 4)
+	if err == nil {
+		t.Fatal("expected list error")
+	}
+	if n := atomic.LoadInt32(&src.active) + atomic.LoadInt32(&dst.active); n != 0 {
+		t.Errorf("%d Head requests still running after Compare returned", n)
+	}
+}
+
+func TestCompareUnverified(t *testing.T) {
+	const md5 = `"841a2d689ad86bd1611447453c22c6fc"`
+	src := &listClient{
+		objects: []storagebase.ListObjectContents{{Key: "a.txt", Size: 4, ETag: md5}},
+		heads:   map[string]map[string]interface{}{"a.txt": {"Etag": md5}},
+	}
+	//KMS加密的object的ETag不是md5,无法比较内容
+	dst := &listClient{
+		objects: []storagebase.ListObjectContents{{Key: "a.txt", Size: 4, ETag: `"00000000000000000000000000000000"`}},
+		heads:   map[string]map[string]interface{}{"a.txt": {"Etag": `"00000000000000000000000000000000"`, "X-Amz-Server-Side-Encryption": "aws:kms"}},
+	}
+
+	tests := []struct {
+		options map[string]string
+		ok      bool
+	}{
+		{nil, false},
+		{map[string]string{"allow_unverified": "true"}, true},
+	}
+	for _, tt := range tests {
+		report, err := storageutil.Compare(src, "src", "", dst, "dst", "", tt.options, nil, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Unverified != 1 {
+			t.Errorf("%v: Unverified = %d, want 1", tt.options, report.Unverified)
+		}
+		if report.OK() != tt.ok {
+			t.Errorf("%v: OK = %v, want %v", tt.options, report.OK(), tt.ok)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package storageutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/shideqin/storage/storagebase"
+)
+
+// SymlinkMeta 保留符号链接时记录链接目标的元数据
+const SymlinkMeta = "x-amz-meta-symlink-target"
+
+// WalkStream的缓冲大小,限制遍历领先上传的数量
+const walkBufferSize = 1000
+
+var errWalkStopped = errors.New("walk stopped")
+
+// WalkEntry 遍历目录得到的文件
+type WalkEntry struct {
+	//相对目录的路径,空目录以/结尾
+	Name string
+	//文件信息,跟随符号链接时为目标文件的信息
+	Info os.FileInfo
+	//保留符号链接时链接指向的路径
+	Link string
+	//跳过的原因,如symlink,special
+	Skip string
+	//无法读取的错误
+	Err error
+}
+
+// Marker 是否为空目录或符号链接的标记object
+func (e WalkEntry) Marker() bool {
+	return e.Link != "" || strings.HasSuffix(e.Name, "/")
+}
+
+// Walk 按object key的顺序遍历目录,fn返回错误时停止遍历
+// options:
+//
+//	symlinks: follow(默认)跟随符号链接,preserve上传为带链接目标元数据的空object,skip跳过
+//	empty_dirs: true时空目录上传为dir/标记object
+//	suffix: 逗号分隔的后缀,不区分大小写,只处理匹配的文件,同Filter
+//
+// socket,设备等特殊文件跳过,无法读取的文件和目录通过Err返回
+func Walk(localDir string, options map[string]string, fn func(entry WalkEntry) error) error {
+	localDir = strings.TrimSuffix(strings.Replace(localDir, "\\", "/", -1), "/") + "/"
+	w := &walker{root: localDir, options: options, fn: fn, parents: make(map[string]bool)}
+	if options["suffix"] != "" {
+		for _, tmpSuffix := range strings.Split(options["suffix"], ",") {
+			if tmpSuffix = strings.TrimSpace(tmpSuffix); tmpSuffix != "" {
+				w.suffix = append(w.suffix, strings.ToLower(tmpSuffix))
+			}
+		}
+	}
+	return w.walk("")
+}
+
+// WalkStream 在goroutine中遍历目录,边遍历边通过channel返回,遍历完成后关闭channel,参数见Walk
+// stop关闭后停止遍历,调用方提前退出时必须关闭stop
+func WalkStream(localDir string, options map[string]string, stop <-chan struct{}) <-chan WalkEntry {
+	entries := make(chan WalkEntry, walkBufferSize)
+	go func() {
+		defer close(entries)
+		_ = Walk(localDir, options, func(entry WalkEntry) error {
+			select {
+			case entries <- entry:
+				return nil
+			case <-stop:
+				return errWalkStopped
+			}
+		})
+	}()
+	return entries
+}
+
+type walker struct {
+	root    string
+	options map[string]string
+	suffix  []string
+	fn      func(entry WalkEntry) error
+	//当前路径上的目录,防止符号链接循环
+	parents map[string]bool
+}
+
+func (w *walker) walk(dir string) error {
+	realDir, err := filepath.EvalSymlinks(w.root + dir)
+	if err == nil {
+		if w.parents[realDir] {
+			return nil
+		}
+		w.parents[realDir] = true
+		defer delete(w.parents, realDir)
+	}
+	infos, err := ioutil.ReadDir(w.root + dir)
+	if err != nil {
+		return w.fn(WalkEntry{Name: dir, Err: err})
+	}
+	if len(infos) == 0 && dir != "" && w.options["empty_dirs"] == "true" {
+		dirInfo, _ := os.Stat(w.root + dir)
+		return w.fn(WalkEntry{Name: dir, Info: dirInfo})
+	}
+	entries := make([]WalkEntry, 0, len(infos))
+	for _, fi := range infos {
+		name := dir + fi.Name()
+		entry := WalkEntry{Name: name, Info: fi}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			switch w.options["symlinks"] {
+			case "skip":
+				entry.Skip = "symlink"
+			case "preserve":
+				entry.Link, entry.Err = os.Readlink(w.root + name)
+			default:
+				entry.Info, entry.Err = os.Stat(w.root + name)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	//目录按"名称/"排序,遍历顺序与object的key顺序一致,如a-b在a/c前面
+	sort.Slice(entries, func(i, j int) bool {
+		return walkKey(entries[i]) < walkKey(entries[j])
+	})
+	for _, entry := range entries {
+		name := entry.Name
+		if entry.Skip == "" && entry.Err == nil && entry.Link == "" {
+			if entry.Info.IsDir() {
+				if err := w.walk(name + "/"); err != nil {
+					return err
+				}
+				continue
+			}
+			if !entry.Info.Mode().IsRegular() {
+				entry.Skip = "special"
+			} else if !w.matchSuffix(name) {
+				continue
+			}
+		}
+		if err := w.fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkKey 排序用的key,会遍历的目录以/结尾
+func walkKey(entry WalkEntry) string {
+	if entry.Skip == "" && entry.Err == nil && entry.Link == "" && entry.Info.IsDir() {
+		return entry.Name + "/"
+	}
+	return entry.Name
+}
+
+func (w *walker) matchSuffix(name string) bool {
+	if len(w.suffix) == 0 {
+		return true
+	}
+	for _, tmpSuffix := range w.suffix {
+		if strings.HasSuffix(strings.ToLower(name), tmpSuffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkerOptions 上传空目录或符号链接标记object的参数
+func MarkerOptions(entry WalkEntry, options map[string]string) map[string]string {
+	opts := MetaOptions(SSEOptions(map[string]string{"acl": options["acl"]}, options), options)
+	if entry.Link != "" {
+		opts[SymlinkMeta] = entry.Link
+	}
+	if entry.Info != nil {
+		opts = FileAttrOptions(opts, entry.Info, options)
+	}
+	return opts
+}
+
+// SameMarker 判断已存在的object是否为相同的标记object
+func SameMarker(head map[string]interface{}, entry WalkEntry) bool {
+	if head == nil || HeadSize(head, false) != 0 {
+		return false
+	}
+	return HeadMeta(head)[SymlinkMeta] == entry.Link
+}
+
+// PutMarker 上传空目录或符号链接标记object
+func PutMarker(client storagebase.IClient, bucket, object string, entry WalkEntry, options map[string]string) error {
+	_, err := client.Put(bytes.NewReader(nil), 0, bucket, object, MarkerOptions(entry, options))
+	return err
+}
+
+// CreateSymlink 根据符号链接标记object创建本地符号链接,已存在的文件或符号链接被替换
+// target必须为相对路径且指向rootDir内,rootDir为空时为localFile所在目录
+func CreateSymlink(localFile, target, rootDir string) error {
+	if err := checkSymlinkTarget(localFile, target, rootDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(localFile), 0755); err != nil {
+		return err
+	}
+	if fi, err := os.Lstat(localFile); err == nil {
+		if fi.IsDir() {
+			return fmt.Errorf("%s is a directory", localFile)
+		}
+		if err := os.Remove(localFile); err != nil {
+			return err
+		}
+	}
+	return os.Symlink(target, localFile)
+}
+
+// checkSymlinkTarget 防止object元数据创建指向目录外的符号链接
+func checkSymlinkTarget(localFile, target, rootDir string) error {
+	if target == "" || path.IsAbs(target) || filepath.IsAbs(target) {
+		return fmt.Errorf("symlink target %q must be a relative path", target)
+	}
+	if rootDir == "" {
+		rootDir = path.Dir(localFile)
+	}
+	root, err := filepath.Abs(rootDir)
+	if err != nil {
+		return err
+	}
+	dir, err := filepath.Abs(path.Dir(localFile))
+	if err != nil {
+		return err
+	}
+	resolved := filepath.Join(dir, filepath.FromSlash(target))
+	if resolved != root && !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+		return fmt.Errorf("symlink target %q is outside %s", target, rootDir)
+	}
+	return nil
+}
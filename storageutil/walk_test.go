@@ -0,0 +1,116 @@
+package storageutil_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shideqin/storage/storageutil"
+)
+
+func TestCreateSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "sub", "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		file    string
+		target  string
+		rootDir string
+		ok      bool
+	}{
+		{"sibling", "sub/link", "a.txt", "", true},
+		{"inside root", "sub/link", "../a.txt", dir, true},
+		{"parent without root", "sub/link", "../a.txt", "", false},
+		{"outside root", "sub/link", "../../a.txt", dir, false},
+		{"absolute", "sub/link", "/etc/passwd", dir, false},
+		{"empty", "sub/link", "", dir, false},
+		{"existing directory", "sub/dir", "a.txt", dir, false},
+	}
+	for _, tt := range tests {
+		localFile := filepath.Join(dir, tt.file)
+		err := storageutil.CreateSymlink(localFile, tt.target, tt.rootDir)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: CreateSymlink(%q) error = %v, want ok %v", tt.name, tt.target, err, tt.ok)
+			continue
+		}
+		if tt.ok {
+			if link, _ := os.Readlink(localFile); link != tt.target {
+				t.Errorf("%s: link = %q, want %q", tt.name, link, tt.target)
+			}
+		}
+	}
+}
+
+func TestGetSymlinkMarker(t *testing.T) {
+	server, client := newMirrorClient()
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server.PutObject("bucket", "link", nil, http.Header{"X-Amz-Meta-Symlink-Target": {"target.txt"}})
+	server.PutObject("bucket", "escape", nil, http.Header{"X-Amz-Meta-Symlink-Target": {"../../etc/passwd"}})
+
+	//没有指定symlinks=preserve时下载为普通文件
+	localFile := filepath.Join(dir, "link")
+	if _, err := client.Get("bucket", "link", localFile, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Lstat(localFile); err != nil || fi.Mode()&os.ModeSymlink != 0 {
+		t.Errorf("Get without preserve: mode %v, err %v", fi.Mode(), err)
+	}
+	options := map[string]string{"symlinks": "preserve", "local_dir": dir}
+	if _, err := client.Get("bucket", "link", localFile, options, nil); err != nil {
+		t.Fatal(err)
+	}
+	if link, _ := os.Readlink(localFile); link != "target.txt" {
+		t.Errorf("Get with preserve: link = %q, want target.txt", link)
+	}
+	if _, err := client.Get("bucket", "escape", filepath.Join(dir, "escape"), options, nil); err == nil {
+		t.Error("Get with target outside local_dir: expected error")
+	}
+}
+
+func TestWalkDirError(t *testing.T) {
+	list, err := storageutil.WalkDir(filepath.Join(os.TempDir(), "storageutil-missing-dir"), "")
+	if err == nil || len(list) != 0 {
+		t.Errorf("WalkDir missing dir = %v, %v, want error", list, err)
+	}
+}
+
+func TestWalkKeyOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storageutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a/c", "a-b", "a0", "b"} {
+		localFile := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(localFile), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(localFile, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//与object的key顺序一致,目录a按a/排序
+	want := []string{"a-b", "a/c", "a0", "b"}
+	var got []string
+	_ = storageutil.Walk(dir, nil, func(entry storageutil.WalkEntry) error {
+		got = append(got, entry.Name)
+		return nil
+	})
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Walk order = %v, want %v", got, want)
+	}
+}